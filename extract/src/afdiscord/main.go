@@ -0,0 +1,171 @@
+//------------------------------------------------------------------------------
+// Cross-panel allele frequency discordance report
+//
+// The same SNP is often stored under several assaytypes, large differences
+// in allele frequency between panels usually mean strand or allele coding
+// errors.
+//
+// Steps:
+// 1) Read in a file of rs numbers, or (no rsfile) walk the variants collection
+//    for rsids present in more than one of the requested assaytypes
+// 2) In batches, get the VCF records for each rsid from all assaytypes
+// 3) Compare alt allele frequencies across panels and with RefPanelAF
+// 4) Output a ranked report (most discordant first), with suspected flips
+//    optionally also written as assaytype,rsid lines to a flip file
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"genometrics"
+	"godb"
+	"log"
+	"os"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var rsFilePath string
+var flipFilePath string
+var vcfPathPref string
+var threshold float64
+var flipDelta float64
+var assayTypes string
+var batchSize int
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath  = "./data/afdiscord_output.log"
+		lusage              = "Log file"
+		defaultRsFilePath   = ""
+		rsusage             = "File containing list of rsnumbers (default: all multi-assay variants)"
+		defaultFlipFilePath = ""
+		fusage              = "Output file for suspected flips (assaytype,rsid)"
+		defaultvcfPathPref  = ""
+		vusage              = "default path prefix for vcf files"
+		defaultThreshold    = 0.9
+		thrusage            = "Prob threshold"
+		defaultFlipDelta    = 0.1
+		dusage              = "AF difference above which flips are tested for"
+		defaultAssayTypes   = "affy,illumina,broad,metabo,exome"
+		atusage             = "Assay types"
+		defaultBatchSize    = 1000
+		busage              = "Number of rsids read per batch"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&rsFilePath, "rsfile", defaultRsFilePath, rsusage)
+	flag.StringVar(&rsFilePath, "r", defaultRsFilePath, rsusage+" (shorthand)")
+	flag.StringVar(&flipFilePath, "flipfile", defaultFlipFilePath, fusage)
+	flag.StringVar(&flipFilePath, "f", defaultFlipFilePath, fusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, vusage)
+	flag.StringVar(&vcfPathPref, "v", defaultvcfPathPref, vusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.Float64Var(&flipDelta, "delta", defaultFlipDelta, dusage)
+	flag.Float64Var(&flipDelta, "d", defaultFlipDelta, dusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.IntVar(&batchSize, "batch", defaultBatchSize, busage)
+	flag.IntVar(&batchSize, "b", defaultBatchSize, busage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START afdiscord delta=%.3f, threshold=%.2f\n", flipDelta, threshold)
+
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	rsidList := make([]string, 0, 1000)
+	if rsFilePath != "" {
+		f, err := os.Open(rsFilePath)
+		check(err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rsidList = append(rsidList, scanner.Text())
+		}
+	} else {
+		rsidList = godb.GetMultiAssayVarids(validAssaytypes)
+	}
+	log.Printf("rsids to compare: %d\n", len(rsidList))
+
+	entries := make([]genometrics.AFDiscordance, 0, len(rsidList))
+	for start := 0; start < len(rsidList); start += batchSize {
+		end := start + batchSize
+		if end > len(rsidList) {
+			end = len(rsidList)
+		}
+		rsids, _ := godb.GetRecordsByVarid(vcfPathPref, rsidList[start:end], validAssaytypes)
+		for _, rsid := range rsidList[start:end] {
+			if records, ok := rsids[rsid]; ok && len(records) > 1 {
+				entries = append(entries, genometrics.CompareAlleleFreqs(records, threshold, flipDelta))
+			}
+		}
+		log.Printf("compared %d of %d\n", end, len(rsidList))
+	}
+
+	genometrics.RankAFDiscordance(entries)
+	fmt.Printf("%s\n", genometrics.AFDiscordanceHeader)
+	flipcount := 0
+	for i, entry := range entries {
+		fmt.Printf("%s\n", entry.TSV(i+1))
+		if entry.SuspectFlip {
+			flipcount++
+		}
+	}
+	if flipFilePath != "" {
+		writeFlipFile(entries)
+	}
+	log.Printf("END afdiscord compared=%d, suspectflips=%d\n", len(entries), flipcount)
+}
+
+//------------------------------------------------
+// Write suspected flips, one assaytype,rsid line per
+// flagged panel (or panel pair where there is no reference AF)
+//------------------------------------------------
+func writeFlipFile(entries []genometrics.AFDiscordance) {
+	f, err := os.Create(flipFilePath)
+	check(err)
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+	for _, entry := range entries {
+		for _, flip := range entry.Flips {
+			fmt.Fprintf(w, "%s,%s\n", flip, entry.Varid)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package assoc
+
+//
+// Covariates for adjusted tests: typed columns (Continuous, Binary or
+// Categorical) encoded as numeric design columns. Binary columns are 0/1
+// with the first level (in sort order) as 0, Categorical columns have an
+// indicator per level except the first (reference) level. Levels come from
+// the whole covariate file, so a column can be constant over the samples
+// tested for a variant (e.g. a level absent from a sample set), such
+// columns are dropped from that variant's fit. Samples missing any
+// covariate value are left out of adjusted tests
+//
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Covariate column types
+const (
+	CovarContinuous  = "Continuous"
+	CovarBinary      = "Binary"
+	CovarCategorical = "Categorical"
+)
+
+// Covariates ...
+// encoded design column Names and each sample's values in that order
+type Covariates struct {
+	Names  []string
+	Values map[string][]float64
+}
+
+// isMissing ...
+// covariate missing value codes, as ParsePhenoValue
+func isMissing(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == "" || value == "NA" || value == "-9" || value == "."
+}
+
+// design column name without white space
+func covarName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// ValidCovarType ...
+// true for Continuous, Binary or Categorical
+func ValidCovarType(covarType string) bool {
+	return covarType == CovarContinuous || covarType == CovarBinary || covarType == CovarCategorical
+}
+
+// InferCovarType ...
+// Binary for two distinct values, otherwise Continuous if all values are
+// numeric, otherwise Categorical. Missing values are ignored
+func InferCovarType(values []string) string {
+	levels := make(map[string]bool)
+	numeric := true
+	for _, value := range values {
+		if isMissing(value) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		levels[value] = true
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			numeric = false
+		}
+	}
+	switch {
+	case len(levels) == 2:
+		return CovarBinary
+	case numeric:
+		return CovarContinuous
+	}
+	return CovarCategorical
+}
+
+// ParseCovarHeader ...
+// covariate column names and types from a header (iid column excluded),
+// a column may be typed as name:type, "" for a type to be inferred
+func ParseCovarHeader(hdr []string) ([]string, []string, error) {
+	columns := make([]string, len(hdr))
+	types := make([]string, len(hdr))
+	for i, col := range hdr {
+		parts := strings.SplitN(strings.TrimSpace(col), ":", 2)
+		columns[i] = parts[0]
+		if len(parts) == 2 {
+			types[i] = parts[1]
+			if !ValidCovarType(types[i]) {
+				return nil, nil, fmt.Errorf("column %s: invalid type %s, expected %s, %s or %s", parts[0], parts[1],
+					CovarContinuous, CovarBinary, CovarCategorical)
+			}
+		}
+		if columns[i] == "" {
+			return nil, nil, fmt.Errorf("column %d has no name", i+2)
+		}
+	}
+	return columns, types, nil
+}
+
+// EncodeCovariates ...
+// design columns for covariate columns of the given types from values by
+// sample id (in column order). Samples with a missing value are dropped
+func EncodeCovariates(columns []string, types []string, data map[string][]string) (Covariates, error) {
+	covs := Covariates{Names: make([]string, 0, len(columns)), Values: make(map[string][]float64, len(data))}
+	ids := make([]string, 0, len(data))
+	for id, values := range data {
+		complete := len(values) >= len(columns)
+		for c := 0; complete && c < len(columns); c++ {
+			complete = !isMissing(values[c])
+		}
+		if complete {
+			ids = append(ids, id)
+			covs.Values[id] = make([]float64, 0, len(columns))
+		}
+	}
+	if len(ids) == 0 {
+		return covs, fmt.Errorf("no samples with values for all of %s", strings.Join(columns, ", "))
+	}
+	sort.Strings(ids)
+	for c, col := range columns {
+		switch types[c] {
+		case CovarContinuous:
+			covs.Names = append(covs.Names, covarName(col))
+			for _, id := range ids {
+				val, err := strconv.ParseFloat(strings.TrimSpace(data[id][c]), 64)
+				if err != nil {
+					return covs, fmt.Errorf("column %s: %s is not numeric for %s", col, data[id][c], id)
+				}
+				covs.Values[id] = append(covs.Values[id], val)
+			}
+		case CovarBinary, CovarCategorical:
+			levelSet := make(map[string]bool)
+			for _, id := range ids {
+				levelSet[strings.TrimSpace(data[id][c])] = true
+			}
+			levels := make([]string, 0, len(levelSet))
+			for level := range levelSet {
+				levels = append(levels, level)
+			}
+			sort.Strings(levels)
+			if types[c] == CovarBinary && len(levels) > 2 {
+				return covs, fmt.Errorf("column %s: %d values for a Binary covariate", col, len(levels))
+			}
+			// indicator per non-reference level
+			for _, level := range levels[1:] {
+				covs.Names = append(covs.Names, covarName(col+"_"+level))
+				for _, id := range ids {
+					ind := 0.0
+					if strings.TrimSpace(data[id][c]) == level {
+						ind = 1.0
+					}
+					covs.Values[id] = append(covs.Values[id], ind)
+				}
+			}
+		default:
+			return covs, fmt.Errorf("column %s: invalid type %s", col, types[c])
+		}
+	}
+	return covs, nil
+}
+
+// ContinuousCovariate ...
+// a single Continuous covariate from phenotype values by sample id, e.g.
+// stored principal component scores or GRS scores
+func ContinuousCovariate(name string, pheno map[string]string) Covariates {
+	covs := Covariates{Names: []string{covarName(name)}, Values: make(map[string][]float64, len(pheno))}
+	for id, value := range pheno {
+		if val, ok := ParsePhenoValue(value); ok {
+			covs.Values[id] = []float64{val}
+		}
+	}
+	return covs
+}
+
+// Merge ...
+// covariates from both sets for the samples in both. An empty set (no
+// Names) leaves the other unchanged
+func (covs Covariates) Merge(other Covariates) Covariates {
+	if len(covs.Names) == 0 {
+		return other
+	}
+	if len(other.Names) == 0 {
+		return covs
+	}
+	merged := Covariates{Names: append(append([]string{}, covs.Names...), other.Names...),
+		Values: make(map[string][]float64, len(covs.Values))}
+	for id, values := range covs.Values {
+		if otherValues, ok := other.Values[id]; ok {
+			merged.Values[id] = append(append([]float64{}, values...), otherValues...)
+		}
+	}
+	return merged
+}
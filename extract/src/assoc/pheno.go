@@ -0,0 +1,60 @@
+package assoc
+
+//
+// Phenotype values as stored in ehrdb (strings by sample id): missing value
+// codes and case / control codings
+//
+import (
+	"strconv"
+	"strings"
+)
+
+// ParsePhenoValue ...
+// numeric phenotype value, false for missing (NA, -9, blank or non-numeric)
+func ParsePhenoValue(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "NA" || value == "-9" || value == "." {
+		return 0.0, false
+	}
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0.0, false
+	}
+	return val, true
+}
+
+// CaseControlCoding ...
+// binary phenotype values as 0/1: 1/2 (PLINK) with 2 as case, or 0/1.
+// False if the values are not one of these codings
+func CaseControlCoding(values []float64) ([]float64, bool) {
+	seen := make(map[float64]bool)
+	for _, val := range values {
+		seen[val] = true
+	}
+	caseValue := 1.0
+	switch {
+	case len(seen) == countKeys(seen, 1.0, 2.0):
+		caseValue = 2.0
+	case len(seen) == countKeys(seen, 0.0, 1.0):
+		caseValue = 1.0
+	default:
+		return nil, false
+	}
+	coded := make([]float64, len(values))
+	for i, val := range values {
+		if val == caseValue {
+			coded[i] = 1.0
+		}
+	}
+	return coded, true
+}
+
+func countKeys(seen map[float64]bool, keys ...float64) int {
+	count := 0
+	for _, key := range keys {
+		if seen[key] {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,244 @@
+// Package assoc ...
+// Regression models for association testing
+//
+// Linear regression by ordinary least squares, logistic regression by
+// iteratively reweighted least squares (Newton-Raphson). Rows are
+// observations, an intercept column is added to the predictors given.
+// Predictor counts are small so (X'WX) is inverted directly
+//
+package assoc
+
+import (
+	"errors"
+	"math"
+)
+
+// MaxIterations ...
+// IRLS iterations before logistic regression is reported as not converged
+const MaxIterations = 25
+
+// ErrSingular ...
+// predictors are collinear (or constant)
+var ErrSingular = errors.New("assoc: singular design matrix")
+
+// Fit ...
+// coefficients, intercept first, with standard errors, test statistics
+// (t for linear, Wald z for logistic) and two-sided p-values
+type Fit struct {
+	Beta      []float64
+	SE        []float64
+	Stat      []float64
+	P         []float64
+	N         int
+	DF        int
+	R2        float64
+	Converged bool
+	Iter      int
+}
+
+// design matrix with an intercept column
+func design(x [][]float64) [][]float64 {
+	xd := make([][]float64, len(x))
+	for i, row := range x {
+		xd[i] = make([]float64, len(row)+1)
+		xd[i][0] = 1.0
+		copy(xd[i][1:], row)
+	}
+	return xd
+}
+
+// X'WX and X'Wz, w nil for unweighted
+func crossProducts(xd [][]float64, w []float64, z []float64) ([][]float64, []float64) {
+	p := len(xd[0])
+	xtx := make([][]float64, p)
+	for a := range xtx {
+		xtx[a] = make([]float64, p)
+	}
+	xtz := make([]float64, p)
+	for i, row := range xd {
+		wi := 1.0
+		if w != nil {
+			wi = w[i]
+		}
+		for a := 0; a < p; a++ {
+			xtz[a] += wi * row[a] * z[i]
+			for b := a; b < p; b++ {
+				xtx[a][b] += wi * row[a] * row[b]
+			}
+		}
+	}
+	for a := 0; a < p; a++ {
+		for b := 0; b < a; b++ {
+			xtx[a][b] = xtx[b][a]
+		}
+	}
+	return xtx, xtz
+}
+
+// Invert ...
+// inverse of a small square matrix by Gauss-Jordan elimination with partial
+// pivoting, ErrSingular if a pivot is (relatively) zero
+func Invert(m [][]float64) ([][]float64, error) {
+	n := len(m)
+	a := make([][]float64, n)
+	scale := 0.0
+	for i := range m {
+		a[i] = make([]float64, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1.0
+		for _, val := range m[i] {
+			scale = math.Max(scale, math.Abs(val))
+		}
+	}
+	for c := 0; c < n; c++ {
+		piv := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[piv][c]) {
+				piv = r
+			}
+		}
+		if math.Abs(a[piv][c]) <= 1e-12*scale || a[piv][c] == 0.0 {
+			return nil, ErrSingular
+		}
+		a[c], a[piv] = a[piv], a[c]
+		pv := a[c][c]
+		for k := range a[c] {
+			a[c][k] /= pv
+		}
+		for r := 0; r < n; r++ {
+			if r == c || a[r][c] == 0.0 {
+				continue
+			}
+			f := a[r][c]
+			for k := range a[r] {
+				a[r][k] -= f * a[c][k]
+			}
+		}
+	}
+	inv := make([][]float64, n)
+	for i := range inv {
+		inv[i] = a[i][n:]
+	}
+	return inv, nil
+}
+
+// LinearRegression ...
+// OLS of y on x (rows observations), t tests on n - p degrees of freedom
+func LinearRegression(y []float64, x [][]float64) (Fit, error) {
+	xd := design(x)
+	n, p := len(y), len(xd[0])
+	if n <= p {
+		return Fit{N: n}, ErrSingular
+	}
+	xtx, xty := crossProducts(xd, nil, y)
+	inv, err := Invert(xtx)
+	if err != nil {
+		return Fit{N: n}, err
+	}
+	fit := Fit{Beta: make([]float64, p), SE: make([]float64, p), Stat: make([]float64, p), P: make([]float64, p),
+		N: n, DF: n - p, Converged: true}
+	for a := 0; a < p; a++ {
+		for b := 0; b < p; b++ {
+			fit.Beta[a] += inv[a][b] * xty[b]
+		}
+	}
+	mean := 0.0
+	for _, yi := range y {
+		mean += yi
+	}
+	mean /= float64(n)
+	rss, tss := 0.0, 0.0
+	for i, row := range xd {
+		pred := 0.0
+		for a, xa := range row {
+			pred += fit.Beta[a] * xa
+		}
+		rss += (y[i] - pred) * (y[i] - pred)
+		tss += (y[i] - mean) * (y[i] - mean)
+	}
+	if tss > 0.0 {
+		fit.R2 = 1.0 - rss/tss
+	}
+	sigma2 := rss / float64(fit.DF)
+	for a := 0; a < p; a++ {
+		fit.SE[a] = math.Sqrt(sigma2 * inv[a][a])
+		if fit.SE[a] > 0.0 {
+			fit.Stat[a] = fit.Beta[a] / fit.SE[a]
+			fit.P[a] = StudentTP(fit.Stat[a], float64(fit.DF))
+		} else {
+			fit.P[a] = 1.0
+		}
+	}
+	return fit, nil
+}
+
+// LogisticRegression ...
+// logistic regression of y (0/1) on x (rows observations), Wald tests.
+// Converged is false if the deviance has not settled within MaxIterations
+// (e.g. separation), the last estimates are returned
+func LogisticRegression(y []float64, x [][]float64) (Fit, error) {
+	xd := design(x)
+	n, p := len(y), len(xd[0])
+	if n <= p {
+		return Fit{N: n}, ErrSingular
+	}
+	fit := Fit{Beta: make([]float64, p), SE: make([]float64, p), Stat: make([]float64, p), P: make([]float64, p),
+		N: n, DF: n - p}
+	w := make([]float64, n)
+	z := make([]float64, n)
+	var inv [][]float64
+	deviance := math.Inf(1)
+	for fit.Iter = 1; fit.Iter <= MaxIterations; fit.Iter++ {
+		dev := 0.0
+		for i, row := range xd {
+			eta := 0.0
+			for a, xa := range row {
+				eta += fit.Beta[a] * xa
+			}
+			mu := 1.0 / (1.0 + math.Exp(-eta))
+			mu = math.Min(math.Max(mu, 1e-10), 1.0-1e-10)
+			w[i] = mu * (1.0 - mu)
+			z[i] = eta + (y[i]-mu)/w[i]
+			if y[i] > 0.5 {
+				dev -= 2.0 * math.Log(mu)
+			} else {
+				dev -= 2.0 * math.Log(1.0-mu)
+			}
+		}
+		if math.Abs(deviance-dev) < 1e-8*(math.Abs(dev)+0.1) {
+			fit.Converged = true
+			break
+		}
+		deviance = dev
+		xtwx, xtwz := crossProducts(xd, w, z)
+		var err error
+		inv, err = Invert(xtwx)
+		if err != nil {
+			return fit, err
+		}
+		for a := 0; a < p; a++ {
+			fit.Beta[a] = 0.0
+			for b := 0; b < p; b++ {
+				fit.Beta[a] += inv[a][b] * xtwz[b]
+			}
+		}
+	}
+	if fit.Iter > MaxIterations {
+		fit.Iter = MaxIterations
+	}
+	xtwx, _ := crossProducts(xd, w, z)
+	inv, err := Invert(xtwx)
+	if err != nil {
+		return fit, err
+	}
+	for a := 0; a < p; a++ {
+		fit.SE[a] = math.Sqrt(inv[a][a])
+		if fit.SE[a] > 0.0 {
+			fit.Stat[a] = fit.Beta[a] / fit.SE[a]
+			fit.P[a] = NormalP(fit.Stat[a])
+		} else {
+			fit.P[a] = 1.0
+		}
+	}
+	return fit, nil
+}
@@ -0,0 +1,96 @@
+package assoc
+
+import (
+	"math"
+	"testing"
+)
+
+// R datasets: cars (lm(dist ~ speed)) and mtcars (glm(vs ~ mpg, family = binomial))
+var carsSpeed = []float64{4, 4, 7, 7, 8, 9, 10, 10, 10, 11, 11, 12, 12, 12, 12, 13, 13, 13, 13, 14, 14, 14, 14, 15, 15, 15,
+	16, 16, 17, 17, 17, 18, 18, 18, 18, 19, 19, 19, 20, 20, 20, 20, 20, 22, 23, 24, 24, 24, 24, 25}
+var carsDist = []float64{2, 10, 4, 22, 16, 10, 18, 26, 34, 17, 28, 14, 20, 24, 28, 26, 34, 34, 46, 26, 36, 60, 80, 20, 26,
+	54, 32, 40, 32, 40, 50, 42, 56, 76, 84, 36, 46, 68, 32, 48, 52, 56, 64, 66, 54, 70, 92, 93, 120, 85}
+var mtcarsMpg = []float64{21.0, 21.0, 22.8, 21.4, 18.7, 18.1, 14.3, 24.4, 22.8, 19.2, 17.8, 16.4, 17.3, 15.2, 10.4, 10.4,
+	14.7, 32.4, 30.4, 33.9, 21.5, 15.5, 15.2, 13.3, 19.2, 27.3, 26.0, 30.4, 15.8, 19.7, 15.0, 21.4}
+var mtcarsVs = []float64{0, 0, 1, 1, 0, 1, 0, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 0, 0, 0, 0, 1, 0, 1, 0, 0, 0, 1}
+
+func columns(x []float64) [][]float64 {
+	xs := make([][]float64, len(x))
+	for i, xi := range x {
+		xs[i] = []float64{xi}
+	}
+	return xs
+}
+
+// coefficient table rows: estimate, SE, statistic, p as printed by R summary()
+type coefRow struct {
+	beta float64
+	se   float64
+	stat float64
+	p    float64
+}
+
+func checkFit(t *testing.T, name string, fit Fit, want []coefRow) {
+	for a, row := range want {
+		got := []float64{fit.Beta[a], fit.SE[a], fit.Stat[a], fit.P[a]}
+		for k, w := range []float64{row.beta, row.se, row.stat, row.p} {
+			if math.Abs(got[k]-w) > 1e-4*math.Abs(w) {
+				t.Errorf("%s coefficient %d column %d = %.6g, want %.6g", name, a, k, got[k], w)
+			}
+		}
+	}
+}
+
+func TestLinearRegression(t *testing.T) {
+	fit, err := LinearRegression(carsDist, columns(carsSpeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFit(t, "lm(dist ~ speed)", fit, []coefRow{
+		{-17.579095, 6.758440, -2.601058, 0.01231882},
+		{3.932409, 0.4155128, 9.463990, 1.489836e-12},
+	})
+	if fit.DF != 48 || math.Abs(fit.R2-0.6510794) > 1e-6 {
+		t.Errorf("lm(dist ~ speed) df %d R2 %.7f, want 48 0.6510794", fit.DF, fit.R2)
+	}
+}
+
+func TestLogisticRegression(t *testing.T) {
+	fit, err := LogisticRegression(mtcarsVs, columns(mtcarsMpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fit.Converged {
+		t.Errorf("glm(vs ~ mpg) did not converge")
+	}
+	checkFit(t, "glm(vs ~ mpg)", fit, []coefRow{
+		{-8.833073, 3.162274, -2.793266, 0.005217880},
+		{0.4304135, 0.1584220, 2.716880, 0.006590048},
+	})
+}
+
+func TestRegressionEdgeCases(t *testing.T) {
+	constant := columns([]float64{1, 1, 1, 1, 1})
+	if _, err := LinearRegression([]float64{1, 2, 3, 4, 5}, constant); err != ErrSingular {
+		t.Errorf("constant predictor: err %v, want ErrSingular", err)
+	}
+	// complete separation: estimates diverge and the fit is reported as not converged
+	fit, err := LogisticRegression([]float64{0, 0, 0, 1, 1, 1}, columns([]float64{1, 2, 3, 4, 5, 6}))
+	if err == nil && fit.Converged {
+		t.Errorf("separated data reported as converged, beta %v", fit.Beta)
+	}
+}
+
+func TestSortByP(t *testing.T) {
+	results := []Result{
+		{Varid: "untested", P: 1.0, Message: "no cases or no controls"},
+		{Varid: "nonconverged", P: 0.01, Tested: true, Message: "logistic regression did not converge"},
+		{Varid: "tested", P: 0.2, Tested: true},
+	}
+	SortByP(results)
+	for i, varid := range []string{"nonconverged", "tested", "untested"} {
+		if results[i].Varid != varid {
+			t.Errorf("SortByP position %d = %s, want %s", i, results[i].Varid, varid)
+		}
+	}
+}
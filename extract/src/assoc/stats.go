@@ -0,0 +1,86 @@
+package assoc
+
+//
+// Distribution functions for test p-values
+//
+import (
+	"math"
+)
+
+// NormalP ...
+// two-sided p-value for a standard normal z
+func NormalP(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// StudentTP ...
+// two-sided p-value for t on df degrees of freedom
+func StudentTP(t float64, df float64) float64 {
+	if df <= 0.0 {
+		return math.NaN()
+	}
+	return RegIncBeta(df/2.0, 0.5, df/(df+t*t))
+}
+
+// RegIncBeta ...
+// regularized incomplete beta function I_x(a, b), continued fraction
+// (Numerical Recipes betacf)
+func RegIncBeta(a float64, b float64, x float64) float64 {
+	if x <= 0.0 {
+		return 0.0
+	}
+	if x >= 1.0 {
+		return 1.0
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1.0-x))
+	if x < (a+1.0)/(a+b+2.0) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1.0 - front*betaCF(b, a, 1.0-x)/b
+}
+
+func betaCF(a float64, b float64, x float64) float64 {
+	const eps = 1e-14
+	const tiny = 1e-300
+	qab, qap, qam := a+b, a+1.0, a-1.0
+	c, d := 1.0, 1.0-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1.0 / d
+	h := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		m2 := 2.0 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1.0 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1.0 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1.0 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1.0 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1.0 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1.0 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1.0) < eps {
+			break
+		}
+	}
+	return h
+}
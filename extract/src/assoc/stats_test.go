@@ -0,0 +1,72 @@
+package assoc
+
+import (
+	"math"
+	"testing"
+)
+
+// reference values from R: 2*pt(-abs(t), df), 2*pnorm(-abs(z)), pbeta(x, a, b)
+
+func TestStudentTP(t *testing.T) {
+	tests := []struct {
+		t  float64
+		df float64
+		p  float64
+	}{
+		{2.0, 10, 0.07338803},
+		{-2.0, 10, 0.07338803},
+		{0.0, 5, 1.0},
+		{12.7062047, 1, 0.05},
+		{2.22813885, 10, 0.05},
+		{2.74999565, 30, 0.01},
+		{9.46398999, 48, 1.489836e-12},
+		{-2.60105800, 48, 0.01231882},
+	}
+	for _, tt := range tests {
+		if p := StudentTP(tt.t, tt.df); math.Abs(p-tt.p) > 1e-6*tt.p {
+			t.Errorf("StudentTP(%g, %g) = %.8g, want %.8g", tt.t, tt.df, p, tt.p)
+		}
+	}
+	if p := StudentTP(1.0, 0.0); !math.IsNaN(p) {
+		t.Errorf("StudentTP(1, 0) = %g, want NaN", p)
+	}
+}
+
+func TestNormalP(t *testing.T) {
+	tests := []struct {
+		z float64
+		p float64
+	}{
+		{0.0, 1.0},
+		{1.95996398, 0.05},
+		{-2.5758293, 0.01},
+		{5.0, 5.733031e-07},
+	}
+	for _, tt := range tests {
+		if p := NormalP(tt.z); math.Abs(p-tt.p) > 1e-6*tt.p {
+			t.Errorf("NormalP(%g) = %.8g, want %.8g", tt.z, p, tt.p)
+		}
+	}
+}
+
+func TestRegIncBeta(t *testing.T) {
+	tests := []struct {
+		a float64
+		b float64
+		x float64
+		p float64
+	}{
+		{1, 1, 0.2, 0.2},
+		{2, 2, 0.3, 0.216},
+		{2, 3, 0.5, 0.6875},
+		{5, 0.5, 0.5, 0.01011956},
+		{0.5, 0.5, 0.25, 1.0 / 3.0},
+		{2, 3, 0.0, 0.0},
+		{2, 3, 1.0, 1.0},
+	}
+	for _, tt := range tests {
+		if p := RegIncBeta(tt.a, tt.b, tt.x); math.Abs(p-tt.p) > 1e-6*math.Max(tt.p, 1e-10) {
+			t.Errorf("RegIncBeta(%g, %g, %g) = %.8g, want %.8g", tt.a, tt.b, tt.x, p, tt.p)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package assoc
+
+//
+// Single variant association tests on combined records: each variant's
+// genotypes are coded under the genetic model (alt allele as the tested
+// allele) and the phenotype regressed on them, linear for continuous and
+// logistic for binary (case / control) phenotypes, adjusted for any
+// covariates. Samples without a genotype call, a phenotype value or (for
+// adjusted tests) covariate values are left out of that variant's test
+//
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// Genetic models
+const (
+	ModelAdditive  = "additive"
+	ModelDominant  = "dominant"
+	ModelRecessive = "recessive"
+)
+
+// Params ...
+// Model (additive, dominant or recessive), dosages or hard calls at
+// Threshold, Binary for case / control phenotypes, Covariates (no Names
+// for an unadjusted test)
+type Params struct {
+	Model      string
+	UseDosage  bool
+	Threshold  float64
+	Binary     bool
+	Covariates Covariates
+}
+
+// Describe ...
+// test settings for display
+func (params Params) Describe() string {
+	geno := "hard calls"
+	if params.UseDosage {
+		geno = "dosages"
+	}
+	test := "linear"
+	if params.Binary {
+		test = "logistic"
+	}
+	desc := fmt.Sprintf("%s regression, %s model, %s", test, params.Model, geno)
+	if len(params.Covariates.Names) > 0 {
+		desc += ", adjusted for " + strings.Join(params.Covariates.Names, ", ")
+	}
+	return desc
+}
+
+// Result ...
+// per variant test of the alt allele: Beta (log OR for binary) per unit
+// of the coded genotype with SE, test statistic (t or Wald z) and p, OR
+// and 95% CI for binary phenotypes. MAF over the samples tested. Tested is
+// false if no model could be fitted, Message says why (or, for a tested
+// variant, notes a logistic fit that did not converge)
+type Result struct {
+	Varid     string
+	Chrom     string
+	Posn      int
+	Ref       string
+	Alt       string
+	Model     string
+	N         int
+	Cases     int
+	Controls  int
+	AltAF     float64
+	MAF       float64
+	Beta      float64
+	SE        float64
+	Stat      float64
+	P         float64
+	OR        float64
+	Lower     float64
+	Upper     float64
+	Converged bool
+	Tested    bool
+	Message   string
+}
+
+// CodeGenotype ...
+// genotype value under a model: hard calls use the alt allele count,
+// dosages the genotype probabilities (additive P(0/1) + 2P(1/1), dominant
+// P(0/1) + P(1/1), recessive P(1/1)). Also returns the alt allele dosage
+// for allele frequencies, false if missing
+func CodeGenotype(geno string, probidx int, dsidx int, params Params) (float64, float64, bool) {
+	if params.UseDosage {
+		gp, ok := variant.GenoProbs(geno, probidx, dsidx)
+		if !ok {
+			return 0.0, 0.0, false
+		}
+		dosage := gp[1] + 2.0*gp[2]
+		switch params.Model {
+		case ModelDominant:
+			return gp[1] + gp[2], dosage, true
+		case ModelRecessive:
+			return gp[2], dosage, true
+		}
+		return dosage, dosage, true
+	}
+	count, ok := variant.GetHardCall(geno, params.Threshold, probidx)
+	if !ok {
+		return 0.0, 0.0, false
+	}
+	switch params.Model {
+	case ModelDominant:
+		return math.Min(count, 1.0), count, true
+	case ModelRecessive:
+		if count >= 2.0 {
+			return 1.0, count, true
+		}
+		return 0.0, count, true
+	}
+	return count, count, true
+}
+
+// TestRecords ...
+// association of each combined record (header first, as returned by
+// godb.Getallvardata) with phenotype values by sample id
+//---------------------------------------------------------------------
+func TestRecords(records []string, pheno map[string]string, params Params) []Result {
+	results := make([]Result, 0, len(records))
+	if len(records) < 2 {
+		return results
+	}
+	_, sampleData := variant.GetVCFPrfxSfx(strings.Split(records[0], "\t"))
+	// phenotype by sample column, binary phenotypes coded 0/1
+	yAll := make([]float64, len(sampleData))
+	hasPheno := make([]bool, len(sampleData))
+	values := make([]float64, 0, len(sampleData))
+	cols := make([]int, 0, len(sampleData))
+	adjusted := len(params.Covariates.Names) > 0
+	covRows := make([][]float64, len(sampleData))
+	for i, sampleID := range sampleData {
+		if adjusted {
+			covRows[i] = params.Covariates.Values[sampleID]
+			if covRows[i] == nil {
+				continue
+			}
+		}
+		if val, ok := ParsePhenoValue(pheno[sampleID]); ok {
+			values = append(values, val)
+			cols = append(cols, i)
+		}
+	}
+	phenoMessage := ""
+	if params.Binary {
+		coded, ok := CaseControlCoding(values)
+		if !ok {
+			phenoMessage = "phenotype values are not 0/1 or 1/2 case/control"
+		}
+		values = coded
+	}
+	for k, i := range cols {
+		if phenoMessage == "" {
+			yAll[i] = values[k]
+			hasPheno[i] = true
+		}
+	}
+
+	for _, record := range records[1:] {
+		recData := strings.Split(record, "\t")
+		prfx, genoData := variant.GetVCFPrfxSfx(recData)
+		ref, alt := variant.GetAlleles(prfx)
+		res := Result{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx), Posn: variant.GetPosn(prfx),
+			Ref: ref, Alt: alt, Model: params.Model, Message: phenoMessage}
+		if phenoMessage != "" {
+			results = append(results, res)
+			continue
+		}
+		probidx := variant.GetProbIdx(prfx)
+		dsidx := variant.GetDosageIdx(prfx)
+		y := make([]float64, 0, len(genoData))
+		x := make([][]float64, 0, len(genoData))
+		altSum := 0.0
+		for i, geno := range genoData {
+			if i >= len(sampleData) || !hasPheno[i] {
+				continue
+			}
+			coded, dosage, ok := CodeGenotype(geno, probidx, dsidx, params)
+			if !ok {
+				continue
+			}
+			y = append(y, yAll[i])
+			x = append(x, append([]float64{coded}, covRows[i]...))
+			altSum += dosage
+		}
+		results = append(results, testVariant(res, y, x, altSum, params))
+	}
+	return results
+}
+
+// fit one variant's coded genotypes x against phenotype values y
+func testVariant(res Result, y []float64, x [][]float64, altSum float64, params Params) Result {
+	res.N = len(y)
+	if res.N > 0 {
+		res.AltAF = altSum / float64(2*res.N)
+		res.MAF = math.Min(res.AltAF, 1.0-res.AltAF)
+	}
+	res.P = 1.0
+	if params.Binary {
+		for _, yi := range y {
+			if yi == 1.0 {
+				res.Cases++
+			}
+		}
+		res.Controls = res.N - res.Cases
+		if res.Cases == 0 || res.Controls == 0 {
+			res.Message = "no cases or no controls"
+			return res
+		}
+	}
+	if res.N < 3 {
+		res.Message = "fewer than 3 samples with a genotype and phenotype"
+		return res
+	}
+	x = dropConstantCovariates(x)
+	var fit Fit
+	var err error
+	if params.Binary {
+		fit, err = LogisticRegression(y, x)
+	} else {
+		fit, err = LinearRegression(y, x)
+	}
+	if err != nil {
+		if err == ErrSingular && len(params.Covariates.Names) > 0 {
+			res.Message = "genotype is monomorphic under the model or collinear with the covariates"
+		} else if err == ErrSingular {
+			res.Message = "genotype is monomorphic under the model"
+		} else {
+			res.Message = err.Error()
+		}
+		return res
+	}
+	res.Beta, res.SE, res.Stat, res.P, res.Converged = fit.Beta[1], fit.SE[1], fit.Stat[1], fit.P[1], fit.Converged
+	res.Tested = true
+	if params.Binary {
+		res.OR = math.Exp(res.Beta)
+		res.Lower = math.Exp(res.Beta - 1.96*res.SE)
+		res.Upper = math.Exp(res.Beta + 1.96*res.SE)
+		if !fit.Converged {
+			res.Message = "logistic regression did not converge"
+		}
+	}
+	return res
+}
+
+// design rows without the covariate columns (all but the first, the coded
+// genotype) that take one value over the rows, these are collinear with the
+// intercept and would make every fit singular
+func dropConstantCovariates(x [][]float64) [][]float64 {
+	if len(x) == 0 || len(x[0]) < 2 {
+		return x
+	}
+	keep := []int{0}
+	for c := 1; c < len(x[0]); c++ {
+		for _, row := range x[1:] {
+			if row[c] != x[0][c] {
+				keep = append(keep, c)
+				break
+			}
+		}
+	}
+	if len(keep) == len(x[0]) {
+		return x
+	}
+	kept := make([][]float64, len(x))
+	for i, row := range x {
+		kept[i] = make([]float64, len(keep))
+		for k, c := range keep {
+			kept[i][k] = row[c]
+		}
+	}
+	return kept
+}
+
+// SortByP ...
+// results in ascending p-value order, untested results last
+func SortByP(results []Result) {
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Tested != results[b].Tested {
+			return results[a].Tested
+		}
+		return results[a].P < results[b].P
+	})
+}
+
+// CSVField ...
+// a free text value as a CSV field, quoted (inner quotes doubled) if it
+// holds a comma, quote or line break
+func CSVField(value string) string {
+	if !strings.ContainsAny(value, ",\"\r\n") {
+		return value
+	}
+	return "\"" + strings.Replace(value, "\"", "\"\"", -1) + "\""
+}
+
+// ResultHeader ...
+// column headers for Result CSV output
+const ResultHeader = "varid,chrom,posn,ref,alt,model,n,cases,controls,alt_af,maf,beta,se,stat,p,or,or_l95,or_u95,message"
+
+// CSV ...
+func (res Result) CSV() string {
+	return fmt.Sprintf("%s,%s,%d,%s,%s,%s,%d,%d,%d,%.4f,%.4f,%.6f,%.6f,%.4f,%.4e,%.4f,%.4f,%.4f,%s", res.Varid, res.Chrom,
+		res.Posn, res.Ref, res.Alt, res.Model, res.N, res.Cases, res.Controls, res.AltAF, res.MAF, res.Beta, res.SE, res.Stat,
+		res.P, res.OR, res.Lower, res.Upper, CSVField(res.Message))
+}
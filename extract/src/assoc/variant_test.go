@@ -0,0 +1,28 @@
+package assoc
+
+import (
+	"testing"
+)
+
+// a covariate level absent from the tested samples gives an all zero
+// indicator column, which is dropped rather than making the fit singular
+func TestConstantCovariateDropped(t *testing.T) {
+	params := Params{Model: ModelAdditive, Covariates: Covariates{Names: []string{"centre_B"}}}
+	y := make([]float64, len(carsDist))
+	x := make([][]float64, len(carsDist))
+	altSum := 0.0
+	for i := range carsDist {
+		y[i] = carsDist[i]
+		x[i] = []float64{carsSpeed[i], 0.0}
+		altSum += carsSpeed[i]
+	}
+	res := testVariant(Result{}, y, x, altSum, params)
+	if !res.Tested || res.Message != "" {
+		t.Fatalf("constant covariate: tested %t message %q", res.Tested, res.Message)
+	}
+	unadjusted, _ := LinearRegression(carsDist, columns(carsSpeed))
+	if res.Beta != unadjusted.Beta[1] || res.P != unadjusted.P[1] {
+		t.Errorf("constant covariate: beta %g p %g, want the unadjusted beta %g p %g", res.Beta, res.P,
+			unadjusted.Beta[1], unadjusted.P[1])
+	}
+}
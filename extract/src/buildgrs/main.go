@@ -4,12 +4,21 @@
 // 1) Read in a file of rsids and GRS information, including effect allele and
 // wgt to apply
 // 2) For each SNP fine the data via the GoDb API
-// 3) Run the GetScores fn in the grs module
+// 3) Run GetScoresWithParams in the grs module, -mode hard (default) or
+// dosage (optional 2 x EAF imputation of missing genotypes, sum or average
+// normalisation), effect alleles matched on either strand with a per-SNP
+// matching report (-matchfile), scores optionally stored in
+// the grsscore collection (-storename). PGS Catalog scoring files are
+// accepted as the rsfile, coordinate-only entries matched by position in
+// the -build genome build, and can be saved as GRS input (-grsname).
+// -batch scores a list of stored GRS inputs in one genotype pass and writes
+// a sample x score table
 //------------------------------------------------------------------------------
 package main
 
 import (
 	"bufio"
+	"ehrdb"
 	"flag"
 	"fmt"
 	"godb"
@@ -30,6 +39,17 @@ var threshold float64
 var errpctthr float64
 var assayTypes string
 var logLevel int
+var scoreMode string
+var impute bool
+var norm string
+var margin float64
+var matchFilePath string
+var storeName string
+var genomeBuild string
+var grsName string
+var batchNames string
+var wideFilePath string
+var storeEach bool
 var validAssaytypes = map[string]bool{}
 
 //------------------------------------------------
@@ -52,6 +72,28 @@ func init() {
 		atusage            = "Assay types"
 		defaultLogLevel    = 0
 		loglusage          = "0=Minimal 1=Sum 2=max"
+		defaultScoreMode   = ""
+		musage             = "Scoring mode hard or dosage (default: hard, dosage for -batch)"
+		defaultImpute      = false
+		iusage             = "Impute missing genotypes as 2 x EAF"
+		defaultNorm        = grs.NormSum
+		nusage             = "Score normalisation sum or avg"
+		defaultMargin      = grs.DefaultPalindromeMargin
+		gusage             = "Drop palindromic SNPs with EAF or cohort EAF within this of 0.5"
+		defaultMatchFile   = ""
+		fusage             = "Output file for the per-SNP allele matching report"
+		defaultStoreName   = ""
+		susage             = "Store the scores in the grsscore collection under this GRS name"
+		defaultGenomeBuild = ""
+		busage             = "Genome build of the variant positions, PGS Catalog positions in another build are not used"
+		defaultGrsName     = ""
+		nmusage            = "Save a PGS Catalog rsfile in the grsinput collection under this GRS name"
+		defaultBatchNames  = ""
+		xusage             = "Comma separated stored GRS input names, or all, to score in one pass"
+		defaultWideFile    = ""
+		wusage             = "Output file for the -batch sample x score table (default stdout)"
+		defaultStoreEach   = false
+		kusage             = "With -batch, store each score in the grsscore collection under its GRS name"
 	)
 	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
 	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
@@ -65,6 +107,28 @@ func init() {
 	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
 	flag.IntVar(&logLevel, "logopt", defaultLogLevel, loglusage)
 	flag.IntVar(&logLevel, "o", defaultLogLevel, loglusage+" (shorthand)")
+	flag.StringVar(&scoreMode, "mode", defaultScoreMode, musage)
+	flag.StringVar(&scoreMode, "m", defaultScoreMode, musage+" (shorthand)")
+	flag.BoolVar(&impute, "impute", defaultImpute, iusage)
+	flag.BoolVar(&impute, "i", defaultImpute, iusage+" (shorthand)")
+	flag.StringVar(&norm, "norm", defaultNorm, nusage)
+	flag.StringVar(&norm, "n", defaultNorm, nusage+" (shorthand)")
+	flag.Float64Var(&margin, "margin", defaultMargin, gusage)
+	flag.Float64Var(&margin, "g", defaultMargin, gusage+" (shorthand)")
+	flag.StringVar(&matchFilePath, "matchfile", defaultMatchFile, fusage)
+	flag.StringVar(&matchFilePath, "f", defaultMatchFile, fusage+" (shorthand)")
+	flag.StringVar(&storeName, "storename", defaultStoreName, susage)
+	flag.StringVar(&storeName, "s", defaultStoreName, susage+" (shorthand)")
+	flag.StringVar(&genomeBuild, "build", defaultGenomeBuild, busage)
+	flag.StringVar(&genomeBuild, "b", defaultGenomeBuild, busage+" (shorthand)")
+	flag.StringVar(&grsName, "grsname", defaultGrsName, nmusage)
+	flag.StringVar(&grsName, "e", defaultGrsName, nmusage+" (shorthand)")
+	flag.StringVar(&batchNames, "batch", defaultBatchNames, xusage)
+	flag.StringVar(&batchNames, "x", defaultBatchNames, xusage+" (shorthand)")
+	flag.StringVar(&wideFilePath, "widefile", defaultWideFile, wusage)
+	flag.StringVar(&wideFilePath, "w", defaultWideFile, wusage+" (shorthand)")
+	flag.BoolVar(&storeEach, "storeeach", defaultStoreEach, kusage)
+	flag.BoolVar(&storeEach, "k", defaultStoreEach, kusage+" (shorthand)")
 	flag.Parse()
 }
 
@@ -79,6 +143,102 @@ func check(e error) {
 	}
 }
 
+//------------------------------------------------
+// pgsCatalogGrsList() convert a PGS Catalog scoring
+// file to GRS input lines, optionally saving them
+//------------------------------------------------
+func pgsCatalogGrsList(pgsList []string) []string {
+	score, err := grs.ParsePGSCatalog(pgsList)
+	check(err)
+	buildOK := score.BuildMatches(genomeBuild)
+	if !buildOK {
+		log.Printf("%s build %s, positions not used (build %s)\n", score.ID(), score.Build(), genomeBuild)
+	}
+	grsList, unresolved := score.GrsLines(func(chrom string, posn int, ea string, oa string) string {
+		if !buildOK {
+			return ""
+		}
+		return godb.GetPositionVarid(chrom, posn, ea, oa, validAssaytypes)
+	})
+	for _, entry := range unresolved {
+		log.Printf("Unresolved: %s %s %s/%s\n", entry.Rsid, entry.Locus(), entry.EA, entry.OA)
+	}
+	desc := fmt.Sprintf("%s; used=%d, unresolved=%d, skipped=%d", score.Description(), len(grsList)-1,
+		len(unresolved), score.Skipped)
+	log.Printf("%s\n", desc)
+	if grsName != "" {
+		grsitems := make(map[string][]string)
+		for _, line := range grsList[1:] {
+			lineData := strings.Split(line, ",")
+			grsitems[lineData[0]] = lineData[1:]
+		}
+		res, msg := ehrdb.InsertGrsInputDataWithMeta(ehrdb.DBGrsMeta{Name: grsName, Description: desc,
+			Source: score.ID(), Trait: score.Trait(), Build: score.Build()}, grsitems)
+		if !res {
+			log.Fatalf("GRS input save failed for %s: %s\n", grsName, msg)
+		}
+	}
+	return grsList
+}
+
+//------------------------------------------------
+// runBatch() score the -batch GRS inputs from one
+// extraction of the union of their SNPs
+//------------------------------------------------
+func runBatch() {
+	names := strings.Split(batchNames, ",")
+	if batchNames == "all" {
+		names = ehrdb.GetGrsMetaNames()
+	}
+	mode := scoreMode
+	if mode == "" {
+		mode = grs.ModeDosage
+	}
+	if mode != grs.ModeHard && mode != grs.ModeDosage {
+		log.Fatalf("Invalid scoring mode %s\n", mode)
+	}
+	sets := make([]grs.GrsSet, 0, len(names))
+	for _, name := range names {
+		grsList, count := ehrdb.GetGrsInputAsStringArrayByName(name)
+		if count == 0 {
+			log.Fatalf("No GRS input for %s\n", name)
+		}
+		sets = append(sets, grs.NewGrsSet(name, grsList))
+	}
+	rsidList := grs.UnionVarids(sets)
+	start := time.Now()
+	_, _, genorecs := godb.Getallvardata(vcfPathPref, rsidList, validAssaytypes, threshold)
+	log.Printf("Batch of %d GRS, %d SNPs, extract timing %s\n", len(sets), len(rsidList), time.Since(start))
+
+	start = time.Now()
+	params := grs.ScoreParams{Mode: mode, Impute: impute, Norm: norm, Threshold: threshold, PalindromeMargin: margin}
+	batch := grs.GetBatchScores(genorecs, sets, params)
+	log.Printf("GetBatchScores %v timing %s\n", params, time.Since(start))
+
+	out := os.Stdout
+	if wideFilePath != "" {
+		wf, err := os.Create(wideFilePath)
+		check(err)
+		defer wf.Close()
+		out = wf
+	}
+	w := bufio.NewWriter(out)
+	for _, line := range batch.WideLines() {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	check(w.Flush())
+
+	for s, name := range batch.Names {
+		log.Printf("%s SNP matching %v\n", name, grs.MatchCounts(batch.Matches[s]))
+		if !storeEach {
+			continue
+		}
+		version, replaced, err := ehrdb.InsertGrsScores(name, params.Describe()+";sampleset=None", batch.Scores[s])
+		check(err)
+		log.Printf("Stored %s version %d, replaced=%t\n", name, version, replaced)
+	}
+}
+
 //------------------------------------------------
 // main() program entry point
 //------------------------------------------------
@@ -90,6 +250,16 @@ func main() {
 
 	log.SetOutput(lf)
 
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	if batchNames != "" {
+		runBatch()
+		return
+	}
+
 	grsList := make([]string, 0, 1000)
 	grsInCount := 0
 
@@ -103,24 +273,43 @@ func main() {
 		grsList = append(grsList, grsLine)
 	}
 
-	atList := strings.Split(assayTypes, ",")
-	for at := range atList {
-		validAssaytypes[atList[at]] = true
+	if grs.IsPGSCatalog(grsList) {
+		grsList = pgsCatalogGrsList(grsList)
 	}
 
 	rsidList, eaMap, eafMap, wgtMap := grs.GetGrsMaps(grsList)
 
 	_, _, genorecs := godb.Getallvardata(vcfPathPref, rsidList, validAssaytypes, threshold)
 
+	if scoreMode == "" {
+		scoreMode = grs.ModeHard
+	}
+	if scoreMode != grs.ModeHard && scoreMode != grs.ModeDosage {
+		log.Fatalf("Invalid scoring mode %s\n", scoreMode)
+	}
 	start := time.Now()
-	grScores, grScoresFlip := grs.GetScores(genorecs, eaMap, eafMap, wgtMap)
-	elapsed := time.Since(start)
-	log.Printf("GetScores timing %s", elapsed)
-
-	for _, gScore := range grScores {
-		fmt.Printf("001:%s\n", gScore)
+	params := grs.ScoreParams{Mode: scoreMode, Impute: impute, Norm: norm, Threshold: threshold, PalindromeMargin: margin}
+	scores, matches := grs.GetScoresWithParams(genorecs, eaMap, eafMap, wgtMap, params)
+	log.Printf("GetScoresWithParams %v timing %s", params, time.Since(start))
+	log.Printf("SNP matching %v\n", grs.MatchCounts(matches))
+	if matchFilePath != "" {
+		mf, err := os.Create(matchFilePath)
+		check(err)
+		defer mf.Close()
+		w := bufio.NewWriter(mf)
+		fmt.Fprintf(w, "%s\n", grs.SNPMatchHeader)
+		for _, snp := range matches {
+			fmt.Fprintf(w, "%s\n", snp.TSV())
+		}
+		check(w.Flush())
+	}
+	fmt.Printf("%s\n", grs.ScoreHeader)
+	for _, score := range scores {
+		fmt.Printf("%s\n", score.ScoreLine())
 	}
-	for _, gScore := range grScoresFlip {
-		fmt.Printf("002:%s\n", gScore)
+	if storeName != "" {
+		version, replaced, err := ehrdb.InsertGrsScores(storeName, params.Describe()+";sampleset=None", scores)
+		check(err)
+		log.Printf("Stored %s version %d, replaced=%t\n", storeName, version, replaced)
 	}
 }
@@ -2,15 +2,22 @@
 // ehrdb - a collection of methods for EhrDb (MongoDb) access
 // - add data to and retrieve from pheno, pheno_meta
 // - add data to and retrieve from grs, grs_meta
+// - add data to and retrieve from grsscore, grsscore_meta
 // - add data to and retrieve from varlist, varlist_meta
+// - add data to and retrieve from sampleset, sampleset_meta
+// - add data to and retrieve from covariate, covariate_meta
 //
 package ehrdb
 
 import (
 	"encoding/json"
 	"fmt"
+	"grs"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -20,15 +27,20 @@ import (
 // dbconfig struct for db access
 //-----------------------------------------------
 type dbconfig struct {
-	Dbhost                string
-	Dbname                string
-	PhenoCollection       string
-	PhenoMetaCollection   string
-	GrsInputCollection    string
-	GrsMetaCollection     string
-	GrsScoreCollection    string
-	VarlistMetaCollection string
-	VarlistCollection     string
+	Dbhost                  string
+	Dbname                  string
+	PhenoCollection         string
+	PhenoMetaCollection     string
+	GrsInputCollection      string
+	GrsMetaCollection       string
+	GrsScoreCollection      string
+	GrsScoreMetaCollection  string
+	VarlistMetaCollection   string
+	VarlistCollection       string
+	SamplesetMetaCollection string
+	SamplesetCollection     string
+	CovarMetaCollection     string
+	CovarCollection         string
 }
 
 // DBPheno ...
@@ -67,6 +79,9 @@ type DBGrsInput struct {
 type DBGrsMeta struct {
 	Name        string `bson:"name,omitempty"`
 	Description string `bson:"description,omitempty"`
+	Source      string `bson:"source,omitempty"`
+	Trait       string `bson:"trait,omitempty"`
+	Build       string `bson:"build,omitempty"`
 }
 
 // DBGrsScore ...
@@ -77,6 +92,20 @@ type DBGrsScore struct {
 	IID      string `bson:"iid,omitempty"`
 	SnpCount int    `bson:"snpcount,omitempty"`
 	Score    string `bson:"score,omitempty"`
+	Imputed  int    `bson:"imputed"`
+	Version  int    `bson:"version,omitempty"`
+}
+
+// DBGrsScoreMeta ...
+// struct for the mongodb grsscore meta collection, one document per
+// stored scoring run (GRS name and version)
+//------------------------------------------------------
+type DBGrsScoreMeta struct {
+	Name    string    `bson:"name,omitempty"`
+	Version int       `bson:"version,omitempty"`
+	Params  string    `bson:"params,omitempty"`
+	Count   int       `bson:"count"`
+	Date    time.Time `bson:"date,omitempty"`
 }
 
 // DBVarlistMeta ...
@@ -95,6 +124,46 @@ type DBListVar struct {
 	VarID string `bson:"varid,omitempty"`
 }
 
+// DBSamplesetMeta ...
+// struct for the mongodb sampleset meta collection
+//------------------------------------------------------
+type DBSamplesetMeta struct {
+	Name        string `bson:"name,omitempty"`
+	Description string `bson:"description,omitempty"`
+}
+
+// DBSetSample ...
+// struct for the mongodb sample in a set of samples collection
+//------------------------------------------------------
+type DBSetSample struct {
+	Name     string `bson:"name,omitempty"`
+	SampleID string `bson:"sample_id,omitempty"`
+}
+
+// DBCovarMeta ...
+// struct for the mongodb covariate meta collection, one document per
+// covariate set with its column names and types (Continuous, Binary or
+// Categorical)
+//------------------------------------------------------
+type DBCovarMeta struct {
+	Name        string   `bson:"name,omitempty"`
+	Source      string   `bson:"source,omitempty"`
+	Description string   `bson:"description,omitempty"`
+	Columns     []string `bson:"columns,omitempty"`
+	Types       []string `bson:"types,omitempty"`
+	Count       int      `bson:"count"`
+}
+
+// DBCovar ...
+// struct for the mongodb covariate collection, one document per sample
+// with values in the order of the meta data columns
+//------------------------------------------------------
+type DBCovar struct {
+	Name   string   `bson:"name,omitempty"`
+	IId    string   `bson:"iid,omitempty"`
+	Values []string `bson:"values,omitempty"`
+}
+
 var dbconf dbconfig
 var session *mgo.Session
 
@@ -120,6 +189,18 @@ func loadDbConfig() {
 	if err != nil {
 		log.Fatalln("Cannot get configuration from file", err)
 	}
+	if dbconf.GrsScoreCollection == "" {
+		dbconf.GrsScoreCollection = "grsscore"
+	}
+	if dbconf.GrsScoreMetaCollection == "" {
+		dbconf.GrsScoreMetaCollection = "grsscore_meta"
+	}
+	if dbconf.CovarMetaCollection == "" {
+		dbconf.CovarMetaCollection = "covariate_meta"
+	}
+	if dbconf.CovarCollection == "" {
+		dbconf.CovarCollection = "covariate"
+	}
 }
 
 func check(e error) {
@@ -360,6 +441,121 @@ func InsertVarlistData(name string, items []string) bool {
 	return true
 }
 
+// ******* Sample set section ***********************************
+
+// GetSamplesetByName ...
+// Get all entries for a sample set by name
+//---------------------------------------------------------------------
+func GetSamplesetByName(name string) ([]string, int) {
+	sampleset := make([]string, 0, 100)
+
+	samplesetColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetCollection)
+
+	setSample := DBSetSample{}
+
+	find := samplesetColl.Find(bson.M{"name": name})
+
+	items := find.Iter()
+	count := 0
+	for items.Next(&setSample) {
+		sampleset = append(sampleset, setSample.SampleID)
+		count++
+	}
+	return sampleset, count
+}
+
+// GetSamplesetMetaByName ...
+// Get single entry for the samplesetMeta collection by name
+//---------------------------------------------------------------------
+func GetSamplesetMetaByName(name string) DBSamplesetMeta {
+	samplesetMetaColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetMetaCollection)
+
+	samplesetMeta := DBSamplesetMeta{}
+
+	find := samplesetMetaColl.Find(bson.M{"name": name})
+
+	items := find.Iter()
+	for items.Next(&samplesetMeta) {
+	}
+	return samplesetMeta
+}
+
+// GetSamplesetMetaNames ...
+// Get all sample set names from the sampleset meta collection
+//---------------------------------------------------------------------
+func GetSamplesetMetaNames() []string {
+	var samplesetNameList = make([]string, 0, 10)
+
+	samplesetMetaColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetMetaCollection)
+
+	samplesetMeta := DBSamplesetMeta{}
+
+	find := samplesetMetaColl.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&samplesetMeta) {
+		samplesetNameList = append(samplesetNameList, samplesetMeta.Name)
+	}
+	return samplesetNameList
+}
+
+// InsertSamplesetDataWithCheck ...
+// Insert sample set data
+// but first check for existence (in the samplesetMetaColl)
+//---------------------------------------------------------------------
+func InsertSamplesetDataWithCheck(name string, desc string,
+	items []string) (bool, string) {
+	msg := ""
+	samplesetMetaColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetMetaCollection)
+
+	find := samplesetMetaColl.Find(bson.M{"name": name})
+
+	metaitems := find.Iter()
+	samplesetMeta := DBSamplesetMeta{}
+
+	if metaitems.Next(&samplesetMeta) != false {
+		return false, "Sample set already exists"
+	}
+	res := InsertSamplesetMetaData(name, desc)
+	if res != true {
+		msg = "Failed to insert sample set meta data"
+		return res, msg
+	}
+
+	res = InsertSamplesetData(name, items)
+	if res != true {
+		msg = "Failed to insert sample set data"
+	}
+	return res, msg
+}
+
+// InsertSamplesetMetaData ...
+// Insert sample set meta data from string arguments
+//---------------------------------------------------------------------
+func InsertSamplesetMetaData(name string, desc string) bool {
+	samplesetMetaColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetMetaCollection)
+	dbdata := bson.M{"name": name, "description": desc}
+
+	samplesetMetaColl.Insert(dbdata)
+
+	return true
+}
+
+// InsertSamplesetData ...
+// Insert sample set data from a list of sample ids
+//---------------------------------------------------------------------
+func InsertSamplesetData(name string, items []string) bool {
+
+	samplesetColl := session.DB(dbconf.Dbname).C(dbconf.SamplesetCollection)
+
+	for _, sampleID := range items {
+		dbdata := bson.M{"name": name, "sample_id": sampleID}
+		samplesetColl.Insert(dbdata)
+	}
+
+	return true
+}
+
 // ******* Grs input section ***********************************
 
 // GetGrsInputByName ...
@@ -461,10 +657,18 @@ func InsertGrsMetaData(name string, desc string) bool {
 // weight calculated in a previous study
 //---------------------------------------------------------------------
 func InsertGrsInputDataWithCheck(grsname string, grsdesc string, grsinputitems map[string][]string) (bool, string) {
+	return InsertGrsInputDataWithMeta(DBGrsMeta{Name: grsname, Description: grsdesc}, grsinputitems)
+}
+
+// InsertGrsInputDataWithMeta ...
+// As InsertGrsInputDataWithCheck, with source (e.g. a PGS Catalog id), trait
+// and genome build recorded in the grs meta data
+//---------------------------------------------------------------------
+func InsertGrsInputDataWithMeta(meta DBGrsMeta, grsinputitems map[string][]string) (bool, string) {
 	msg := ""
 	grsMetaColl := session.DB(dbconf.Dbname).C(dbconf.GrsMetaCollection)
 
-	find := grsMetaColl.Find(bson.M{"name": grsname})
+	find := grsMetaColl.Find(bson.M{"name": meta.Name})
 
 	items := find.Iter()
 	grsInput := DBGrsInput{}
@@ -473,13 +677,23 @@ func InsertGrsInputDataWithCheck(grsname string, grsdesc string, grsinputitems m
 		return false, "GRS input name already exists"
 	}
 
-	res := InsertGrsMetaData(grsname, grsdesc)
-	if res != true {
+	dbdata := bson.M{"name": meta.Name, "description": meta.Description}
+	if meta.Source != "" {
+		dbdata["source"] = meta.Source
+	}
+	if meta.Trait != "" {
+		dbdata["trait"] = meta.Trait
+	}
+	if meta.Build != "" {
+		dbdata["build"] = meta.Build
+	}
+	err := grsMetaColl.Insert(dbdata)
+	if err != nil {
 		msg = "Failed to insert grs meta data"
-		return res, msg
+		return false, msg
 	}
 
-	res = InsertGrsInputData(grsname, grsinputitems)
+	res := InsertGrsInputData(meta.Name, grsinputitems)
 	if res != true {
 		msg = "Failed to insert grs input data"
 	}
@@ -500,3 +714,277 @@ func InsertGrsInputData(name string, items map[string][]string) bool {
 
 	return true
 }
+
+// ******* Grs score section ***********************************
+//
+// Scores are stored by GRS name and run version. Each set of run parameters
+// (scoring mode, imputation, normalisation, threshold, sample set) for a
+// name has its own version, numbered from 1. Re-running with the parameters
+// of an existing version replaces that version's scores, other parameters
+// add a new version. Version 0 in the getters means the latest, the run
+// stored most recently (by date), which after a replacement can be a lower
+// version number than others stored for the name
+
+// grsScoreLock serialises score stores within a process, the unique
+// (name, version) index on the meta collection keeps versions distinct
+// between processes
+var grsScoreLock sync.Mutex
+
+// attempts to claim a new version number before giving up
+const grsVersionAttempts = 5
+
+// InsertGrsScores ...
+// Store scores for a GRS run (to 6 decimal places), returns the version and
+// whether an existing version was replaced. The run's date is set once its
+// scores are stored
+//---------------------------------------------------------------------
+func InsertGrsScores(name string, params string, scores []grs.SampleScore) (int, bool, error) {
+	grsScoreLock.Lock()
+	defer grsScoreLock.Unlock()
+
+	grsScoreMetaColl := session.DB(dbconf.Dbname).C(dbconf.GrsScoreMetaCollection)
+	grsScoreColl := session.DB(dbconf.Dbname).C(dbconf.GrsScoreCollection)
+
+	err := grsScoreMetaColl.EnsureIndex(mgo.Index{Key: []string{"name", "version"}, Unique: true})
+	if err != nil {
+		return 0, false, err
+	}
+	version := 0
+	replaced := false
+	for attempt := 1; ; attempt++ {
+		version, replaced = 0, false
+		for _, run := range GetGrsScoreRuns(name) {
+			if run.Params == params {
+				version = run.Version
+				replaced = true
+				break
+			}
+			if run.Version > version {
+				version = run.Version
+			}
+		}
+		if replaced {
+			break
+		}
+		// claim the next version, another process may have taken it
+		version++
+		dbdata := bson.M{"name": name, "version": version, "params": params, "count": 0}
+		err = grsScoreMetaColl.Insert(dbdata)
+		if err == nil {
+			break
+		}
+		if !mgo.IsDup(err) || attempt == grsVersionAttempts {
+			return 0, false, err
+		}
+	}
+	_, err = grsScoreColl.RemoveAll(bson.M{"name": name, "version": version})
+	if err != nil {
+		return version, replaced, err
+	}
+	docs := make([]interface{}, len(scores))
+	for i, score := range scores {
+		docs[i] = bson.M{"name": name, "version": version, "iid": score.SampleID, "snpcount": score.SNPCount,
+			"imputed": score.Imputed, "score": fmt.Sprintf("%.6f", score.Score)}
+	}
+	if len(docs) > 0 {
+		if err = grsScoreColl.Insert(docs...); err != nil {
+			return version, replaced, err
+		}
+	}
+	err = grsScoreMetaColl.Update(bson.M{"name": name, "version": version},
+		bson.M{"$set": bson.M{"params": params, "count": len(scores), "date": time.Now()}})
+	return version, replaced, err
+}
+
+// GetGrsScoreRuns ...
+// Get the stored runs for a GRS name, in version order
+//---------------------------------------------------------------------
+func GetGrsScoreRuns(name string) []DBGrsScoreMeta {
+	runList := make([]DBGrsScoreMeta, 0, 10)
+
+	grsScoreMetaColl := session.DB(dbconf.Dbname).C(dbconf.GrsScoreMetaCollection)
+
+	grsScoreMeta := DBGrsScoreMeta{}
+
+	find := grsScoreMetaColl.Find(bson.M{"name": name})
+
+	items := find.Iter()
+	for items.Next(&grsScoreMeta) {
+		runList = append(runList, grsScoreMeta)
+	}
+	sort.SliceStable(runList, func(i, j int) bool { return runList[i].Version < runList[j].Version })
+	return runList
+}
+
+// GetGrsScoreRun ...
+// Get a stored run by GRS name and version (0 for the most recently
+// stored), Version is 0 if not found
+//---------------------------------------------------------------------
+func GetGrsScoreRun(name string, version int) DBGrsScoreMeta {
+	latest := DBGrsScoreMeta{}
+	for _, run := range GetGrsScoreRuns(name) {
+		if run.Version == version {
+			return run
+		}
+		if !run.Date.Before(latest.Date) {
+			latest = run
+		}
+	}
+	if version == 0 {
+		return latest
+	}
+	return DBGrsScoreMeta{}
+}
+
+// GetGrsScoreNames ...
+// Get the GRS names with stored scores
+//---------------------------------------------------------------------
+func GetGrsScoreNames() []string {
+	var grsNameList = make([]string, 0, 10)
+	seen := make(map[string]bool)
+
+	grsScoreMetaColl := session.DB(dbconf.Dbname).C(dbconf.GrsScoreMetaCollection)
+
+	grsScoreMeta := DBGrsScoreMeta{}
+
+	find := grsScoreMetaColl.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&grsScoreMeta) {
+		if !seen[grsScoreMeta.Name] {
+			seen[grsScoreMeta.Name] = true
+			grsNameList = append(grsNameList, grsScoreMeta.Name)
+		}
+	}
+	sort.Strings(grsNameList)
+	return grsNameList
+}
+
+// GetGrsScoreRecords ...
+// Get stored scores for a GRS name and version (0 for the latest)
+//---------------------------------------------------------------------
+func GetGrsScoreRecords(name string, version int) []DBGrsScore {
+	scoreList := make([]DBGrsScore, 0, 1000)
+
+	run := GetGrsScoreRun(name, version)
+	if run.Version == 0 {
+		return scoreList
+	}
+
+	grsScoreColl := session.DB(dbconf.Dbname).C(dbconf.GrsScoreCollection)
+
+	grsScore := DBGrsScore{}
+
+	find := grsScoreColl.Find(bson.M{"name": name, "version": run.Version}).Sort("iid")
+
+	items := find.Iter()
+	for items.Next(&grsScore) {
+		scoreList = append(scoreList, grsScore)
+	}
+	return scoreList
+}
+
+// GetGrsScoresByName ...
+// Get stored scores for a GRS name and version (0 for the latest) as iid
+// to score, in the form returned by GetPhenoByName
+//---------------------------------------------------------------------
+func GetGrsScoresByName(name string, version int) (map[string]string, int) {
+	scoreIDValue := make(map[string]string)
+
+	count := 0
+	for _, score := range GetGrsScoreRecords(name, version) {
+		scoreIDValue[score.IID] = score.Score
+		count++
+	}
+	return scoreIDValue, count
+}
+
+// ******* Covariate section ***********************************
+
+// GetCovarMetaByName ...
+// Get the meta data (columns and types) for a covariate set
+//---------------------------------------------------------------------
+func GetCovarMetaByName(name string) DBCovarMeta {
+	covarMetaColl := session.DB(dbconf.Dbname).C(dbconf.CovarMetaCollection)
+
+	covarMeta := DBCovarMeta{}
+
+	find := covarMetaColl.Find(bson.M{"name": name})
+
+	items := find.Iter()
+	items.Next(&covarMeta)
+	return covarMeta
+}
+
+// GetCovarMetaNames ...
+// Get all covariate set names
+//---------------------------------------------------------------------
+func GetCovarMetaNames() []string {
+	var covarNameList = make([]string, 0, 10)
+
+	covarMetaColl := session.DB(dbconf.Dbname).C(dbconf.CovarMetaCollection)
+
+	covarMeta := DBCovarMeta{}
+
+	find := covarMetaColl.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&covarMeta) {
+		covarNameList = append(covarNameList, covarMeta.Name)
+	}
+	return covarNameList
+}
+
+// GetCovarByName ...
+// Get covariate values for a set as iid to values (in column order)
+//---------------------------------------------------------------------
+func GetCovarByName(name string) (map[string][]string, int) {
+	covarIDValues := make(map[string][]string)
+
+	covarColl := session.DB(dbconf.Dbname).C(dbconf.CovarCollection)
+
+	covar := DBCovar{}
+
+	find := covarColl.Find(bson.M{"name": name})
+
+	items := find.Iter()
+	count := 0
+	for items.Next(&covar) {
+		covarIDValues[covar.IId] = covar.Values
+		count++
+	}
+	return covarIDValues, count
+}
+
+// InsertCovarDataWithCheck ...
+// Insert covariate data (iid to values) and the covariate meta record,
+// but first check for existence (in the covarMetaColl)
+//---------------------------------------------------------------------
+func InsertCovarDataWithCheck(meta DBCovarMeta, covaritems map[string][]string) (bool, string) {
+	covarMetaColl := session.DB(dbconf.Dbname).C(dbconf.CovarMetaCollection)
+
+	find := covarMetaColl.Find(bson.M{"name": meta.Name})
+
+	items := find.Iter()
+	covarMeta := DBCovarMeta{}
+
+	if items.Next(&covarMeta) != false {
+		return false, "Covariate set already exists"
+	}
+
+	dbdata := bson.M{"name": meta.Name, "source": meta.Source, "description": meta.Description, "columns": meta.Columns,
+		"types": meta.Types, "count": len(covaritems)}
+	err := covarMetaColl.Insert(dbdata)
+	if err != nil {
+		return false, "Failed to insert covariate meta data"
+	}
+
+	covarColl := session.DB(dbconf.Dbname).C(dbconf.CovarCollection)
+	for iid, values := range covaritems {
+		err = covarColl.Insert(bson.M{"name": meta.Name, "iid": iid, "values": values})
+		if err != nil {
+			return false, "Failed to insert covariate data"
+		}
+	}
+	return true, ""
+}
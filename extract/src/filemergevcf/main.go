@@ -9,10 +9,14 @@
 //
 // args:
 //  --tpltfile: a text file of template file paths for files to be merged
-//  --paramfile: file of parameters for genotype resolution
+//  --paramfile: file of parameters for genotype resolution, KEY=value lines:
+//      TESTNUM (positions to process, 0 = all), CALLRATE, INFOSCORE,
+//      MAFDELTA, MAFACTION (flag or exclude)
 //  --chr: chromosome
 //  --logfile: full filepath for logging
 //  --vcfprfx: directory root for vcf files
+//  --qcfile: QC sidecar file, one line per QC gate decision, written when
+//      given or when a QC gate is set (./data/filemergevcf_qc.tsv)
 //
 //  Author: P Appleby, University of Dundee
 //--------------------------------------------------------------------------------------
@@ -46,10 +50,20 @@ var emptyRecord = []string{}
 var tpltFilePath string
 var paramFilePath string
 var logFilePath string
+var metricsFilePath string
+var qcFilePath string
+var exclFilePath string
+var aliasFilePath string
+var concordFilePath string
 var vcfPathPref string
 var chr string
 var threshold float64
 var errpctthr float64
+var runParams genometrics.RunParameters
+var qcWriter *bufio.Writer
+
+// QC sidecar file used when a QC gate is set but no -qcfile given
+const gatedQcFilePath = "./data/filemergevcf_qc.tsv"
 
 //-----------------------------------------------
 // main package routines
@@ -70,6 +84,16 @@ func init() {
 		thrusage             = "Prob threshold"
 		defaultChr           = "22"
 		chrusage             = "default chromosome (number as string)"
+		defaultMetricsPath   = ""
+		musage               = "Metrics report file (.json for JSON, otherwise TSV)"
+		defaultQcFilePath    = ""
+		qcusage              = "QC sidecar file (" + gatedQcFilePath + " if not given and a QC gate is set)"
+		defaultExclFilePath  = ""
+		xusage               = "Sample exclusion file (sample id [assaytype] per line)"
+		defaultAliasFilePath = ""
+		ausage               = "Sample alias file (assaytype,sample_id,subject_id per line)"
+		defaultConcordPath   = ""
+		kusage               = "Per-sample, per-assay-pair concordance matrix file (TSV)"
 	)
 	flag.StringVar(&tpltFilePath, "tpltfile", defaultTpltFilePath, tusage)
 	flag.StringVar(&tpltFilePath, "t", defaultTpltFilePath, tusage+" (shorthand)")
@@ -85,6 +109,16 @@ func init() {
 	flag.Float64Var(&errpctthr, "e", defaultErrPct, epctusage+" (shorthand)")
 	flag.StringVar(&chr, "chr", defaultChr, chrusage)
 	flag.StringVar(&chr, "c", defaultChr, chrusage+" (shorthand)")
+	flag.StringVar(&metricsFilePath, "metricsfile", defaultMetricsPath, musage)
+	flag.StringVar(&metricsFilePath, "m", defaultMetricsPath, musage+" (shorthand)")
+	flag.StringVar(&qcFilePath, "qcfile", defaultQcFilePath, qcusage)
+	flag.StringVar(&qcFilePath, "q", defaultQcFilePath, qcusage+" (shorthand)")
+	flag.StringVar(&exclFilePath, "exclfile", defaultExclFilePath, xusage)
+	flag.StringVar(&exclFilePath, "x", defaultExclFilePath, xusage+" (shorthand)")
+	flag.StringVar(&aliasFilePath, "aliasfile", defaultAliasFilePath, ausage)
+	flag.StringVar(&aliasFilePath, "a", defaultAliasFilePath, ausage+" (shorthand)")
+	flag.StringVar(&concordFilePath, "concordfile", defaultConcordPath, kusage)
+	flag.StringVar(&concordFilePath, "k", defaultConcordPath, kusage+" (shorthand)")
 	flag.Parse()
 }
 
@@ -132,6 +166,7 @@ func main() {
 	testnum := ""
 	callrate := ""
 	mafdelta := ""
+	mafaction := ""
 	infoscore := ""
 	scanner = bufio.NewScanner(fp)
 	for scanner.Scan() {
@@ -147,14 +182,30 @@ func main() {
 			if fields[0] == "MAFDELTA" {
 				mafdelta = fields[1]
 			}
+			if fields[0] == "MAFACTION" {
+				mafaction = fields[1]
+			}
 			if fields[0] == "INFOSCORE" {
 				infoscore = fields[1]
 			}
 		}
 	}
-	runParams := genometrics.GetRunParams(testnum, mafdelta, callrate, infoscore)
+	runParams = genometrics.GetRunParams(testnum, mafdelta, mafaction, callrate, infoscore)
 	log.Printf("Params: %v\n", runParams)
 
+	// QC sidecar, records every gate decision
+	if qcFilePath == "" && runParams.GatesSet() {
+		qcFilePath = gatedQcFilePath
+	}
+	if qcFilePath != "" {
+		fq, err := os.Create(qcFilePath)
+		check(err)
+		defer fq.Close()
+		qcWriter = bufio.NewWriter(fq)
+		defer qcWriter.Flush()
+		fmt.Fprintf(qcWriter, "%s\n", genometrics.QCHeader)
+	}
+
 	for key, value := range assaytypeFilename {
 		fh, err := os.Open(value)
 		check(err)
@@ -175,11 +226,29 @@ func main() {
 	}
 	// Headers and combined header map
 	sampleNameMap, samplePosnMap := sample.MakeSamplesByAssaytype(headers)
+	// exclusions match per-panel sample ids as well as canonical subject ids
+	var excluded map[string]map[string]bool
+	exclCount := 0
+	if exclFilePath != "" {
+		excluded = readExclusionFile(exclFilePath)
+		exclCount = sample.ExcludeSamples(sampleNameMap, samplePosnMap, excluded)
+	}
+	if aliasFilePath != "" {
+		aliases, err := sample.ReadAliasFile(aliasFilePath)
+		check(err)
+		aliasCount := sample.ApplyAliases(sampleNameMap, samplePosnMap, aliases)
+		log.Printf("Sample alias file %s, %d samples renamed\n", aliasFilePath, aliasCount)
+	}
+	if exclFilePath != "" {
+		exclCount += sample.ExcludeSamples(sampleNameMap, samplePosnMap, excluded)
+		log.Printf("Sample exclusion file %s, %d sample columns dropped\n", exclFilePath, exclCount)
+	}
 	combocols := sample.GetCombinedSampleMap(sampleNameMap)
 	// combocols := sample.GetCombinedSampleMapByAssaytypes(sampleNameMap, assaytypeList)
 	colhdrStr, comboNames := vcfmerge.GetCombinedColumnHeaders(combocols)
 	//fmt.Printf("%s\n", "combined"+"\t"+colhdrStr)
 	printHeaders()
+	fmt.Printf("##godbExcludedSamples=%d\n", exclCount)
 	fmt.Printf("%s\n", colhdrStr)
 
 	// read first records and capture keys (genomic positions)
@@ -190,14 +259,31 @@ func main() {
 		records[assaytype], keys[assaytype], varids[assaytype] = getNextRecordSlice(rdr)
 	}
 	var genomet genometrics.AllMetrics
+	var report *genometrics.MetricsReport
+	if metricsFilePath != "" {
+		report = genometrics.NewMetricsReport()
+	}
+	if concordFilePath != "" {
+		genomet.Tally = genometrics.NewConcordanceTally()
+	}
 	outctr := 0
 	// process until all files exhausted
 	for recordsRemain(keys) {
-		outputFromLowKeyRecords(records, keys, samplePosnMap, combocols, comboNames, threshold, &genomet)
+		if runParams.TestNum > 0 && outctr >= runParams.TestNum {
+			log.Printf("TESTNUM reached, stop after %d positions\n", outctr)
+			break
+		}
+		outputFromLowKeyRecords(records, keys, samplePosnMap, combocols, comboNames, threshold, &genomet, report)
 		outctr++
 		records, keys, varids = readFromLowKeyRecords(records, keys, freaders, varids)
 	}
-	errorPct := (float64(genomet.MismatchCount) / float64(genomet.OverlapTestCount)) * 100
+	if report != nil {
+		check(report.WriteFile(metricsFilePath))
+	}
+	if genomet.Tally != nil {
+		check(genomet.Tally.WriteFile(concordFilePath))
+	}
+	errorPct := genometrics.ErrPct(&genomet)
 	log.Printf("EXIT,wrt=%d,AllGenos=%d,UniqueGenos=%d,Alloverlap=%d,Two=%d,GTTwo=%d\n",
 		outctr, genomet.AllGenoCount, genomet.UniqueGenoCount, genomet.OverlapTestCount,
 		genomet.TwoOverlapCount, genomet.GtTwoOverlapCount)
@@ -265,7 +351,8 @@ func recordsRemain(keys map[string]int64) bool {
 //-------------------------------------------------------------
 func outputFromLowKeyRecords(records map[string][]string, keys map[string]int64,
 	samplePosnMap map[string]map[int]string,
-	combocols map[string]int, comboNames []string, threshold float64, genomet *genometrics.AllMetrics) {
+	combocols map[string]int, comboNames []string, threshold float64, genomet *genometrics.AllMetrics,
+	report *genometrics.MetricsReport) {
 	//
 	lowKeys := getLowKeys(keys)
 	lowKeyAt := make([]string, 0)
@@ -285,18 +372,40 @@ func outputFromLowKeyRecords(records map[string][]string, keys map[string]int64,
 		vcfrecords = append(vcfrecords, rec)
 		//fmt.Printf("LOWKEY OUTPUT %s, %d\n", at, key)
 	}
+	vcfrecords, decisions := genometrics.ApplyQCGates(vcfrecords, runParams, threshold)
+	writeQCDecisions(decisions)
+	if len(vcfrecords) == 0 {
+		return
+	}
 	var vcfd []vcfmerge.Vcfdata
 	var rsidGenomet genometrics.AllMetrics
+	rsidGenomet.Collectors = genomet.Collectors
 	recStr := vcfmerge.CombineOne(vcfrecords, vcfd, rsid, samplePosnMap, combocols, comboNames, threshold, &rsidGenomet)
 	genometrics.Increment(genomet, &rsidGenomet)
-	errorPct := 0.0
-	if rsidGenomet.MismatchCount > 0 {
-		errorPct = (float64(rsidGenomet.MismatchCount) / float64(rsidGenomet.OverlapTestCount)) * 100
-	}
+	errorPct := genometrics.ErrPct(&rsidGenomet)
 	if errorPct < errpctthr {
 		fmt.Printf("%s\n", recStr)
+		if report != nil {
+			vm := genometrics.MetricsForRecord(strings.Split(recStr, "\t"), threshold)
+			vm.Assaytype = "combined"
+			report.Add(vm, &rsidGenomet)
+		}
 	} else {
 		genometrics.LogMetrics(1, rsid, 1, "##ERRPCT", &rsidGenomet)
+		writeQCDecisions([]genometrics.QCDecision{genometrics.NewQCDecision(vcfrecords[0][1:], "all",
+			genometrics.QCDrop, "errpct", errorPct, errpctthr)})
+	}
+}
+
+//-------------------------------------------------------------
+// Write QC gate decisions to the sidecar file, if there is one
+//-------------------------------------------------------------
+func writeQCDecisions(decisions []genometrics.QCDecision) {
+	if qcWriter == nil {
+		return
+	}
+	for _, decision := range decisions {
+		fmt.Fprintf(qcWriter, "%s\n", decision.TSV())
 	}
 }
 
@@ -340,3 +449,28 @@ func printHeaders() {
 	fmt.Printf("%s\n", "##FORMAT=<ID=AT,Number=1,Type=String,Description=\"Assay Type\">")
 	fmt.Printf("%s\n", "##INFO=<ID=TYPED,Number=0,Type=Flag,Description=\"Typed in input data\">")
 }
+
+//-------------------------------------------------------------
+// Read a sample exclusion file, sample id and optional
+// assaytype per line (tab or space separated)
+//-------------------------------------------------------------
+func readExclusionFile(path string) map[string]map[string]bool {
+	excluded := make(map[string]map[string]bool)
+	f, err := os.Open(path)
+	check(err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 1 {
+			sample.AddExclusion(excluded, fields[0], fields[1])
+		} else {
+			sample.AddExclusion(excluded, fields[0], sample.AllAssaytypes)
+		}
+	}
+	check(scanner.Err())
+	return excluded
+}
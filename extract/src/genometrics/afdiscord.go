@@ -0,0 +1,141 @@
+package genometrics
+
+//
+// Cross-panel allele frequency discordance: the same SNP typed / imputed on
+// more than one assaytype should have similar allele frequencies, large
+// differences usually mean strand or allele coding errors
+//
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// AFDiscordanceHeader ...
+// column headers for a discordance report
+const AFDiscordanceHeader = "rank\tvarid\tchr\tposn\tref\talt\tpalindromic\trefpanelaf\tmaxdelta\tmaxrefdelta\tsuspectflip\tflips\tpanelafs"
+
+// PanelAF ...
+// alt allele frequency for a single assaytype
+type PanelAF struct {
+	Assaytype  string
+	AltAF      float64
+	N          int
+	RefPanelAF float64
+	RefDelta   float64
+	Flip       bool
+}
+
+// AFDiscordance ...
+// allele frequency comparison for one variant across assaytypes
+type AFDiscordance struct {
+	Varid       string
+	Chrom       string
+	Posn        string
+	AlleleA     string
+	AlleleB     string
+	Palindromic bool
+	RefPanelAF  float64
+	Panels      []PanelAF
+	MaxDelta    float64
+	MaxRefDelta float64
+	SuspectFlip bool
+	Flips       []string
+}
+
+// CompareAlleleFreqs ...
+// vcfset is a set of records for the same variant, each with the assaytype in
+// slot 0. Alt allele frequencies are compared pairwise and with RefPanelAF
+// (each record's own, or the first found where a record has none).
+// A flip is suspected where a difference exceeds flipDelta and the frequency
+// is closer to 1 - the other frequency: with a reference the panel itself is
+// named, without one the pair "at1|at2" is
+func CompareAlleleFreqs(vcfset [][]string, threshold float64, flipDelta float64) AFDiscordance {
+	var afd AFDiscordance
+
+	afd.Panels = make([]PanelAF, 0, len(vcfset))
+	afd.Flips = make([]string, 0)
+	if len(vcfset) == 0 {
+		return afd
+	}
+	prfx, _ := variant.GetVCFPrfxSfx(vcfset[0][1:])
+	afd.Varid = variant.GetVarid(prfx)
+	afd.Chrom = variant.GetChrom(prfx)
+	afd.Posn = variant.GetPosnStr(prfx)
+	afd.AlleleA, afd.AlleleB = variant.GetAlleles(prfx)
+	afd.Palindromic = variant.IsPalindromic(afd.AlleleA, afd.AlleleB)
+
+	for _, rec := range vcfset {
+		// no called genotypes (MetricsForRecord leaves the frequencies NaN)
+		vm := MetricsForRecord(rec[1:], threshold)
+		if vm.N == 0 {
+			continue
+		}
+		afd.Panels = append(afd.Panels, PanelAF{Assaytype: rec[0], AltAF: vm.AltAF, N: vm.N, RefPanelAF: vm.RefPanelAF})
+		if afd.RefPanelAF == 0.0 {
+			afd.RefPanelAF = vm.RefPanelAF
+		}
+	}
+
+	for i := range afd.Panels {
+		panel := &afd.Panels[i]
+		refAF := panel.RefPanelAF
+		if refAF == 0.0 {
+			refAF = afd.RefPanelAF
+		}
+		if refAF == 0.0 {
+			continue
+		}
+		panel.RefDelta = math.Abs(panel.AltAF - refAF)
+		if panel.RefDelta > afd.MaxRefDelta {
+			afd.MaxRefDelta = panel.RefDelta
+		}
+		if panel.RefDelta > flipDelta && math.Abs(panel.AltAF-(1.0-refAF)) < panel.RefDelta {
+			panel.Flip = true
+			afd.SuspectFlip = true
+			afd.Flips = append(afd.Flips, panel.Assaytype)
+		}
+	}
+
+	for i := 0; i < len(afd.Panels); i++ {
+		for j := i + 1; j < len(afd.Panels); j++ {
+			delta := math.Abs(afd.Panels[i].AltAF - afd.Panels[j].AltAF)
+			if delta > afd.MaxDelta {
+				afd.MaxDelta = delta
+			}
+			if afd.RefPanelAF == 0.0 && delta > flipDelta &&
+				math.Abs(afd.Panels[i].AltAF-(1.0-afd.Panels[j].AltAF)) < delta {
+				afd.SuspectFlip = true
+				afd.Flips = append(afd.Flips, afd.Panels[i].Assaytype+"|"+afd.Panels[j].Assaytype)
+			}
+		}
+	}
+	return afd
+}
+
+// RankAFDiscordance ...
+// sort, most discordant first, on the larger of the panel and reference deltas
+func RankAFDiscordance(entries []AFDiscordance) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return math.Max(entries[i].MaxDelta, entries[i].MaxRefDelta) >
+			math.Max(entries[j].MaxDelta, entries[j].MaxRefDelta)
+	})
+}
+
+// TSV ...
+// a ranked entry as a report line
+func (afd AFDiscordance) TSV(rank int) string {
+	panelAFs := make([]string, 0, len(afd.Panels))
+	for _, panel := range afd.Panels {
+		panelAFs = append(panelAFs, fmt.Sprintf("%s=%.4f", panel.Assaytype, panel.AltAF))
+	}
+	flips := "."
+	if len(afd.Flips) > 0 {
+		flips = strings.Join(afd.Flips, ",")
+	}
+	return fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s\t%t\t%.4f\t%.4f\t%.4f\t%t\t%s\t%s",
+		rank, afd.Varid, afd.Chrom, afd.Posn, afd.AlleleA, afd.AlleleB, afd.Palindromic,
+		afd.RefPanelAF, afd.MaxDelta, afd.MaxRefDelta, afd.SuspectFlip, flips, strings.Join(panelAFs, ","))
+}
@@ -0,0 +1,191 @@
+package genometrics
+
+//
+// Per-sample, per-assay-pair genotype concordance: where a sample has called
+// genotypes from two assaytypes for the same variant the pair is tallied as
+// concordant or discordant. Collected by vcfmerge.Combine when
+// AllMetrics.Tally is set, so discordance can be traced to particular
+// samples or panel pairs rather than only the global MismatchCount
+//
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PairTally ...
+// genotype comparisons for one assay pair
+type PairTally struct {
+	Compared   int
+	Discordant int
+}
+
+// Concordance ...
+// fraction of compared genotypes that agree, 0 when nothing was compared
+func (pt PairTally) Concordance() float64 {
+	if pt.Compared == 0 {
+		return 0.0
+	}
+	return 1.0 - float64(pt.Discordant)/float64(pt.Compared)
+}
+
+// ConcordanceTally ...
+// sample id to assay pair ("at1|at2", sorted) to tally
+type ConcordanceTally struct {
+	Samples map[string]map[string]*PairTally
+	Pairs   map[string]bool
+}
+
+// PairSummary ...
+// one assay pair summed over samples
+type PairSummary struct {
+	Pair             string
+	Samples          int
+	Compared         int
+	Discordant       int
+	Concordance      float64
+	DiscordSamples   int
+	WorstSample      string
+	WorstConcordance float64
+}
+
+// NewConcordanceTally ...
+func NewConcordanceTally() *ConcordanceTally {
+	return &ConcordanceTally{Samples: make(map[string]map[string]*PairTally), Pairs: make(map[string]bool)}
+}
+
+// AssayPairKey ...
+// order independent key for two assaytypes
+func AssayPairKey(at1 string, at2 string) string {
+	if at2 < at1 {
+		at1, at2 = at2, at1
+	}
+	return at1 + "|" + at2
+}
+
+// Add ...
+// tally one comparison of genotypes for sampleID from two assaytypes
+func (ct *ConcordanceTally) Add(sampleID string, at1 string, at2 string, concordant bool) {
+	key := AssayPairKey(at1, at2)
+	ct.Pairs[key] = true
+	if _, ok := ct.Samples[sampleID]; !ok {
+		ct.Samples[sampleID] = make(map[string]*PairTally)
+	}
+	pt, ok := ct.Samples[sampleID][key]
+	if !ok {
+		pt = &PairTally{}
+		ct.Samples[sampleID][key] = pt
+	}
+	pt.Compared++
+	if !concordant {
+		pt.Discordant++
+	}
+}
+
+// PairKeys ...
+// assay pairs seen, sorted
+func (ct *ConcordanceTally) PairKeys() []string {
+	keys := make([]string, 0, len(ct.Pairs))
+	for key := range ct.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SampleIDs ...
+// samples with at least one comparison, sorted
+func (ct *ConcordanceTally) SampleIDs() []string {
+	ids := make([]string, 0, len(ct.Samples))
+	for id := range ct.Samples {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Summary ...
+// totals per assay pair, with the number of samples having any discordance
+// and the least concordant sample
+func (ct *ConcordanceTally) Summary() []PairSummary {
+	summary := make([]PairSummary, 0, len(ct.Pairs))
+	for _, key := range ct.PairKeys() {
+		ps := PairSummary{Pair: key, WorstConcordance: 1.0}
+		for _, id := range ct.SampleIDs() {
+			pt, ok := ct.Samples[id][key]
+			if !ok {
+				continue
+			}
+			ps.Samples++
+			ps.Compared += pt.Compared
+			ps.Discordant += pt.Discordant
+			if pt.Discordant > 0 {
+				ps.DiscordSamples++
+			}
+			if ps.WorstSample == "" || pt.Concordance() < ps.WorstConcordance {
+				ps.WorstConcordance = pt.Concordance()
+				ps.WorstSample = id
+			}
+		}
+		ps.Concordance = PairTally{Compared: ps.Compared, Discordant: ps.Discordant}.Concordance()
+		summary = append(summary, ps)
+	}
+	return summary
+}
+
+// WriteTSV ...
+// the sample x assay pair matrix, for each pair the compared count,
+// discordant count and concordance ("." where not compared)
+func (ct *ConcordanceTally) WriteTSV(w io.Writer) error {
+	keys := ct.PairKeys()
+	hdr := make([]string, 0, 1+3*len(keys))
+	hdr = append(hdr, "sample")
+	for _, key := range keys {
+		hdr = append(hdr, key+":n", key+":discord", key+":conc")
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", strings.Join(hdr, "\t")); err != nil {
+		return err
+	}
+	for _, id := range ct.SampleIDs() {
+		cols := make([]string, 0, len(hdr))
+		cols = append(cols, id)
+		for _, key := range keys {
+			if pt, ok := ct.Samples[id][key]; ok {
+				cols = append(cols, fmt.Sprintf("%d", pt.Compared), fmt.Sprintf("%d", pt.Discordant),
+					fmt.Sprintf("%.6f", pt.Concordance()))
+			} else {
+				cols = append(cols, ".", ".", ".")
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", strings.Join(cols, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TSVLines ...
+// WriteTSV output as a list of lines
+func (ct *ConcordanceTally) TSVLines() []string {
+	var sb strings.Builder
+	ct.WriteTSV(&sb)
+	return strings.Split(strings.TrimRight(sb.String(), "\n"), "\n")
+}
+
+// WriteFile ...
+// write the TSV matrix to path
+func (ct *ConcordanceTally) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := ct.WriteTSV(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -3,35 +3,70 @@ package genometrics
 //
 // Calculate selected metrics for a VCF record-as-slice
 // These include HWEP, CR, MAF
-// Note that the use of runParameters is not implemented as yet (TODO)
+// runParameters are applied as QC gates by ApplyQCGates (qc.go)
 //
 //
 import (
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"variant"
 )
 
+// AllMetrics ...
+// counters accumulated while combining records across assaytypes
 type AllMetrics struct {
-	AllGenoCount      int
-	UniqueGenoCount   int
-	OverlapTestCount  int
-	OverlapSampCount  int
-	TwoOverlapCount   int
-	GtTwoOverlapCount int
-	MismatchCount     int
-	DiffProbDiffs     int
-	SameProbDiffs     int
-	MissTestCount     int
-	MissingCount      int
-	NoAssayCount      int
+	AllGenoCount      int `json:"allgenos"`
+	UniqueGenoCount   int `json:"uniquegenos"`
+	OverlapTestCount  int `json:"alloverlap"`
+	OverlapSampCount  int `json:"overlapsamples"`
+	TwoOverlapCount   int `json:"two"`
+	GtTwoOverlapCount int `json:"gttwo"`
+	MismatchCount     int `json:"overlapgenodiffs"`
+	DiffProbDiffs     int `json:"diffprobdiffs"`
+	SameProbDiffs     int `json:"sameprobdiffs"`
+	MissTestCount     int `json:"missinggenotested"`
+	MissingCount      int `json:"missingunresolved"`
+	NoAssayCount      int `json:"noassay"`
+	Collectors        `json:"-"`
+}
+
+// Collectors ...
+// optional detail collected by vcfmerge while combining, when set:
+// per-sample, per-assay-pair concordance and the genotype provenance audit
+type Collectors struct {
+	Tally *ConcordanceTally
+	Audit *ProvenanceAudit
+}
+
+// VariantMetrics ...
+// SNP metrics for a single VCF record
+type VariantMetrics struct {
+	Varid      string  `json:"varid"`
+	Assaytype  string  `json:"assaytype"`
+	CallRate   float64 `json:"callrate"`
+	RefAF      float64 `json:"refaf"`
+	AltAF      float64 `json:"altaf"`
+	MAF        float64 `json:"maf"`
+	HWEP       float64 `json:"hwep"`
+	HetCount   int     `json:"het"`
+	HomCommon  int     `json:"homcommon"`
+	HomRare    int     `json:"homrare"`
+	N          int     `json:"n"`
+	Missing    int     `json:"missing"`
+	Dot        int     `json:"dot"`
+	RefPanelAF float64 `json:"refpanelaf"`
 }
 
 // RunParameters ...
+// TestNum limits the number of positions processed (0 = all, for test runs),
+// MafDelta is the largest MAF difference allowed across panels, MafAction
+// says whether records over it are flagged or excluded
 type RunParameters struct {
 	TestNum   int
 	MafDelta  float64
+	MafAction string
 	CallRate  float64
 	InfoScore float64
 }
@@ -50,15 +85,23 @@ func Increment(tgt *AllMetrics, src *AllMetrics) {
 	(*tgt).DiffProbDiffs += (*src).DiffProbDiffs
 	(*tgt).SameProbDiffs += (*src).SameProbDiffs
 	(*tgt).MissTestCount += (*src).MissTestCount
-	(*tgt).MissTestCount += (*src).MissTestCount
 	(*tgt).MissingCount += (*src).MissingCount
 	(*tgt).NoAssayCount += (*src).NoAssayCount
 }
 
+// ErrPct ...
+// overlap genotype mismatches as a percentage of overlap tests
+func ErrPct(genomet *AllMetrics) float64 {
+	if (*genomet).OverlapTestCount == 0 {
+		return 0.0
+	}
+	return (float64((*genomet).MismatchCount) / float64((*genomet).OverlapTestCount)) * 100
+}
+
 // LogMetrics ...
 // log metrics output, detail depends on level
 func LogMetrics(logLevel int, varid string, snpcount int, msg string, genomet *AllMetrics) {
-	errorPct := (float64((*genomet).MismatchCount) / float64((*genomet).OverlapTestCount)) * 100
+	errorPct := ErrPct(genomet)
 	if logLevel > 0 {
 		log.Printf("%s,%s,SNPCount=%d\n", msg, varid, snpcount)
 		log.Printf("%s,%s,ErrPct=%.3f\n", msg, varid, errorPct)
@@ -88,34 +131,56 @@ func HweExactForRecord(rec []string, threshold float64) float64 {
 }
 
 // MetricsForRecord ...
-// return all SNP metrics
-// CR, RAF, AAF, MAF, HWE_P
-func MetricsForRecord(rec []string, threshold float64) (float64, float64,
-	float64, float64, float64, int, int, int, int, int, int, float64) {
+// return all SNP metrics for a VCF record (no assaytype prefix)
+// CR, RAF, AAF, MAF, HWE_P plus the genotype counts behind them,
+// Assaytype is left for the caller to fill in. With no called genotypes
+// (N == 0) the call rate is 0, allele frequencies NaN and HWE_P 1
+func MetricsForRecord(rec []string, threshold float64) VariantMetrics {
+	var vm VariantMetrics
+
 	homref, homalt, het, alln, miss, dot, refPAF := getGenotypeCounts(rec, threshold)
 	n := alln - miss
-	cr := float64(homref+het+homalt) / float64(alln)
-	raf := float64(2*homref+het) / float64(2*n)
-	aaf := float64(2*homalt+het) / float64(2*n)
-	maf := aaf
-	if raf < aaf {
-		maf = raf
-	}
-	obsHomc := homref
-	obsHomr := homalt
+	vm.Varid = variant.GetVarid(rec)
+	if alln > 0 {
+		vm.CallRate = float64(homref+het+homalt) / float64(alln)
+	}
+	vm.RefAF, vm.AltAF, vm.MAF = math.NaN(), math.NaN(), math.NaN()
+	if n > 0 {
+		vm.RefAF = float64(2*homref+het) / float64(2*n)
+		vm.AltAF = float64(2*homalt+het) / float64(2*n)
+		vm.MAF = vm.AltAF
+		if vm.RefAF < vm.AltAF {
+			vm.MAF = vm.RefAF
+		}
+	}
+	vm.HomCommon = homref
+	vm.HomRare = homalt
 	if homalt > homref {
-		obsHomc = homalt
-		obsHomr = homref
+		vm.HomCommon = homalt
+		vm.HomRare = homref
 	}
-	return cr, raf, aaf, maf, SNPHWE(het, homref, homalt), het, obsHomc, obsHomr, n, miss, dot, refPAF
+	vm.HWEP = SNPHWE(het, homref, homalt)
+	vm.HetCount = het
+	vm.N = n
+	vm.Missing = miss
+	vm.Dot = dot
+	vm.RefPanelAF = refPAF
+	return vm
+}
+
+// GatesSet ...
+// true if any QC gate (CallRate, InfoScore, MafDelta) is switched on
+func (runParams RunParameters) GatesSet() bool {
+	return runParams.CallRate > 0.0 || runParams.InfoScore > 0.0 || runParams.MafDelta > 0.0
 }
 
 // GetRunParams ...
-func GetRunParams(testnum string, mafdelta string, callrate string, infoscore string) RunParameters {
+func GetRunParams(testnum string, mafdelta string, mafaction string, callrate string, infoscore string) RunParameters {
 	var runParams RunParameters
 
 	runParams.TestNum = 0
 	runParams.MafDelta = 0.0
+	runParams.MafAction = QCFlag
 	runParams.CallRate = 0.0
 	runParams.InfoScore = 0.0
 
@@ -125,6 +190,9 @@ func GetRunParams(testnum string, mafdelta string, callrate string, infoscore st
 	if mafdelta != "" {
 		runParams.MafDelta, _ = strconv.ParseFloat(mafdelta, 32)
 	}
+	if mafaction == QCExclude {
+		runParams.MafAction = QCExclude
+	}
 	if callrate != "" {
 		runParams.CallRate, _ = strconv.ParseFloat(callrate, 32)
 	}
@@ -156,6 +224,10 @@ func SNPHWE(obsHets int, obsHom1 int, obsHom2 int) float64 {
 
 	rareCopies := 2*obsHomr + obsHets
 	genotypes := obsHets + obsHomc + obsHomr
+	// no genotypes, nothing to test
+	if genotypes == 0 {
+		return 1.0
+	}
 
 	hetProbs := make([]float64, rareCopies+1, rareCopies+1)
 
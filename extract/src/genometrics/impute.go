@@ -0,0 +1,83 @@
+package genometrics
+
+//
+// Imputation quality estimated from genotype probabilities (GP), or dosages
+// (DS) where GP is absent. Works on assay records and on combined records.
+//
+// With d = P(het) + 2P(homalt), f = P(het) + 4P(homalt) per sample and
+// theta = mean(d) / 2:
+//   MaCH Rsq     var(d) / 2theta(1-theta)
+//   IMPUTE INFO  1 - sum(f - d^2) / 2N.theta(1-theta)
+//   Dosage r2    var(d) / (mean(f) - mean(d)^2), the squared correlation
+//                between the dosage and the (expected) true genotype
+//
+import (
+	"variant"
+)
+
+// ImputeQuality ...
+type ImputeQuality struct {
+	MachRsq    float64 `json:"machrsq"`
+	ImputeInfo float64 `json:"imputeinfo"`
+	DosageR2   float64 `json:"dosager2"`
+	N          int     `json:"n"`
+}
+
+// ImputeQualityForRecord ...
+// caller passes a string array representing a whole VCF
+// record, including prefix.
+// Where the estimated allele frequency is 0 or 1 there is nothing to impute,
+// all three measures are returned as 1.0 (the IMPUTE convention)
+func ImputeQualityForRecord(rec []string) ImputeQuality {
+	var iq ImputeQuality
+	var sumd, sumd2, sumf float64
+
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	probidx := variant.GetProbIdx(prfx)
+	dsidx := variant.GetDosageIdx(prfx)
+
+	for _, geno := range sfx {
+		gp, ok := variant.GenoProbs(geno, probidx, dsidx)
+		if !ok {
+			continue
+		}
+		d := gp[1] + 2.0*gp[2]
+		sumd += d
+		sumd2 += d * d
+		sumf += gp[1] + 4.0*gp[2]
+		iq.N++
+	}
+	if iq.N == 0 {
+		return iq
+	}
+	n := float64(iq.N)
+	meand := sumd / n
+	theta := meand / 2.0
+	expVar := 2.0 * theta * (1.0 - theta)
+	if expVar <= 0.0 {
+		iq.MachRsq, iq.ImputeInfo, iq.DosageR2 = 1.0, 1.0, 1.0
+		return iq
+	}
+	varD := sumd2/n - meand*meand
+	iq.MachRsq = varD / expVar
+	iq.ImputeInfo = 1.0 - (sumf-sumd2)/(n*expVar)
+	trueVar := sumf/n - meand*meand
+	if trueVar > 0.0 {
+		iq.DosageR2 = varD / trueVar
+	}
+	return iq
+}
+
+// GetImputeMeasure ...
+// select a single quality measure by name, "machrsq", "info" or "dr2"
+func GetImputeMeasure(iq ImputeQuality, name string) (float64, bool) {
+	switch name {
+	case "machrsq":
+		return iq.MachRsq, true
+	case "info":
+		return iq.ImputeInfo, true
+	case "dr2":
+		return iq.DosageR2, true
+	}
+	return 0.0, false
+}
@@ -0,0 +1,130 @@
+package genometrics
+
+//
+// Genotype provenance audit: where overlapping assaytypes give conflicting
+// calls for a sample, the candidate genotypes (with GP, max probability and
+// INFO score) and the combination decision are kept for review. Collected by
+// vcfmerge.Combine when AllMetrics.Audit is set
+//
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ProvenanceHeader ...
+// column headers for the audit export
+const ProvenanceHeader = "varid\tchr\tposn\tsample\tcandidates\tchosen\tchosen_assaytype\tdecision"
+
+// Decisions recorded for a conflict, following the combination strategy:
+// highest max probability wins, ties broken on INFO score, all candidates
+// below the probability threshold leave the genotype missing
+const (
+	DecisionMaxProb   = "maxprob"
+	DecisionInfoScore = "infoscore"
+	DecisionFirst     = "first"
+	DecisionMissing   = "missing"
+)
+
+// Candidate ...
+// one assaytype's genotype for a sample
+type Candidate struct {
+	Assaytype string
+	GT        string
+	GP        string
+	MaxProb   float64
+	InfoScore float64
+}
+
+// ProvenanceEntry ...
+// a conflicting set of calls and the genotype chosen
+type ProvenanceEntry struct {
+	Varid           string
+	Chrom           string
+	Posn            string
+	SampleID        string
+	Candidates      []Candidate
+	Chosen          string
+	ChosenAssaytype string
+	Decision        string
+}
+
+// ProvenanceAudit ...
+// conflicts collected during combination, optionally restricted to a set of
+// varids (empty for all)
+type ProvenanceAudit struct {
+	Varids  map[string]bool
+	Entries []ProvenanceEntry
+}
+
+// NewProvenanceAudit ...
+func NewProvenanceAudit(varids []string) *ProvenanceAudit {
+	pa := ProvenanceAudit{Varids: make(map[string]bool, len(varids)), Entries: make([]ProvenanceEntry, 0, 100)}
+	for _, varid := range varids {
+		pa.Varids[varid] = true
+	}
+	return &pa
+}
+
+// Wants ...
+// is varid being audited?
+func (pa *ProvenanceAudit) Wants(varid string) bool {
+	return len(pa.Varids) == 0 || pa.Varids[varid]
+}
+
+// Add ...
+func (pa *ProvenanceAudit) Add(entry ProvenanceEntry) {
+	pa.Entries = append(pa.Entries, entry)
+}
+
+// TSV ...
+// audit line, candidates as AT:GT:GP=..:P=..:INFO=.. separated by ";"
+func (entry ProvenanceEntry) TSV() string {
+	cands := make([]string, len(entry.Candidates))
+	for i, c := range entry.Candidates {
+		cands[i] = fmt.Sprintf("%s:%s:GP=%s:P=%.4f:INFO=%.4f", c.Assaytype, c.GT, c.GP, c.MaxProb, c.InfoScore)
+	}
+	return strings.Join([]string{entry.Varid, entry.Chrom, entry.Posn, entry.SampleID, strings.Join(cands, ";"),
+		entry.Chosen, entry.ChosenAssaytype, entry.Decision}, "\t")
+}
+
+// WriteTSV ...
+func (pa *ProvenanceAudit) WriteTSV(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%s\n", ProvenanceHeader); err != nil {
+		return err
+	}
+	for _, entry := range pa.Entries {
+		if _, err := fmt.Fprintf(w, "%s\n", entry.TSV()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TSVLines ...
+// WriteTSV output as a list of lines
+func (pa *ProvenanceAudit) TSVLines() []string {
+	lines := make([]string, 0, len(pa.Entries)+1)
+	lines = append(lines, ProvenanceHeader)
+	for _, entry := range pa.Entries {
+		lines = append(lines, entry.TSV())
+	}
+	return lines
+}
+
+// WriteFile ...
+// write the audit export to path
+func (pa *ProvenanceAudit) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := pa.WriteTSV(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,129 @@
+package genometrics
+
+//
+// QC gates driven by RunParameters, applied to the set of per-assay records
+// found at a single position before they are combined
+//
+import (
+	"fmt"
+	"strconv"
+	"variant"
+)
+
+// QC actions
+const (
+	QCPass    = "pass"
+	QCDrop    = "drop"
+	QCFlag    = "flag"
+	QCExclude = "exclude"
+)
+
+// QCHeader ...
+// column headers for a QC sidecar file
+const QCHeader = "chr\tposn\tvarid\tassaytype\taction\treason\tvalue\tlimit"
+
+// QCDecision ...
+// outcome of a QC gate for one assay record (or "all" assaytypes)
+type QCDecision struct {
+	Chrom     string
+	Posn      string
+	Varid     string
+	Assaytype string
+	Action    string
+	Reason    string
+	Value     float64
+	Limit     float64
+}
+
+// TSV ...
+// a decision as a line for the QC sidecar file
+func (d QCDecision) TSV() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%.6f\t%.6f",
+		d.Chrom, d.Posn, d.Varid, d.Assaytype, d.Action, d.Reason, d.Value, d.Limit)
+}
+
+// NewQCDecision ...
+// decision for a record as-slice (no assaytype prefix)
+func NewQCDecision(rec []string, assaytype string, action string, reason string, value float64, limit float64) QCDecision {
+	return QCDecision{variant.GetChrom(rec), variant.GetPosnStr(rec), variant.GetVarid(rec),
+		assaytype, action, reason, value, limit}
+}
+
+// InfoScoreForRecord ...
+// the INFO= tag if present, otherwise IMPUTE-style INFO re-estimated from GP / DS
+func InfoScoreForRecord(rec []string) float64 {
+	if info, ok := variant.GetInfoValue(rec, "INFO"); ok {
+		infoscore, _ := strconv.ParseFloat(info, 64)
+		return infoscore
+	}
+	return ImputeQualityForRecord(rec).ImputeInfo
+}
+
+// ApplyQCGates ...
+// vcfset is a set of records at the same position, each with the assaytype in
+// slot 0. Records under the call-rate or INFO score thresholds are dropped,
+// then the MAF of those remaining is compared, if the range exceeds MafDelta
+// the position is flagged, or excluded (nothing retained) depending on MafAction.
+// Thresholds of 0 switch a gate off, records with no called genotypes take
+// no part in the MAF comparison.
+// Returns the retained records and a decision for every record, no
+// decisions when no gate is set
+func ApplyQCGates(vcfset [][]string, runParams RunParameters, threshold float64) ([][]string, []QCDecision) {
+	retained := make([][]string, 0, len(vcfset))
+	decisions := make([]QCDecision, 0, len(vcfset))
+	mafs := make([]float64, 0, len(vcfset))
+
+	if !runParams.GatesSet() {
+		return vcfset, decisions
+	}
+
+	for _, rec := range vcfset {
+		atype := rec[0]
+		var vm VariantMetrics
+		if runParams.CallRate > 0.0 || runParams.MafDelta > 0.0 {
+			vm = MetricsForRecord(rec[1:], threshold)
+		}
+		if runParams.CallRate > 0.0 && vm.CallRate < runParams.CallRate {
+			decisions = append(decisions, NewQCDecision(rec[1:], atype, QCDrop, "callrate", vm.CallRate, runParams.CallRate))
+			continue
+		}
+		if runParams.InfoScore > 0.0 {
+			infoscore := InfoScoreForRecord(rec[1:])
+			if infoscore < runParams.InfoScore {
+				decisions = append(decisions, NewQCDecision(rec[1:], atype, QCDrop, "infoscore", infoscore, runParams.InfoScore))
+				continue
+			}
+		}
+		retained = append(retained, rec)
+		if vm.N > 0 {
+			mafs = append(mafs, vm.MAF)
+		}
+	}
+
+	action := QCPass
+	reason := ""
+	delta := 0.0
+	if runParams.MafDelta > 0.0 && len(mafs) > 1 {
+		minMaf, maxMaf := mafs[0], mafs[0]
+		for _, maf := range mafs[1:] {
+			if maf < minMaf {
+				minMaf = maf
+			}
+			if maf > maxMaf {
+				maxMaf = maf
+			}
+		}
+		delta = maxMaf - minMaf
+		if delta > runParams.MafDelta {
+			action = runParams.MafAction
+			reason = "mafdelta"
+		}
+	}
+	for _, rec := range retained {
+		decisions = append(decisions, NewQCDecision(rec[1:], rec[0], action, reason, delta, runParams.MafDelta))
+	}
+	if action == QCExclude {
+		retained = retained[:0]
+	}
+	return retained, decisions
+}
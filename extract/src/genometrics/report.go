@@ -0,0 +1,138 @@
+package genometrics
+
+//
+// Metrics reports: per-variant metrics plus overlap counters for a run,
+// written as JSON or TSV for downstream QC
+//
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// VariantReport ...
+// one entry in a MetricsReport
+type VariantReport struct {
+	VariantMetrics
+	Overlap AllMetrics `json:"overlap"`
+	ErrPct  float64    `json:"errpct"`
+}
+
+// MarshalJSON ...
+// as the struct tags, with null for metrics that are undefined (NaN),
+// e.g. allele frequencies for a record with no called genotypes
+func (vr VariantReport) MarshalJSON() ([]byte, error) {
+	vm := vr.VariantMetrics
+	return json.Marshal(struct {
+		Varid      string     `json:"varid"`
+		Assaytype  string     `json:"assaytype"`
+		CallRate   *float64   `json:"callrate"`
+		RefAF      *float64   `json:"refaf"`
+		AltAF      *float64   `json:"altaf"`
+		MAF        *float64   `json:"maf"`
+		HWEP       *float64   `json:"hwep"`
+		HetCount   int        `json:"het"`
+		HomCommon  int        `json:"homcommon"`
+		HomRare    int        `json:"homrare"`
+		N          int        `json:"n"`
+		Missing    int        `json:"missing"`
+		Dot        int        `json:"dot"`
+		RefPanelAF *float64   `json:"refpanelaf"`
+		Overlap    AllMetrics `json:"overlap"`
+		ErrPct     *float64   `json:"errpct"`
+	}{vm.Varid, vm.Assaytype, jsonFloat(vm.CallRate), jsonFloat(vm.RefAF), jsonFloat(vm.AltAF), jsonFloat(vm.MAF),
+		jsonFloat(vm.HWEP), vm.HetCount, vm.HomCommon, vm.HomRare, vm.N, vm.Missing, vm.Dot, jsonFloat(vm.RefPanelAF),
+		vr.Overlap, jsonFloat(vr.ErrPct)})
+}
+
+// nil (JSON null) for NaN or infinite values
+func jsonFloat(f float64) *float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
+
+// MetricsReport ...
+// all metrics for a run, totals are accumulated via Increment
+type MetricsReport struct {
+	SNPCount int             `json:"snpcount"`
+	Variants []VariantReport `json:"variants"`
+	Totals   AllMetrics      `json:"totals"`
+	ErrPct   float64         `json:"errpct"`
+}
+
+var tsvColumns = []string{"varid", "assaytype", "callrate", "refaf", "altaf", "maf", "hwep",
+	"het", "homcommon", "homrare", "n", "missing", "dot", "refpanelaf",
+	"allgenos", "uniquegenos", "alloverlap", "two", "gttwo", "overlapgenodiffs",
+	"diffprobdiffs", "sameprobdiffs", "missinggenotested", "missingunresolved", "noassay", "errpct"}
+
+// NewMetricsReport ...
+func NewMetricsReport() *MetricsReport {
+	return &MetricsReport{Variants: make([]VariantReport, 0, 100)}
+}
+
+// Add ...
+// add one variant's metrics to the report, genomet may be nil
+// where there are no overlap counters (single file input)
+func (r *MetricsReport) Add(vm VariantMetrics, genomet *AllMetrics) {
+	var vr VariantReport
+	vr.VariantMetrics = vm
+	if genomet != nil {
+		vr.Overlap = *genomet
+		vr.ErrPct = ErrPct(genomet)
+		Increment(&r.Totals, genomet)
+	}
+	r.Variants = append(r.Variants, vr)
+	r.SNPCount++
+	r.ErrPct = ErrPct(&r.Totals)
+}
+
+// WriteJSON ...
+func (r *MetricsReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTSV ...
+// header, one line per variant, then an "all" line for the totals
+func (r *MetricsReport) WriteTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n", strings.Join(tsvColumns, "\t"))
+	for _, vr := range r.Variants {
+		vm := vr.VariantMetrics
+		fmt.Fprintf(bw, "%s\t%s\t%.6f\t%.6f\t%.6f\t%.6f\t%.6e\t%d\t%d\t%d\t%d\t%d\t%d\t%.6f\t%s\t%.3f\n",
+			vm.Varid, vm.Assaytype, vm.CallRate, vm.RefAF, vm.AltAF, vm.MAF, vm.HWEP,
+			vm.HetCount, vm.HomCommon, vm.HomRare, vm.N, vm.Missing, vm.Dot, vm.RefPanelAF,
+			countsAsTSV(&vr.Overlap), vr.ErrPct)
+	}
+	fmt.Fprintf(bw, "all\t.\t.\t.\t.\t.\t.\t.\t.\t.\t.\t.\t.\t.\t%s\t%.3f\n", countsAsTSV(&r.Totals), r.ErrPct)
+	return bw.Flush()
+}
+
+// WriteFile ...
+// write the report to path, JSON if the path ends in .json, otherwise TSV
+func (r *MetricsReport) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".json") {
+		return r.WriteJSON(f)
+	}
+	return r.WriteTSV(f)
+}
+
+func countsAsTSV(genomet *AllMetrics) string {
+	return fmt.Sprintf("%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d",
+		(*genomet).AllGenoCount, (*genomet).UniqueGenoCount, (*genomet).OverlapTestCount,
+		(*genomet).TwoOverlapCount, (*genomet).GtTwoOverlapCount, (*genomet).MismatchCount,
+		(*genomet).DiffProbDiffs, (*genomet).SameProbDiffs, (*genomet).MissTestCount,
+		(*genomet).MissingCount, (*genomet).NoAssayCount)
+}
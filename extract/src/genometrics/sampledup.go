@@ -0,0 +1,372 @@
+package genometrics
+
+//
+// Duplicate and mislabelled sample detection across panels: hard-call
+// genotypes for each (assaytype, sample) are collected over a set of
+// well-typed SNPs and compared pairwise.
+// - the same sample id on two panels should agree, high discordance
+//   suggests a sample swap or mislabelling ("swap")
+// - different sample ids should not agree, near-identical genotypes suggest
+//   a hidden duplicate ("duplicate")
+//
+// Where panels code the alleles the other way round the calls are recoded
+// to the first panel's alleles, panels with other alleles are skipped
+//
+// Scale: swaps are found by sample id, one comparison per panel pair a
+// sample is on. Duplicate candidates are found by bucketing each panel's
+// samples on their calls over blocks of SNPs typed on both panels (a pair
+// only needs one identical block to be compared in full), so the work is
+// about samples x SNPs x panel pairs plus the candidate pairs rather than
+// all pairs of samples. Panel pairs sharing fewer than DupFullSNPs SNPs
+// (only reported with minSNPs below that) are compared pair by pair
+//
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// SampleDupHeader ...
+// column headers for a duplicate / mislabelled sample report
+const SampleDupHeader = "rank\ttype\tsample1\tassaytype1\tsample2\tassaytype2\tnsnps\tdiscordant\tconcordance"
+
+// SampleDup ...
+// a flagged pair of (assaytype, sample) genotype sets
+type SampleDup struct {
+	Type        string
+	Sample1     string
+	Assaytype1  string
+	Sample2     string
+	Assaytype2  string
+	N           int
+	Discordant  int
+	Concordance float64
+}
+
+// PanelGenotypes ...
+// hard calls (0,1,2 alt allele count, -1 missing) per assaytype and sample
+// for the SNPs added, only panel records with at least MinCallRate and
+// MinMAF are used
+type PanelGenotypes struct {
+	Threshold   float64
+	MinCallRate float64
+	MinMAF      float64
+	SNPs        []string
+	entries     map[string]*panelSample
+	snpPanels   []map[string]bool
+}
+
+// Duplicate candidates: SNPs per block for buckets (at most), the fewest
+// blocks for a panel pair and the largest bucket (samples with identical
+// calls over a block) whose pairs are compared. Larger buckets are
+// uninformative blocks, true duplicates share others
+const (
+	dupBlockSNPs = 32
+	dupMinBlocks = 4
+	dupMaxBucket = 1000
+)
+
+// DupFullSNPs ...
+// panel pairs sharing fewer SNPs have all sample pairs compared for
+// duplicates, which only happens with minSNPs below this
+const DupFullSNPs = 32
+
+type panelSample struct {
+	assaytype string
+	sampleID  string
+	calls     []int8
+}
+
+// NewPanelGenotypes ...
+func NewPanelGenotypes(threshold float64, minCallRate float64, minMAF float64) *PanelGenotypes {
+	return &PanelGenotypes{Threshold: threshold, MinCallRate: minCallRate, MinMAF: minMAF,
+		SNPs: make([]string, 0, 1000), entries: make(map[string]*panelSample)}
+}
+
+// AddVariant ...
+// vcfset is a set of records for the same variant, each with the assaytype in
+// slot 0, samplePosnName maps assaytype to column position to sample id (as
+// from godb.GetSamplesByAssaytype). Returns false if fewer than two panel
+// records pass the call rate and MAF filters, in which case the variant is not
+// added
+func (pg *PanelGenotypes) AddVariant(vcfset [][]string, samplePosnName map[string]map[int]string) bool {
+	refA, refB := "", ""
+	used := make([][]string, 0, len(vcfset))
+	recode := make([]bool, 0, len(vcfset))
+	for _, rec := range vcfset {
+		// N == 0 first, the MAF is NaN with no called genotypes
+		vm := MetricsForRecord(rec[1:], pg.Threshold)
+		if vm.N == 0 || vm.CallRate < pg.MinCallRate || vm.MAF < pg.MinMAF {
+			continue
+		}
+		prfx, _ := variant.GetVCFPrfxSfx(rec[1:])
+		a, b := variant.GetAlleles(prfx)
+		if refA == "" {
+			refA, refB = a, b
+		}
+		switch {
+		case a == refA && b == refB:
+			recode = append(recode, false)
+		case a == refB && b == refA:
+			recode = append(recode, true)
+		default:
+			continue
+		}
+		used = append(used, rec)
+	}
+	if len(used) < 2 {
+		return false
+	}
+	idx := len(pg.SNPs)
+	prfx, _ := variant.GetVCFPrfxSfx(used[0][1:])
+	pg.SNPs = append(pg.SNPs, variant.GetVarid(prfx))
+	panels := make(map[string]bool, len(used))
+	for _, rec := range used {
+		panels[rec[0]] = true
+	}
+	pg.snpPanels = append(pg.snpPanels, panels)
+	for _, ps := range pg.entries {
+		ps.calls = append(ps.calls, -1)
+	}
+	for i, rec := range used {
+		prfx, sfx := variant.GetVCFPrfxSfx(rec[1:])
+		probidx := variant.GetProbIdx(prfx)
+		for j, geno := range sfx {
+			sampleID, ok := samplePosnName[rec[0]][j]
+			if !ok {
+				continue
+			}
+			call, called := variant.GetHardCall(geno, pg.Threshold, probidx)
+			if !called {
+				continue
+			}
+			if recode[i] {
+				call = 2.0 - call
+			}
+			pg.entry(rec[0], sampleID).calls[idx] = int8(call)
+		}
+	}
+	return true
+}
+
+// get or create the entry for an assaytype, sample, all missing to the current SNP count
+func (pg *PanelGenotypes) entry(assaytype string, sampleID string) *panelSample {
+	key := assaytype + "\t" + sampleID
+	ps, ok := pg.entries[key]
+	if !ok {
+		ps = &panelSample{assaytype: assaytype, sampleID: sampleID, calls: make([]int8, len(pg.SNPs))}
+		for i := range ps.calls {
+			ps.calls[i] = -1
+		}
+		pg.entries[key] = ps
+	}
+	return ps
+}
+
+// FindSampleDups ...
+// compare (assaytype, sample) pairs over SNPs called in both, pairs with
+// fewer than minSNPs shared calls are not reported. Same sample id pairs
+// (on different panels) with discordance over maxDiscord are "swap",
+// different sample id pairs with concordance of at least minConcord are
+// "duplicate". Only duplicate candidates from dupCandidates are compared
+func (pg *PanelGenotypes) FindSampleDups(minSNPs int, maxDiscord float64, minConcord float64) []SampleDup {
+	keys := make([]string, 0, len(pg.entries))
+	for key := range pg.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dups := make([]SampleDup, 0)
+	// swaps, the same sample id on each pair of panels
+	bySample := make(map[string][]*panelSample)
+	for _, key := range keys {
+		ps := pg.entries[key]
+		bySample[ps.sampleID] = append(bySample[ps.sampleID], ps)
+	}
+	for _, key := range keys {
+		ps1 := pg.entries[key]
+		for _, ps2 := range bySample[ps1.sampleID] {
+			if ps2.assaytype <= ps1.assaytype {
+				continue
+			}
+			if dup, ok := comparePanelSamples(ps1, ps2, minSNPs); ok && 1.0-dup.Concordance > maxDiscord {
+				dup.Type = "swap"
+				dups = append(dups, dup)
+			}
+		}
+	}
+	// duplicates, different sample ids among the candidates
+	for _, pair := range pg.dupCandidates(minSNPs) {
+		ps1, ps2 := pg.entries[pair[0]], pg.entries[pair[1]]
+		if dup, ok := comparePanelSamples(ps1, ps2, minSNPs); ok && dup.Concordance >= minConcord {
+			dup.Type = "duplicate"
+			dups = append(dups, dup)
+		}
+	}
+	return dups
+}
+
+// concordance of two entries over the SNPs called in both, false if fewer
+// than minSNPs
+func comparePanelSamples(ps1 *panelSample, ps2 *panelSample, minSNPs int) (SampleDup, bool) {
+	n, discord := 0, 0
+	for k, c1 := range ps1.calls {
+		c2 := ps2.calls[k]
+		if c1 < 0 || c2 < 0 {
+			continue
+		}
+		n++
+		if c1 != c2 {
+			discord++
+		}
+	}
+	if n == 0 || n < minSNPs {
+		return SampleDup{}, false
+	}
+	return SampleDup{Sample1: ps1.sampleID, Assaytype1: ps1.assaytype, Sample2: ps2.sampleID, Assaytype2: ps2.assaytype,
+		N: n, Discordant: discord, Concordance: 1.0 - float64(discord)/float64(n)}, true
+}
+
+// dupCandidates ...
+// entry key pairs (in key order) with different sample ids that could
+// share minSNPs calls, for each pair of panels (including a panel with
+// itself). Panels sharing fewer than DupFullSNPs SNPs have every pair
+// compared. Otherwise samples are bucketed on their calls over half
+// overlapping blocks of SNPs typed on both panels, dupBlockSNPs long or
+// shorter for small overlaps so there are at least dupMinBlocks, and pairs
+// with identical calls over at least one block are candidates. Each SNP is
+// in two blocks, so a few discordant or missing calls leave other blocks
+// intact
+func (pg *PanelGenotypes) dupCandidates(minSNPs int) [][2]string {
+	byPanel := make(map[string][]string)
+	for key, ps := range pg.entries {
+		byPanel[ps.assaytype] = append(byPanel[ps.assaytype], key)
+	}
+	panels := make([]string, 0, len(byPanel))
+	for at := range byPanel {
+		panels = append(panels, at)
+		sort.Strings(byPanel[at])
+	}
+	sort.Strings(panels)
+
+	seen := make(map[string]bool)
+	pairs := make([][2]string, 0)
+	addPair := func(key1 string, key2 string) {
+		if key2 < key1 {
+			key1, key2 = key2, key1
+		}
+		ps1, ps2 := pg.entries[key1], pg.entries[key2]
+		if ps1.sampleID == ps2.sampleID || seen[key1+"\n"+key2] {
+			return
+		}
+		seen[key1+"\n"+key2] = true
+		pairs = append(pairs, [2]string{key1, key2})
+	}
+	for a, at1 := range panels {
+		for _, at2 := range panels[a:] {
+			shared := make([]int, 0, len(pg.SNPs))
+			for k, snpPanels := range pg.snpPanels {
+				if snpPanels[at1] && snpPanels[at2] {
+					shared = append(shared, k)
+				}
+			}
+			// no pair can have minSNPs calls in common
+			if len(shared) == 0 || len(shared) < minSNPs {
+				continue
+			}
+			members := byPanel[at1]
+			if at2 != at1 {
+				members = append(append([]string{}, byPanel[at1]...), byPanel[at2]...)
+			}
+			if len(shared) < DupFullSNPs {
+				log.Printf("sample duplicates %s/%s: %d shared SNPs, comparing all pairs of %d samples\n", at1, at2,
+					len(shared), len(members))
+				for i := 0; i < len(members); i++ {
+					for j := i + 1; j < len(members); j++ {
+						addPair(members[i], members[j])
+					}
+				}
+				continue
+			}
+			blockLen := dupBlockSNPs
+			if len(shared)/dupMinBlocks < blockLen {
+				blockLen = len(shared) / dupMinBlocks
+			}
+			skipped := 0
+			for start := 0; start < len(shared); start += blockLen / 2 {
+				end := start + blockLen
+				if end > len(shared) {
+					// last block ends at the last shared SNP
+					start, end = len(shared)-blockLen, len(shared)
+				}
+				buckets := make(map[string][]string)
+				for _, key := range members {
+					if hash, ok := blockHash(pg.entries[key].calls, shared[start:end]); ok {
+						buckets[hash] = append(buckets[hash], key)
+					}
+				}
+				for _, bucket := range buckets {
+					if len(bucket) > dupMaxBucket {
+						skipped++
+						continue
+					}
+					for i := 0; i < len(bucket); i++ {
+						for j := i + 1; j < len(bucket); j++ {
+							addPair(bucket[i], bucket[j])
+						}
+					}
+				}
+				if end == len(shared) {
+					break
+				}
+			}
+			if skipped > 0 {
+				log.Printf("sample duplicates %s/%s: %d buckets over %d samples skipped (%d SNP blocks)\n", at1, at2,
+					skipped, dupMaxBucket, blockLen)
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
+
+// calls at the SNP indices as a bucket key, false if any is missing
+func blockHash(calls []int8, idxs []int) (string, bool) {
+	hash := make([]byte, len(idxs))
+	for i, k := range idxs {
+		if calls[k] < 0 {
+			return "", false
+		}
+		hash[i] = byte('0' + calls[k])
+	}
+	return string(hash), true
+}
+
+// RankSampleDups ...
+// swaps first, most discordant first, then duplicates, most concordant first
+func RankSampleDups(dups []SampleDup) {
+	sort.SliceStable(dups, func(i, j int) bool {
+		if dups[i].Type != dups[j].Type {
+			return dups[i].Type == "swap"
+		}
+		if dups[i].Type == "swap" {
+			return dups[i].Concordance < dups[j].Concordance
+		}
+		return dups[i].Concordance > dups[j].Concordance
+	})
+}
+
+// TSV ...
+// report line for a flagged pair
+func (dup SampleDup) TSV(rank int) string {
+	return strings.Join([]string{fmt.Sprintf("%d", rank), dup.Type, dup.Sample1, dup.Assaytype1,
+		dup.Sample2, dup.Assaytype2, fmt.Sprintf("%d", dup.N), fmt.Sprintf("%d", dup.Discordant),
+		fmt.Sprintf("%.6f", dup.Concordance)}, "\t")
+}
@@ -0,0 +1,201 @@
+package genometrics
+
+//
+// Per-sample metrics accumulated across a set of (combined) VCF records:
+// call rate, heterozygosity rate, inbreeding coefficient F and the panel
+// (AT) each sample's genotypes came from
+//
+// F follows PLINK --het: (O(HOM) - E(HOM)) / (N - E(HOM)), where E(HOM) sums
+// 1 - 2p(1-p) over the variants the sample is called for
+//
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// SampleMetricsHeader ...
+// column headers for sample metrics output
+const SampleMetricsHeader = "sample\tnvar\tcalled\tmissing\tcallrate\thet\thetrate\thomref\thomalt\tohom\tehom\tf\tpanels\tflags"
+
+// SampleMetrics ...
+type SampleMetrics struct {
+	SampleID string
+	NVar     int
+	Called   int
+	Missing  int
+	CallRate float64
+	Het      int
+	HetRate  float64
+	HomRef   int
+	HomAlt   int
+	EHom     float64
+	F        float64
+	Panels   map[string]int
+	Flags    []string
+}
+
+// SampleQC ...
+// accumulates SampleMetrics, samples are in column order
+type SampleQC struct {
+	Samples   []SampleMetrics
+	Threshold float64
+}
+
+// NewSampleQC ...
+// sampleNames are the sample columns of the records to be added
+func NewSampleQC(sampleNames []string, threshold float64) *SampleQC {
+	sqc := SampleQC{Samples: make([]SampleMetrics, len(sampleNames)), Threshold: threshold}
+	for i, name := range sampleNames {
+		sqc.Samples[i] = SampleMetrics{SampleID: name, Panels: make(map[string]int), Flags: make([]string, 0)}
+	}
+	return &sqc
+}
+
+// AddRecord ...
+// add a single VCF record-as-slice, sample columns aligned with those given
+// to NewSampleQC
+func (sqc *SampleQC) AddRecord(rec []string) {
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	probidx := variant.GetProbIdx(prfx)
+	atidx := variant.GetFmtIdx(prfx, "AT")
+
+	calls := make([]float64, len(sfx))
+	called := make([]bool, len(sfx))
+	sum := 0.0
+	n := 0
+	for i, geno := range sfx {
+		if i >= len(sqc.Samples) {
+			break
+		}
+		calls[i], called[i] = variant.GetHardCall(geno, sqc.Threshold, probidx)
+		if called[i] {
+			sum += calls[i]
+			n++
+		}
+	}
+	p := 0.0
+	if n > 0 {
+		p = sum / float64(2*n)
+	}
+	ehom := 1.0 - 2.0*p*(1.0-p)
+
+	for i, geno := range sfx {
+		if i >= len(sqc.Samples) {
+			break
+		}
+		sm := &sqc.Samples[i]
+		sm.NVar++
+		if atidx >= 0 && geno != "." {
+			g := strings.Split(geno, ":")
+			if atidx < len(g) {
+				sm.Panels[g[atidx]]++
+			}
+		}
+		if !called[i] {
+			sm.Missing++
+			continue
+		}
+		sm.Called++
+		sm.EHom += ehom
+		switch calls[i] {
+		case 0.0:
+			sm.HomRef++
+		case 1.0:
+			sm.Het++
+		case 2.0:
+			sm.HomAlt++
+		}
+	}
+}
+
+// Finish ...
+// calculate rates and F from the accumulated counts
+func (sqc *SampleQC) Finish() {
+	for i := range sqc.Samples {
+		sm := &sqc.Samples[i]
+		if sm.NVar > 0 {
+			sm.CallRate = float64(sm.Called) / float64(sm.NVar)
+		}
+		if sm.Called > 0 {
+			sm.HetRate = float64(sm.Het) / float64(sm.Called)
+		}
+		if float64(sm.Called)-sm.EHom != 0.0 {
+			sm.F = (float64(sm.HomRef+sm.HomAlt) - sm.EHom) / (float64(sm.Called) - sm.EHom)
+		}
+	}
+}
+
+// FlagOutliers ...
+// flag samples with call rate under minCallRate ("lowcr"), heterozygosity
+// rate more than hetSD standard deviations from the mean ("highhet",
+// "lowhet") and |F| over maxF ("highf", "lowf"). Returns the flagged count
+func (sqc *SampleQC) FlagOutliers(minCallRate float64, hetSD float64, maxF float64) int {
+	var sum, sumsq float64
+	n := 0
+	for _, sm := range sqc.Samples {
+		if sm.Called > 0 {
+			sum += sm.HetRate
+			sumsq += sm.HetRate * sm.HetRate
+			n++
+		}
+	}
+	mean, sd := 0.0, 0.0
+	if n > 1 {
+		mean = sum / float64(n)
+		sd = math.Sqrt((sumsq - float64(n)*mean*mean) / float64(n-1))
+	}
+	flagged := 0
+	for i := range sqc.Samples {
+		sm := &sqc.Samples[i]
+		sm.Flags = sm.Flags[:0]
+		if sm.CallRate < minCallRate {
+			sm.Flags = append(sm.Flags, "lowcr")
+		}
+		if sd > 0.0 && sm.Called > 0 {
+			if sm.HetRate > mean+hetSD*sd {
+				sm.Flags = append(sm.Flags, "highhet")
+			}
+			if sm.HetRate < mean-hetSD*sd {
+				sm.Flags = append(sm.Flags, "lowhet")
+			}
+		}
+		if maxF > 0.0 && sm.F > maxF {
+			sm.Flags = append(sm.Flags, "highf")
+		}
+		if maxF > 0.0 && sm.F < -maxF {
+			sm.Flags = append(sm.Flags, "lowf")
+		}
+		if len(sm.Flags) > 0 {
+			flagged++
+		}
+	}
+	return flagged
+}
+
+// TSV ...
+// sample metrics as an output line, panels as AT=count sorted by AT
+func (sm SampleMetrics) TSV() string {
+	ats := make([]string, 0, len(sm.Panels))
+	for at := range sm.Panels {
+		ats = append(ats, at)
+	}
+	sort.Strings(ats)
+	panels := make([]string, len(ats))
+	for i, at := range ats {
+		panels[i] = fmt.Sprintf("%s=%d", at, sm.Panels[at])
+	}
+	flags := "."
+	if len(sm.Flags) > 0 {
+		flags = strings.Join(sm.Flags, ",")
+	}
+	panelStr := "."
+	if len(panels) > 0 {
+		panelStr = strings.Join(panels, ",")
+	}
+	return fmt.Sprintf("%s\t%d\t%d\t%d\t%.6f\t%d\t%.6f\t%d\t%d\t%d\t%.3f\t%.6f\t%s\t%s",
+		sm.SampleID, sm.NVar, sm.Called, sm.Missing, sm.CallRate, sm.Het, sm.HetRate,
+		sm.HomRef, sm.HomAlt, sm.HomRef+sm.HomAlt, sm.EHom, sm.F, panelStr, flags)
+}
@@ -0,0 +1,254 @@
+package genometrics
+
+//
+// Genetic sex from X-chromosome heterozygosity and Y call rate
+//
+// X: F = 1 - O(HET) / E(HET) over non-PAR X SNPs a sample is called for,
+// E(HET) summing 2p(1-p) (as PLINK --check-sex). Males are expected to have
+// F near 1, females near 0.
+// Y: where Y SNPs are present, the fraction called for each sample, males
+// are expected to be called and females mostly missing.
+//
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// SexCheckHeader ...
+// column headers for sex check output
+const SexCheckHeader = "sample\txsnps\txhet\txexphet\tf\tysnps\tycalled\tycallrate\tinferred\trecorded\tstatus"
+
+// Sex codes for inferred and recorded sex
+const (
+	SexMale    = "M"
+	SexFemale  = "F"
+	SexUnknown = "U"
+)
+
+// pseudo-autosomal regions on X by genome build, excluded from the X het
+// calculation
+var parRegions = map[string][][2]int{
+	"GRCh37": {{60001, 2699520}, {154931044, 155260560}},
+	"GRCh38": {{10001, 2781479}, {155701383, 156030895}},
+}
+
+// PARRegions ...
+// X pseudo-autosomal regions for a genome build (GRCh37 / hg19 or
+// GRCh38 / hg38), an error for other builds
+func PARRegions(build string) ([][2]int, error) {
+	switch strings.ToLower(strings.TrimSpace(build)) {
+	case "grch37", "hg19", "37", "b37":
+		return parRegions["GRCh37"], nil
+	case "grch38", "hg38", "38", "b38":
+		return parRegions["GRCh38"], nil
+	}
+	return nil, fmt.Errorf("no X PAR regions for genome build %s, expected GRCh37 or GRCh38", build)
+}
+
+// SexCheck ...
+// X and Y metrics, inferred and recorded sex for one sample
+type SexCheck struct {
+	SampleID  string
+	XCalled   int
+	XHet      int
+	XExpHet   float64
+	F         float64
+	YSNPs     int
+	YCalled   int
+	YCallRate float64
+	Inferred  string
+	Recorded  string
+	Status    string
+}
+
+// SexChecker ...
+// accumulates SexCheck by sample id, a sample typed on several
+// assaytypes is accumulated over all of them
+type SexChecker struct {
+	Samples    map[string]*SexCheck
+	Threshold  float64
+	ParRegions [][2]int
+	XCount     int
+	YCount     int
+}
+
+// NewSexChecker ...
+// parRegions are the X pseudo-autosomal regions for the data's genome
+// build, from PARRegions
+func NewSexChecker(threshold float64, parRegions [][2]int) *SexChecker {
+	return &SexChecker{Samples: make(map[string]*SexCheck), Threshold: threshold, ParRegions: parRegions}
+}
+
+// IsPAR ...
+// is an X position in a pseudo-autosomal region?
+func (sc *SexChecker) IsPAR(posn int) bool {
+	for _, par := range sc.ParRegions {
+		if posn >= par[0] && posn <= par[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *SexChecker) sample(sampleID string) *SexCheck {
+	chk, ok := sc.Samples[sampleID]
+	if !ok {
+		chk = &SexCheck{SampleID: sampleID, Inferred: SexUnknown, Recorded: SexUnknown}
+		sc.Samples[sampleID] = chk
+	}
+	return chk
+}
+
+// AddXRecord ...
+// add one X-chromosome VCF record-as-slice, posnName maps the record's
+// sample columns to sample ids. PAR SNPs are ignored, returns false if the
+// record was not used
+func (sc *SexChecker) AddXRecord(rec []string, posnName map[int]string) bool {
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	if sc.IsPAR(variant.GetPosn(prfx)) {
+		return false
+	}
+	probidx := variant.GetProbIdx(prfx)
+	calls := make([]float64, len(sfx))
+	called := make([]bool, len(sfx))
+	sum := 0.0
+	n := 0
+	for i, geno := range sfx {
+		if _, ok := posnName[i]; !ok {
+			continue
+		}
+		calls[i], called[i] = variant.GetHardCall(geno, sc.Threshold, probidx)
+		if called[i] {
+			sum += calls[i]
+			n++
+		}
+	}
+	if n == 0 {
+		return false
+	}
+	p := sum / float64(2*n)
+	exphet := 2.0 * p * (1.0 - p)
+	if exphet == 0.0 {
+		return false
+	}
+	sc.XCount++
+	for i := range sfx {
+		if !called[i] {
+			continue
+		}
+		chk := sc.sample(posnName[i])
+		chk.XCalled++
+		chk.XExpHet += exphet
+		if calls[i] == 1.0 {
+			chk.XHet++
+		}
+	}
+	return true
+}
+
+// AddYRecord ...
+// add one Y-chromosome VCF record-as-slice
+func (sc *SexChecker) AddYRecord(rec []string, posnName map[int]string) {
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	probidx := variant.GetProbIdx(prfx)
+	sc.YCount++
+	for i, geno := range sfx {
+		sampleID, ok := posnName[i]
+		if !ok {
+			continue
+		}
+		chk := sc.sample(sampleID)
+		chk.YSNPs++
+		if _, called := variant.GetHardCall(geno, sc.Threshold, probidx); called {
+			chk.YCalled++
+		}
+	}
+}
+
+// Infer ...
+// F at most femaleMaxF is female, at least maleMinF male, otherwise
+// unknown. Where a sample has Y SNPs a Y call rate under minYCallRate
+// must agree with female and at or over it with male, disagreement leaves
+// the sex unknown
+func (sc *SexChecker) Infer(femaleMaxF float64, maleMinF float64, minYCallRate float64) {
+	for _, chk := range sc.Samples {
+		chk.Inferred = SexUnknown
+		if chk.XExpHet > 0.0 {
+			chk.F = 1.0 - float64(chk.XHet)/chk.XExpHet
+			if chk.F <= femaleMaxF {
+				chk.Inferred = SexFemale
+			} else if chk.F >= maleMinF {
+				chk.Inferred = SexMale
+			}
+		}
+		if chk.YSNPs > 0 {
+			chk.YCallRate = float64(chk.YCalled) / float64(chk.YSNPs)
+			ysex := SexFemale
+			if chk.YCallRate >= minYCallRate {
+				ysex = SexMale
+			}
+			if chk.XExpHet == 0.0 {
+				chk.Inferred = ysex
+			} else if chk.Inferred != ysex {
+				chk.Inferred = SexUnknown
+			}
+		}
+	}
+}
+
+// NormaliseSex ...
+// recorded sex phenotype values (1/2, M/F, male/female) as sex codes
+func NormaliseSex(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "m", "male":
+		return SexMale
+	case "2", "f", "female":
+		return SexFemale
+	}
+	return SexUnknown
+}
+
+// Compare ...
+// set recorded sex from a sample id to phenotype value map and the status:
+// "ok", "mismatch", "noinfer" (genetic sex unknown) or "norecord".
+// Returns the mismatch count
+func (sc *SexChecker) Compare(recorded map[string]string) int {
+	mismatches := 0
+	for id, chk := range sc.Samples {
+		chk.Recorded = SexUnknown
+		if value, ok := recorded[id]; ok {
+			chk.Recorded = NormaliseSex(value)
+		}
+		switch {
+		case chk.Recorded == SexUnknown:
+			chk.Status = "norecord"
+		case chk.Inferred == SexUnknown:
+			chk.Status = "noinfer"
+		case chk.Inferred == chk.Recorded:
+			chk.Status = "ok"
+		default:
+			chk.Status = "mismatch"
+			mismatches++
+		}
+	}
+	return mismatches
+}
+
+// SampleIDs ...
+// sorted sample ids
+func (sc *SexChecker) SampleIDs() []string {
+	ids := make([]string, 0, len(sc.Samples))
+	for id := range sc.Samples {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TSV ...
+func (chk SexCheck) TSV() string {
+	return fmt.Sprintf("%s\t%d\t%d\t%.3f\t%.4f\t%d\t%d\t%.4f\t%s\t%s\t%s", chk.SampleID, chk.XCalled, chk.XHet,
+		chk.XExpHet, chk.F, chk.YSNPs, chk.YCalled, chk.YCallRate, chk.Inferred, chk.Recorded, chk.Status)
+}
@@ -6,14 +6,19 @@
 package godb
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"genometrics"
+	"io"
 	"log"
 	"os"
 	"sample"
 	"strings"
 	"sync"
+	"time"
 	"variant"
 	"vcfmerge"
 
@@ -27,11 +32,14 @@ import (
 // dbconfig struct for db access
 //-----------------------------------------------
 type dbconfig struct {
-	Dbhost         string
-	Dbname         string
-	VarCollection  string
-	FpCollection   string
-	SampCollection string
+	Dbhost          string
+	Dbname          string
+	VarCollection   string
+	FpCollection    string
+	SampCollection  string
+	ExclCollection  string
+	AliasCollection string
+	MetaCollection  string
 }
 
 //-----------------------------------------------
@@ -68,6 +76,9 @@ type DBVariant struct {
 	MAF           float64
 	HWEP          float64
 	Infoscore     float64
+	MachRsq       float64
+	ImputeInfo    float64
+	DosageR2      float64
 	CR            float64
 	Missing       int
 	NumSamples    int
@@ -92,6 +103,36 @@ type DBSample struct {
 	SampleID  string `bson:"sample_id,omitempty"`
 }
 
+// DBSampleExclusion ...
+// struct for the mongodb sample exclusions collection,
+// an empty Assaytype excludes the sample from all assaytypes
+type DBSampleExclusion struct {
+	SampleID  string    `bson:"sample_id,omitempty"`
+	Assaytype string    `bson:"assaytype,omitempty"`
+	Reason    string    `bson:"reason,omitempty"`
+	Date      time.Time `bson:"date,omitempty"`
+}
+
+// DBSampleAlias ...
+// struct for the mongodb sample aliases collection, maps a per-panel
+// sample_id to the canonical subject_id (empty Assaytype for all panels)
+type DBSampleAlias struct {
+	Assaytype string `bson:"assaytype,omitempty"`
+	SampleID  string `bson:"sample_id,omitempty"`
+	SubjectID string `bson:"subject_id,omitempty"`
+}
+
+// DBSampleMeta ...
+// struct for the mongodb sample metadata collection, one document per
+// (canonical) sample id
+type DBSampleMeta struct {
+	SampleID    string    `bson:"sample_id,omitempty"`
+	InferredSex string    `bson:"inferred_sex,omitempty"`
+	XHetF       float64   `bson:"xhet_f"`
+	YCallRate   float64   `bson:"ycallrate"`
+	Date        time.Time `bson:"date,omitempty"`
+}
+
 // DBGeneMap ...
 // struct for the mongodb genemap collection
 type DBGeneMap struct {
@@ -150,6 +191,15 @@ func loadDbConfig() {
 	dbconf = dbconfig{}
 	err = decoder.Decode(&dbconf)
 	check("Cannot read dbconfig file", err)
+	if dbconf.ExclCollection == "" {
+		dbconf.ExclCollection = "sample_exclusions"
+	}
+	if dbconf.AliasCollection == "" {
+		dbconf.AliasCollection = "sample_aliases"
+	}
+	if dbconf.MetaCollection == "" {
+		dbconf.MetaCollection = "sample_meta"
+	}
 }
 
 func check(msg string, e error) {
@@ -164,6 +214,26 @@ func check(msg string, e error) {
 // NOTE: this function uses goroutines for parallel access to file resources
 //---------------------------------------------------------------------
 func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes map[string]bool, pthr float64) ([]DBVariant, []DBVariant, []string) {
+	variants, combinedVariants, combinedRecords, _, _ := GetallvardataForSamples(vcfPathPref, rsidList, requestedAssaytypes, pthr, nil,
+		genometrics.Collectors{})
+	return variants, combinedVariants, combinedRecords
+}
+
+// GetallvardataForSamples ...
+// as Getallvardata, restricted to the samples in sampleSet (a named sample
+// set, nil for all samples). Panel and combined metrics are calculated over
+// the selected samples only, panel records with none of the selected
+// samples are left out. Collectors that are set (concordance tally,
+// provenance audit) are filled while combining. Also returns the number of
+// sample columns in the requested assaytypes dropped by the exclusion list.
+// An error if sampleSet is empty or matches no sample columns
+//---------------------------------------------------------------------
+func GetallvardataForSamples(vcfPathPref string, rsidList []string, requestedAssaytypes map[string]bool, pthr float64, sampleSet []string,
+	collectors genometrics.Collectors) ([]DBVariant, []DBVariant, []string, int, error) {
+
+	if sampleSet != nil && len(sampleSet) == 0 {
+		return nil, nil, nil, 0, errors.New("sample set has no samples")
+	}
 
 	var wg sync.WaitGroup
 	// Control # of active goroutines (in this case also the # of open files)
@@ -180,7 +250,7 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 		for idx, variant := range variants {
 			if _, ok := requestedAssaytypes[variant.Assaytype]; ok {
 				wg.Add(1)
-				go getvarfiledata(filepaths[idx], variant, fileRecords, &wg)
+				go getvarfiledata(filepaths[idx], variant, fileRecords, &wg, fsem)
 			}
 		}
 	}
@@ -202,6 +272,22 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 	assaytypes := make(map[string]bool, 10) // 10 is a guess
 	assaytypeList := make([]string, 0)
 
+	// get all sample data from godb and organise into maps of maps:
+	// assaytype -> sample name -> sample posn (sampleNameMap)
+	// assaytype -> sample posn -> sample name (samplePosnMap)
+	sampleNameMap, samplePosnMap, exclCount := GetSamplesForAssaytypes(requestedAssaytypes)
+	if sampleSet != nil {
+		included := make(map[string]bool, len(sampleSet))
+		for _, samp := range sampleSet {
+			included[samp] = true
+		}
+		count := sample.RestrictSamples(sampleNameMap, samplePosnMap, included)
+		log.Printf("Sample set of %d, %d sample columns selected\n", len(sampleSet), count)
+		if count == 0 {
+			return nil, nil, nil, 0, fmt.Errorf("none of the %d samples in the sample set are in the genotype data", len(sampleSet))
+		}
+	}
+
 	lineCount := 0
 
 	// Read the channel of file records
@@ -224,8 +310,14 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 		dbvar.StartPosition = variant.GetPosn(prfx)
 		dbvar.EndPosition = dbvar.StartPosition
 		dbvar.AlleleA, dbvar.AlleleB = variant.GetAlleles(prfx)
-		dbvar.CR, dbvar.RefAF, dbvar.AltAF, dbvar.MAF, dbvar.HWEP, _, _, _, dbvar.NumSamples, dbvar.Missing, _, _ = genometrics.MetricsForRecord(fields[1:], pthr)
+		panelRec := selectSampleColumns(fields[1:], samplePosnMap[fields[0]])
+		if len(panelRec) == len(prfx) {
+			// no selected samples in this panel
+			continue
+		}
+		setVariantMetrics(&dbvar, genometrics.MetricsForRecord(panelRec, pthr))
 		dbvar.Infoscore = variant.GetInfoScore(prfx)
+		setImputeQuality(&dbvar, genometrics.ImputeQualityForRecord(panelRec))
 		dbvar.LineNum = lineCount
 		recdata.Probidx = variant.GetProbIdx(prfx)
 		// for determining combined rec size
@@ -241,10 +333,6 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 		rsidsData[dbvar.Rsid] = append(rsidsData[dbvar.Rsid], recdata)
 		variantList = append(variantList, dbvar)
 	}
-	// get all sample data from godb and organise into maps of maps:
-	// assaytype -> sample name -> sample posn (sampleNameMap)
-	// assaytype -> sample posn -> sample name (samplePosnMap)
-	sampleNameMap, samplePosnMap := GetSamplesByAssaytype()
 	// Condense all sample_names into a combined map samplename -> record position
 	combocols := sample.GetCombinedSampleMapByAssaytypes(sampleNameMap, assaytypeList)
 	// Get column headers as a single tab delimited string, with prefix in place, and as a list, both in postion order
@@ -257,6 +345,7 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 		if records, ok := rsids[rsid]; ok {
 			var rsidGenomet genometrics.AllMetrics
 			var dbvar DBVariant
+			rsidGenomet.Collectors = collectors
 			recStr := vcfmerge.CombineOne(records, rsidsData[rsid], rsid, samplePosnMap, combocols, comboNames, pthr, &rsidGenomet)
 			combinedRecords = append(combinedRecords, recStr)
 			fields := strings.Split(recStr, "\t")
@@ -270,13 +359,10 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 			dbvar.StartPosition = variant.GetPosn(prfx)
 			dbvar.EndPosition = dbvar.StartPosition
 			dbvar.AlleleA, dbvar.AlleleB = variant.GetAlleles(prfx)
-			dbvar.CR, dbvar.RefAF, dbvar.AltAF, dbvar.MAF, dbvar.HWEP, _, _, _, dbvar.NumSamples, dbvar.Missing, _, _ = genometrics.MetricsForRecord(fields, pthr)
+			setVariantMetrics(&dbvar, genometrics.MetricsForRecord(fields, pthr))
 			dbvar.Infoscore = variant.GetInfoScore(prfx)
-			if float64(rsidGenomet.OverlapTestCount) == 0.0 {
-				dbvar.Errpct = 0.0
-			} else {
-				dbvar.Errpct = (float64(rsidGenomet.MismatchCount) / float64(rsidGenomet.OverlapTestCount)) * 100.0
-			}
+			setImputeQuality(&dbvar, genometrics.ImputeQualityForRecord(fields))
+			dbvar.Errpct = genometrics.ErrPct(&rsidGenomet)
 			dbvar.LineNum = lineCount
 			//log.Printf("%s combined, SFX len = %d, samples=%d, miss=%d, dot=%d\n", rsid, len(sfx), dbvar.NumSamples, dbvar.Missing, dot)
 			log.Printf("%s combined, mismatch=%d, overlaps=%d, ErrPct=%.5f\n", rsid, rsidGenomet.MismatchCount, rsidGenomet.OverlapTestCount, dbvar.Errpct)
@@ -285,15 +371,206 @@ func Getallvardata(vcfPathPref string, rsidList []string, requestedAssaytypes ma
 			combinedVariantList = append(combinedVariantList, dbvar)
 		}
 	}
-	return variantList, combinedVariantList, combinedRecords
+	return variantList, combinedVariantList, combinedRecords, exclCount, nil
+}
+
+// selectSampleColumns ...
+// a panel record cut down to the sample columns still in the sample map
+// (after exclusions and sample set selection), metrics then cover only those
+// samples. The record is returned as is when no columns have been dropped
+// or the assaytype has no sample map
+//---------------------------------------------------------------------
+func selectSampleColumns(rec []string, posnName map[int]string) []string {
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	if posnName == nil || len(posnName) >= len(sfx) {
+		return rec
+	}
+	selected := make([]string, len(prfx), len(prfx)+len(posnName))
+	copy(selected, prfx)
+	for i, geno := range sfx {
+		if _, ok := posnName[i]; ok {
+			selected = append(selected, geno)
+		}
+	}
+	return selected
+}
+
+// GetRecordsByVarid ...
+// get the VCF records, assaytype in slot 0, for a list of rsids, mapped by rsid
+// plus the list of assaytypes found. Unlike Getallvardata records are not
+// combined, and the channel is read while files are being read so there is
+// no limit on the number of records. Sample columns are kept in file order,
+// with the genotypes of samples dropped by the exclusion list (as in
+// Getallvardata) set to "." so column positions still match the sample maps
+//---------------------------------------------------------------------
+func GetRecordsByVarid(vcfPathPref string, rsidList []string, requestedAssaytypes map[string]bool) (map[string][][]string, []string) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 64)
+	fileRecords := make(chan string, 10000)
+	_, samplePosnMap := GetSamplesByAssaytype()
+
+	go func() {
+		for _, rsid := range rsidList {
+			variants, filepaths := Getvardbdata(vcfPathPref, rsid)
+			for idx, variant := range variants {
+				if requestedAssaytypes[variant.Assaytype] {
+					wg.Add(1)
+					go getvarfiledata(filepaths[idx], variant, fileRecords, &wg, sem)
+				}
+			}
+		}
+		wg.Wait()
+		close(fileRecords)
+	}()
+
+	rsids := make(map[string][][]string, len(rsidList))
+	assaytypes := make(map[string]bool, 10)
+	assaytypeList := make([]string, 0)
+	for record := range fileRecords {
+		fields := strings.Split(record, "\t")
+		if _, ok := assaytypes[fields[0]]; !ok {
+			assaytypes[fields[0]] = true
+			assaytypeList = append(assaytypeList, fields[0])
+		}
+		maskSampleColumns(fields[1:], samplePosnMap[fields[0]])
+		varid := variant.GetVarid(fields[1:])
+		rsids[varid] = append(rsids[varid], fields)
+	}
+	return rsids, assaytypeList
 }
 
+// GetPositionOrderedRecords ...
+// sample names and combined records (split into fields) in position order,
+// for tools that LD prune. Records are streamed from a combined VCF file
+// (vcfPath, filemergevcf or vcombine output), which must already be in
+// position order, or if vcfPath is "" combined by Getallvardata for the rs
+// numbers in rsFilePath and sorted
+//---------------------------------------------------------------------
+func GetPositionOrderedRecords(vcfPath string, rsFilePath string, vcfPathPref string, requestedAssaytypes map[string]bool,
+	pthr float64) ([]string, <-chan []string) {
+	records := make(chan []string, 1000)
+	if vcfPath == "" {
+		rsidList := make([]string, 0, 1000)
+		f, err := os.Open(rsFilePath)
+		check("godb: Cannot open rsid file", err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rsidList = append(rsidList, scanner.Text())
+		}
+		_, _, genorecs := Getallvardata(vcfPathPref, rsidList, requestedAssaytypes, pthr)
+		if len(genorecs) < 2 {
+			log.Fatal("No genotype records found for the rsids in " + rsFilePath)
+		}
+		// records come in rsid file order
+		variant.SortRecordsByPosition(genorecs[1:])
+		_, sampleNames := variant.GetVCFPrfxSfx(strings.Split(genorecs[0], "\t"))
+		go func() {
+			for _, record := range genorecs[1:] {
+				records <- strings.Split(record, "\t")
+			}
+			close(records)
+		}()
+		return sampleNames, records
+	}
+
+	f, err := os.Open(vcfPath)
+	check("godb: Cannot open VCF file", err)
+	rdr := bufio.NewReader(f)
+	if strings.HasSuffix(vcfPath, ".gz") {
+		gr, err := gzip.NewReader(f)
+		check("godb: Cannot read gzipped VCF file", err)
+		rdr = bufio.NewReader(gr)
+	}
+	var sampleNames []string
+	for {
+		text, err := rdr.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		check("godb: VCF header read error", err)
+		if strings.HasPrefix(text, "#CHROM") {
+			_, sampleNames = variant.GetVCFPrfxSfx(strings.Split(strings.TrimRight(text, "\n"), "\t"))
+			break
+		}
+	}
+	go func() {
+		defer f.Close()
+		prevChrom, prevPosn := "", 0
+		chromsSeen := make(map[string]bool)
+		for {
+			text, err := rdr.ReadString('\n')
+			if err == io.EOF {
+				break
+			}
+			check("godb: VCF read error", err)
+			text = strings.TrimRight(text, "\n")
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			fields := strings.Split(text, "\t")
+			chrom, posn := variant.GetChrom(fields), variant.GetPosn(fields)
+			if (chrom == prevChrom && posn < prevPosn) || (chrom != prevChrom && chromsSeen[chrom]) {
+				// vcombine output is in rsid order
+				log.Fatalf("%s is not in position order at %s:%d, sort it first\n", vcfPath, chrom, posn)
+			}
+			prevChrom, prevPosn = chrom, posn
+			chromsSeen[chrom] = true
+			records <- fields
+		}
+		close(records)
+	}()
+	return sampleNames, records
+}
+
+// maskSampleColumns ...
+// set the genotypes of sample columns not in the sample map to "." (in
+// place), a record is left as is if the assaytype has no sample map
+//---------------------------------------------------------------------
+func maskSampleColumns(rec []string, posnName map[int]string) {
+	if posnName == nil {
+		return
+	}
+	prfx, sfx := variant.GetVCFPrfxSfx(rec)
+	if len(posnName) >= len(sfx) {
+		return
+	}
+	for i := range sfx {
+		if _, ok := posnName[i]; !ok {
+			rec[len(prfx)+i] = "."
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+// copy record metrics into the DBVariant fields displayed / returned
 //------------------------------------------------------------------------------
-// wrap the godb.Getvarfiledata func, for use as a goroutine
+func setVariantMetrics(dbvar *DBVariant, vm genometrics.VariantMetrics) {
+	(*dbvar).CR = vm.CallRate
+	(*dbvar).RefAF = vm.RefAF
+	(*dbvar).AltAF = vm.AltAF
+	(*dbvar).MAF = vm.MAF
+	(*dbvar).HWEP = vm.HWEP
+	(*dbvar).NumSamples = vm.N
+	(*dbvar).Missing = vm.Missing
+}
+
 //------------------------------------------------------------------------------
-func getvarfiledata(f string, dbv DBVariant, recs chan string, wg *sync.WaitGroup) {
-	fsem <- struct{}{}
-	defer func() { <-fsem }()
+// copy imputation quality, re-estimated from GP / DS, into the DBVariant
+//------------------------------------------------------------------------------
+func setImputeQuality(dbvar *DBVariant, iq genometrics.ImputeQuality) {
+	(*dbvar).MachRsq = iq.MachRsq
+	(*dbvar).ImputeInfo = iq.ImputeInfo
+	(*dbvar).DosageR2 = iq.DosageR2
+}
+
+//------------------------------------------------------------------------------
+// wrap the godb.Getvarfiledata func, for use as a goroutine, sem limits the
+// number of open files
+//------------------------------------------------------------------------------
+func getvarfiledata(f string, dbv DBVariant, recs chan string, wg *sync.WaitGroup, sem chan struct{}) {
+	sem <- struct{}{}
+	defer func() { <-sem }()
 	Getvarfiledata(f, dbv, recs)
 	wg.Done()
 }
@@ -394,32 +671,356 @@ func GetvarfiledataByRange(f string, dbv DBVariant) interfaces.RelatableIterator
 	return rdr
 }
 
+// GetRegionVarids ...
+// rsids, in position order, for variants within window bp either side of an
+// index rsid in the requested assaytypes. The index rsid is included
+func GetRegionVarids(rsid string, window int, requestedAssaytypes map[string]bool) []string {
+	variants := session.DB(dbconf.Dbname).C(dbconf.VarCollection)
+
+	index := DBVariant{}
+	varidList := make([]string, 0, 100)
+	err := variants.Find(bson.M{"rsid": rsid}).One(&index)
+	if err != nil {
+		log.Printf("##NOT FOUND %s (region index)\n", rsid)
+		return varidList
+	}
+	dbvariant := DBVariant{}
+	seen := make(map[string]bool)
+
+	find := variants.Find(bson.M{"chromosome": index.Chromosome,
+		"position": bson.M{"$gte": index.StartPosition - window, "$lte": index.StartPosition + window}}).Sort("position")
+
+	items := find.Iter()
+	for items.Next(&dbvariant) {
+		if _, ok := requestedAssaytypes[dbvariant.Assaytype]; !ok || dbvariant.Rsid == "." {
+			continue
+		}
+		if !seen[dbvariant.Rsid] {
+			seen[dbvariant.Rsid] = true
+			varidList = append(varidList, dbvariant.Rsid)
+		}
+	}
+	return varidList
+}
+
+// GetPositionVarid ...
+// rsid of a variant at chrom:posn in the requested assaytypes whose alleles
+// include the effect allele and, if given, the other allele (on either
+// strand). "" if there is none
+func GetPositionVarid(chrom string, posn int, ea string, oa string, requestedAssaytypes map[string]bool) string {
+	variants := session.DB(dbconf.Dbname).C(dbconf.VarCollection)
+
+	dbvariant := DBVariant{}
+	find := variants.Find(bson.M{"chromosome": chrom, "position": posn})
+
+	items := find.Iter()
+	for items.Next(&dbvariant) {
+		if _, ok := requestedAssaytypes[dbvariant.Assaytype]; !ok || dbvariant.Rsid == "." {
+			continue
+		}
+		alleles := map[string]bool{strings.ToUpper(dbvariant.AlleleA): true, strings.ToUpper(dbvariant.AlleleB): true}
+		if allelesMatch(alleles, ea, oa) || allelesMatch(alleles, variant.Complement(ea), variant.Complement(oa)) {
+			return dbvariant.Rsid
+		}
+	}
+	log.Printf("##NOT FOUND %s:%d %s/%s (position)\n", chrom, posn, ea, oa)
+	return ""
+}
+
+func allelesMatch(alleles map[string]bool, ea string, oa string) bool {
+	return alleles[ea] && (oa == "" || alleles[oa])
+}
+
+// GetMultiAssayVarids ...
+// Walk the variants collection and return the rsids found in more than one
+// of the requested assaytypes, in collection order
+func GetMultiAssayVarids(requestedAssaytypes map[string]bool) []string {
+	variants := session.DB(dbconf.Dbname).C(dbconf.VarCollection)
+
+	dbvariant := DBVariant{}
+	varidAssaytypes := make(map[string]map[string]bool)
+	varidList := make([]string, 0, 1000)
+
+	find := variants.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&dbvariant) {
+		if _, ok := requestedAssaytypes[dbvariant.Assaytype]; !ok || dbvariant.Rsid == "." {
+			continue
+		}
+		if _, ok := varidAssaytypes[dbvariant.Rsid]; !ok {
+			varidAssaytypes[dbvariant.Rsid] = make(map[string]bool)
+		}
+		varidAssaytypes[dbvariant.Rsid][dbvariant.Assaytype] = true
+		if len(varidAssaytypes[dbvariant.Rsid]) == 2 {
+			varidList = append(varidList, dbvariant.Rsid)
+		}
+	}
+	return varidList
+}
+
+// GetVaridChroms ...
+// chromosome for each of a list of rsids found in the requested
+// assaytypes, walking the variants collection once
+func GetVaridChroms(rsidList []string, requestedAssaytypes map[string]bool) map[string]string {
+	variants := session.DB(dbconf.Dbname).C(dbconf.VarCollection)
+
+	wanted := make(map[string]bool, len(rsidList))
+	for _, rsid := range rsidList {
+		wanted[rsid] = true
+	}
+	dbvariant := DBVariant{}
+	varidChroms := make(map[string]string, len(rsidList))
+
+	find := variants.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&dbvariant) {
+		if _, ok := requestedAssaytypes[dbvariant.Assaytype]; !ok || !wanted[dbvariant.Rsid] {
+			continue
+		}
+		if _, ok := varidChroms[dbvariant.Rsid]; !ok {
+			varidChroms[dbvariant.Rsid] = dbvariant.Chromosome
+		}
+	}
+	return varidChroms
+}
+
+// GetChromVarids ...
+// rsids, in position order within each chromosome, for variants on any of
+// a list of chromosome names (e.g. "X", "23") in the requested assaytypes
+func GetChromVarids(chroms []string, requestedAssaytypes map[string]bool) []string {
+	variants := session.DB(dbconf.Dbname).C(dbconf.VarCollection)
+
+	dbvariant := DBVariant{}
+	seen := make(map[string]bool)
+	varidList := make([]string, 0, 1000)
+
+	find := variants.Find(bson.M{"chromosome": bson.M{"$in": chroms}}).Sort("chromosome", "position")
+
+	items := find.Iter()
+	for items.Next(&dbvariant) {
+		if _, ok := requestedAssaytypes[dbvariant.Assaytype]; !ok || dbvariant.Rsid == "." {
+			continue
+		}
+		if !seen[dbvariant.Rsid] {
+			seen[dbvariant.Rsid] = true
+			varidList = append(varidList, dbvariant.Rsid)
+		}
+	}
+	return varidList
+}
+
 // GetSamplesByAssaytype ...
 // Get all samplea, for all AssayTypes
 // and their array indexes in the relevant VCF data
+// Sample ids are replaced by canonical subject ids (sample aliases), and
+// the exclusion list, matched on either the sample id or the subject id,
+// applied
 // NOTE:  this returns two maps of map:
 //   assaytype to sample_name to index
 //   assaytype to index to sample_name
 func GetSamplesByAssaytype() (map[string]map[string]int, map[string]map[int]string) {
+	sampleNamePosn, samplePosnName, _ := GetSamplesForAssaytypes(nil)
+	return sampleNamePosn, samplePosnName
+}
+
+// GetSamplesForAssaytypes ...
+// sample maps as GetSamplesByAssaytype for the requested assaytypes only
+// (nil for all), plus the number of their sample columns dropped by the
+// exclusion list
+func GetSamplesForAssaytypes(requestedAssaytypes map[string]bool) (map[string]map[string]int, map[string]map[int]string, int) {
 	sampleNamePosn := make(map[string]map[string]int)
 	samplePosnName := make(map[string]map[int]string)
 
 	samp := session.DB(dbconf.Dbname).C(dbconf.SampCollection)
 
-	sample := DBSample{}
+	dbsample := DBSample{}
 
 	find := samp.Find(bson.M{})
 
 	items := find.Iter()
-	for items.Next(&sample) {
-		if _, ok := sampleNamePosn[sample.Assaytype]; !ok {
-			sampleNamePosn[sample.Assaytype] = make(map[string]int)
-			samplePosnName[sample.Assaytype] = make(map[int]string)
+	for items.Next(&dbsample) {
+		if requestedAssaytypes != nil && !requestedAssaytypes[dbsample.Assaytype] {
+			continue
+		}
+		if _, ok := sampleNamePosn[dbsample.Assaytype]; !ok {
+			sampleNamePosn[dbsample.Assaytype] = make(map[string]int)
+			samplePosnName[dbsample.Assaytype] = make(map[int]string)
 		}
-		sampleNamePosn[sample.Assaytype][sample.SampleID] = sample.ListPosn
-		samplePosnName[sample.Assaytype][sample.ListPosn] = sample.SampleID
+		sampleNamePosn[dbsample.Assaytype][dbsample.SampleID] = dbsample.ListPosn
+		samplePosnName[dbsample.Assaytype][dbsample.ListPosn] = dbsample.SampleID
 	}
-	return sampleNamePosn, samplePosnName
+	// exclusions match per-panel sample ids as well as canonical subject ids
+	excluded := GetExcludedSampleMap()
+	exclCount := sample.ExcludeSamples(sampleNamePosn, samplePosnName, excluded)
+	aliasCount := sample.ApplyAliases(sampleNamePosn, samplePosnName, GetSampleAliases())
+	if aliasCount > 0 {
+		log.Printf("Sample aliases applied to %d samples\n", aliasCount)
+	}
+	exclCount += sample.ExcludeSamples(sampleNamePosn, samplePosnName, excluded)
+	if exclCount > 0 {
+		log.Printf("Sample exclusion list applied, %d sample columns dropped\n", exclCount)
+	}
+	return sampleNamePosn, samplePosnName, exclCount
+}
+
+// GetSampleAliases ...
+// Get all sample aliases, as assaytype to sample_id to subject_id
+func GetSampleAliases() map[string]map[string]string {
+	aliases := make(map[string]map[string]string)
+
+	alias := session.DB(dbconf.Dbname).C(dbconf.AliasCollection)
+
+	sampleAlias := DBSampleAlias{}
+
+	find := alias.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&sampleAlias) {
+		if _, ok := aliases[sampleAlias.Assaytype]; !ok {
+			aliases[sampleAlias.Assaytype] = make(map[string]string)
+		}
+		aliases[sampleAlias.Assaytype][sampleAlias.SampleID] = sampleAlias.SubjectID
+	}
+	return aliases
+}
+
+// InsertSampleAlias ...
+// Add or replace the subject id for a sample_id in an assaytype
+func InsertSampleAlias(assaytype string, sampleID string, subjectID string) bool {
+	alias := session.DB(dbconf.Dbname).C(dbconf.AliasCollection)
+
+	_, err := alias.Upsert(bson.M{"assaytype": assaytype, "sample_id": sampleID},
+		bson.M{"assaytype": assaytype, "sample_id": sampleID, "subject_id": subjectID})
+	check("Sample alias upsert error", err)
+	return true
+}
+
+// GetSampleAliasAudit ...
+// Original per-panel sample ids against the subject ids used in combined
+// output, one tab delimited record per sample: subject_id, assaytype,
+// sample_id, list_posn, aliased (1/0)
+func GetSampleAliasAudit(requestedAssaytypes map[string]bool) []string {
+	aliases := GetSampleAliases()
+	audit := make([]string, 0, 1000)
+
+	samp := session.DB(dbconf.Dbname).C(dbconf.SampCollection)
+
+	dbsample := DBSample{}
+
+	find := samp.Find(bson.M{}).Sort("assaytype", "list_posn")
+
+	items := find.Iter()
+	for items.Next(&dbsample) {
+		if len(requestedAssaytypes) > 0 && !requestedAssaytypes[dbsample.Assaytype] {
+			continue
+		}
+		subject, ok := aliases[dbsample.Assaytype][dbsample.SampleID]
+		if !ok {
+			subject, ok = aliases[""][dbsample.SampleID]
+		}
+		aliased := 1
+		if !ok {
+			subject = dbsample.SampleID
+			aliased = 0
+		}
+		audit = append(audit, fmt.Sprintf("%s\t%s\t%s\t%d\t%d", subject, dbsample.Assaytype, dbsample.SampleID, dbsample.ListPosn, aliased))
+	}
+	return audit
+}
+
+// GetSampleExclusions ...
+// Get the full sample exclusion list
+func GetSampleExclusions() []DBSampleExclusion {
+	exclList := make([]DBSampleExclusion, 0, 10)
+
+	excl := session.DB(dbconf.Dbname).C(dbconf.ExclCollection)
+
+	exclusion := DBSampleExclusion{}
+
+	find := excl.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&exclusion) {
+		exclList = append(exclList, exclusion)
+	}
+	return exclList
+}
+
+// GetExcludedSampleMap ...
+// sample_id to the assaytypes it is excluded from (sample.AllAssaytypes for
+// all), as used by sample.ExcludeSamples
+func GetExcludedSampleMap() map[string]map[string]bool {
+	excluded := make(map[string]map[string]bool)
+	for _, exclusion := range GetSampleExclusions() {
+		sample.AddExclusion(excluded, exclusion.SampleID, exclusion.Assaytype)
+	}
+	return excluded
+}
+
+// ExclusionProvenance ...
+// VCF meta-information line recording the number of sample columns the
+// exclusion list dropped from output
+func ExclusionProvenance(exclCount int) string {
+	return fmt.Sprintf("##godbExcludedSamples=%d", exclCount)
+}
+
+// InsertSampleExclusion ...
+// Add a sample to the exclusion list, dated now. False if already excluded
+// for the same assaytype
+func InsertSampleExclusion(sampleID string, assaytype string, reason string) bool {
+	excl := session.DB(dbconf.Dbname).C(dbconf.ExclCollection)
+
+	exclusion := DBSampleExclusion{}
+	err := excl.Find(bson.M{"sample_id": sampleID, "assaytype": assaytype}).One(&exclusion)
+	if err == nil {
+		return false
+	}
+	dbdata := bson.M{"sample_id": sampleID, "assaytype": assaytype, "reason": reason, "date": time.Now()}
+	err = excl.Insert(dbdata)
+	check("Sample exclusion insert error", err)
+	return true
+}
+
+// RemoveSampleExclusion ...
+// Remove a sample from the exclusion list (all entries for the sample)
+func RemoveSampleExclusion(sampleID string) int {
+	excl := session.DB(dbconf.Dbname).C(dbconf.ExclCollection)
+
+	info, err := excl.RemoveAll(bson.M{"sample_id": sampleID})
+	check("Sample exclusion remove error", err)
+	return info.Removed
+}
+
+// GetSampleMeta ...
+// Get sample metadata, by sample id
+func GetSampleMeta() map[string]DBSampleMeta {
+	metaMap := make(map[string]DBSampleMeta)
+
+	meta := session.DB(dbconf.Dbname).C(dbconf.MetaCollection)
+
+	sampleMeta := DBSampleMeta{}
+
+	find := meta.Find(bson.M{})
+
+	items := find.Iter()
+	for items.Next(&sampleMeta) {
+		metaMap[sampleMeta.SampleID] = sampleMeta
+	}
+	return metaMap
+}
+
+// SetSampleSex ...
+// Add or replace the inferred sex, X heterozygosity F and Y call rate for a
+// sample, dated now
+func SetSampleSex(sampleID string, sex string, xhetF float64, yCallRate float64) bool {
+	meta := session.DB(dbconf.Dbname).C(dbconf.MetaCollection)
+
+	_, err := meta.Upsert(bson.M{"sample_id": sampleID},
+		bson.M{"$set": bson.M{"inferred_sex": sex, "xhet_f": xhetF, "ycallrate": yCallRate, "date": time.Now()}})
+	check("Sample meta upsert error", err)
+	return true
 }
 
 // FormatOutput ...
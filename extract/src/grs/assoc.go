@@ -0,0 +1,253 @@
+package grs
+
+//
+// GRS association with a phenotype: the score is standardised (mean 0,
+// SD 1) over samples with both a score and a phenotype value, so effects
+// are per SD of score. Continuous phenotypes: linear regression of
+// phenotype on score. Binary phenotypes: logistic regression, OR per SD,
+// and ORs for each score quantile against a reference quantile from a
+// logistic model with quantile indicators
+//
+import (
+	"assoc"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AssocParams ...
+// Binary for a case/control phenotype, Quantiles (e.g. 4, 5, 10) and the
+// Reference quantile (1 = lowest scores) for quantile ORs
+type AssocParams struct {
+	Binary    bool
+	Quantiles int
+	Reference int
+}
+
+// QuantileOR ...
+// one score quantile, OR and 95% CI against the reference quantile
+type QuantileOR struct {
+	Quantile  int
+	N         int
+	Cases     int
+	Min       float64
+	Max       float64
+	OR        float64
+	Lower     float64
+	Upper     float64
+	P         float64
+	Reference bool
+	Message   string
+}
+
+// AssocResult ...
+// Beta (per SD of score) with SE and p, OR and 95% CI for binary
+// phenotypes, R2 for continuous
+type AssocResult struct {
+	N         int
+	Cases     int
+	Controls  int
+	Mean      float64
+	SD        float64
+	Beta      float64
+	SE        float64
+	Stat      float64
+	P         float64
+	OR        float64
+	Lower     float64
+	Upper     float64
+	R2        float64
+	Converged bool
+	Quantiles []QuantileOR
+	Message   string
+}
+
+// GrsAssoc ...
+// association of scores (sample id to score) with phenotype values (sample
+// id to value, as stored in ehrdb)
+func GrsAssoc(scores map[string]float64, pheno map[string]string, params AssocParams) AssocResult {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		if _, ok := assoc.ParsePhenoValue(pheno[id]); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	res := AssocResult{N: len(ids)}
+	if res.N < 3 {
+		res.Message = "fewer than 3 samples with a score and phenotype"
+		return res
+	}
+	x := make([]float64, res.N)
+	y := make([]float64, res.N)
+	for i, id := range ids {
+		x[i] = scores[id]
+		y[i], _ = assoc.ParsePhenoValue(pheno[id])
+	}
+	for _, xi := range x {
+		res.Mean += xi
+	}
+	res.Mean /= float64(res.N)
+	for _, xi := range x {
+		res.SD += (xi - res.Mean) * (xi - res.Mean)
+	}
+	res.SD = math.Sqrt(res.SD / float64(res.N-1))
+	if res.SD == 0.0 {
+		res.Message = "score is constant"
+		return res
+	}
+	xs := make([][]float64, res.N)
+	for i, xi := range x {
+		xs[i] = []float64{(xi - res.Mean) / res.SD}
+	}
+
+	if !params.Binary {
+		fit, err := assoc.LinearRegression(y, xs)
+		if err != nil {
+			res.Message = err.Error()
+			return res
+		}
+		res.Beta, res.SE, res.Stat, res.P, res.R2, res.Converged = fit.Beta[1], fit.SE[1], fit.Stat[1], fit.P[1], fit.R2, true
+		return res
+	}
+
+	yc, ok := assoc.CaseControlCoding(y)
+	if !ok {
+		res.Message = "phenotype values are not 0/1 or 1/2 case/control"
+		return res
+	}
+	for _, yi := range yc {
+		if yi == 1.0 {
+			res.Cases++
+		}
+	}
+	res.Controls = res.N - res.Cases
+	if res.Cases == 0 || res.Controls == 0 {
+		res.Message = "no cases or no controls"
+		return res
+	}
+	fit, err := assoc.LogisticRegression(yc, xs)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Beta, res.SE, res.Stat, res.P, res.Converged = fit.Beta[1], fit.SE[1], fit.Stat[1], fit.P[1], fit.Converged
+	res.OR, res.Lower, res.Upper = oddsRatio(res.Beta, res.SE)
+	if !fit.Converged {
+		res.Message = "logistic regression did not converge"
+	}
+	res.Quantiles = quantileORs(x, yc, params)
+	return res
+}
+
+// OR and 95% CI from a log odds and SE
+func oddsRatio(beta float64, se float64) (float64, float64, float64) {
+	return math.Exp(beta), math.Exp(beta - 1.96*se), math.Exp(beta + 1.96*se)
+}
+
+// score quantile ORs against the reference quantile
+func quantileORs(x []float64, yc []float64, params AssocParams) []QuantileOR {
+	nq := params.Quantiles
+	if nq < 2 || nq > len(x) {
+		return nil
+	}
+	ref := params.Reference
+	if ref < 1 || ref > nq {
+		ref = 1
+	}
+	order := make([]int, len(x))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return x[order[a]] < x[order[b]] })
+	quantile := make([]int, len(x))
+	for rank, i := range order {
+		quantile[i] = rank*nq/len(x) + 1
+	}
+	qors := make([]QuantileOR, nq)
+	for q := range qors {
+		qors[q] = QuantileOR{Quantile: q + 1, Min: math.Inf(1), Max: math.Inf(-1), Reference: q+1 == ref, OR: 1.0,
+			Lower: 1.0, Upper: 1.0, P: 1.0}
+	}
+	for i, q := range quantile {
+		qor := &qors[q-1]
+		qor.N++
+		if yc[i] == 1.0 {
+			qor.Cases++
+		}
+		qor.Min = math.Min(qor.Min, x[i])
+		qor.Max = math.Max(qor.Max, x[i])
+	}
+	// indicators for each non-reference quantile
+	xq := make([][]float64, len(x))
+	for i, q := range quantile {
+		xq[i] = make([]float64, 0, nq-1)
+		for c := 1; c <= nq; c++ {
+			if c == ref {
+				continue
+			}
+			ind := 0.0
+			if q == c {
+				ind = 1.0
+			}
+			xq[i] = append(xq[i], ind)
+		}
+	}
+	fit, err := assoc.LogisticRegression(yc, xq)
+	col := 1
+	for c := 1; c <= nq; c++ {
+		if c == ref {
+			continue
+		}
+		qor := &qors[c-1]
+		if err != nil {
+			qor.Message = err.Error()
+			continue
+		}
+		qor.OR, qor.Lower, qor.Upper = oddsRatio(fit.Beta[col], fit.SE[col])
+		qor.P = fit.P[col]
+		col++
+		// with no cases (or no controls) in a quantile its log odds run off
+		// until the iteration limit, so the OR and CI mean nothing
+		if qor.Cases == 0 || qor.Cases == qor.N {
+			qor.Message = "no cases or no controls in quantile, OR not estimable"
+		} else if !fit.Converged {
+			qor.Message = "logistic regression did not converge"
+		}
+	}
+	return qors
+}
+
+// AssocHeader ...
+// column headers for AssocResult CSV output
+const AssocHeader = "n,cases,controls,score_mean,score_sd,beta_per_sd,se,stat,p,or_per_sd,or_l95,or_u95,r2,converged,message"
+
+// QuantileHeader ...
+// column headers for QuantileOR CSV output
+const QuantileHeader = "quantile,n,cases,score_min,score_max,or,or_l95,or_u95,p,reference,message"
+
+// CSV ...
+func (res AssocResult) CSV() string {
+	return fmt.Sprintf("%d,%d,%d,%.6f,%.6f,%.6f,%.6f,%.4f,%.4e,%.4f,%.4f,%.4f,%.4f,%t,%s", res.N, res.Cases, res.Controls,
+		res.Mean, res.SD, res.Beta, res.SE, res.Stat, res.P, res.OR, res.Lower, res.Upper, res.R2, res.Converged,
+		assoc.CSVField(res.Message))
+}
+
+// CSV ...
+func (qor QuantileOR) CSV() string {
+	return fmt.Sprintf("%d,%d,%d,%.6f,%.6f,%.4f,%.4f,%.4f,%.4e,%t,%s", qor.Quantile, qor.N, qor.Cases, qor.Min, qor.Max,
+		qor.OR, qor.Lower, qor.Upper, qor.P, qor.Reference, assoc.CSVField(qor.Message))
+}
+
+// CSVLines ...
+// result and quantile tables as CSV lines, a blank line between
+func (res AssocResult) CSVLines() []string {
+	lines := []string{AssocHeader, res.CSV()}
+	if len(res.Quantiles) > 0 {
+		lines = append(lines, "", QuantileHeader)
+		for _, qor := range res.Quantiles {
+			lines = append(lines, qor.CSV())
+		}
+	}
+	return lines
+}
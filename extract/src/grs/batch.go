@@ -0,0 +1,186 @@
+package grs
+
+//
+// Batch scoring: several GRS scored in one pass over the combined records
+// for the union of their SNPs. Genotype values for a record are read once
+// and accumulated into every GRS that includes the SNP, each with its own
+// effect allele matching
+//
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// GrsSet ...
+// one named GRS: effect alleles, EAFs and weights by varid
+type GrsSet struct {
+	Name string
+	EAs  map[string]string
+	EAFs map[string]float64
+	Wgts map[string]float64
+}
+
+// NewGrsSet ...
+// GrsSet from GRS input lines (varid,ea,eaf,wgt header first)
+func NewGrsSet(name string, grsLines []string) GrsSet {
+	_, eaMap, eafMap, wgtMap := GetGrsMaps(grsLines)
+	return GrsSet{Name: name, EAs: eaMap, EAFs: eafMap, Wgts: wgtMap}
+}
+
+// BatchScores ...
+// per GRS (in Names order) scores in sample id order and matching reports
+type BatchScores struct {
+	Names   []string
+	Samples []string
+	Scores  [][]SampleScore
+	Matches [][]SNPMatch
+}
+
+// UnionVarids ...
+// sorted varids in any of the sets, the extraction list for a batch
+func UnionVarids(sets []GrsSet) []string {
+	seen := make(map[string]bool)
+	varids := make([]string, 0)
+	for _, set := range sets {
+		for varid := range set.EAs {
+			if !seen[varid] {
+				seen[varid] = true
+				varids = append(varids, varid)
+			}
+		}
+	}
+	sort.Strings(varids)
+	return varids
+}
+
+// GetBatchScores ...
+// Score combined records (header first) for every set, as
+// GetScoresWithParams for each set but reading each record once
+//---------------------------------------------------------------------
+func GetBatchScores(records []string, sets []GrsSet, params ScoreParams) BatchScores {
+	_, sampleData := variant.GetVCFPrfxSfx(strings.Split(records[0], "\t"))
+	batch := BatchScores{Names: make([]string, len(sets)), Samples: make([]string, len(sampleData)),
+		Scores: make([][]SampleScore, len(sets)), Matches: make([][]SNPMatch, len(sets))}
+	copy(batch.Samples, sampleData)
+	found := make([]map[string]bool, len(sets))
+	for s, set := range sets {
+		batch.Names[s] = set.Name
+		batch.Scores[s] = make([]SampleScore, len(sampleData))
+		for i, sampleID := range sampleData {
+			batch.Scores[s][i].SampleID = sampleID
+		}
+		batch.Matches[s] = make([]SNPMatch, 0, len(set.EAs))
+		found[s] = make(map[string]bool, len(set.EAs))
+	}
+	values := make([]float64, len(sampleData))
+	called := make([]bool, len(sampleData))
+
+	for _, record := range records[1:] {
+		recData := strings.Split(record, "\t")
+		prfx, genoData := variant.GetVCFPrfxSfx(recData)
+		varid := variant.GetVarid(prfx)
+		inSets := make([]int, 0, len(sets))
+		for s, set := range sets {
+			if _, ok := set.EAs[varid]; ok {
+				inSets = append(inSets, s)
+			}
+		}
+		if len(inSets) == 0 {
+			continue
+		}
+		refAllele, altAllele := variant.GetAlleles(prfx)
+		probidx := variant.GetProbIdx(prfx)
+		dsidx := variant.GetDosageIdx(prfx)
+		sum, n := 0.0, 0
+		for i := range values {
+			values[i], called[i] = 0.0, false
+			if i >= len(genoData) {
+				continue
+			}
+			if params.Mode == ModeDosage {
+				values[i], called[i] = variant.GetDosage(genoData[i], probidx, dsidx)
+			} else {
+				values[i], called[i] = variant.GetHardCall(genoData[i], params.Threshold, probidx)
+			}
+			if called[i] {
+				sum += values[i]
+				n++
+			}
+		}
+		altAF := -1.0
+		if n > 0 {
+			altAF = sum / float64(2*n)
+		}
+		for _, s := range inSets {
+			set := sets[s]
+			ea := set.EAs[varid]
+			found[s][varid] = true
+			snp := MatchAllele(SNPMatch{Varid: varid, Chrom: variant.GetChrom(prfx), Posn: variant.GetPosnStr(prfx),
+				Ref: refAllele, Alt: altAllele, EA: ea, EAF: set.EAFs[varid]}, altAF, params.PalindromeMargin)
+			batch.Matches[s] = append(batch.Matches[s], snp)
+			if snp.Status == MatchDropped {
+				log.Printf("REJect: %s %s [%s,%s,%s] %s\n", set.Name, varid, refAllele, altAllele, ea, snp.Reason)
+				continue
+			}
+			eaf, ok := set.EAFs[varid]
+			if !ok || eaf <= 0.0 || eaf >= 1.0 {
+				eaf = math.Max(snp.CohortEAF, 0.0)
+			}
+			wgt := set.Wgts[varid]
+			scores := batch.Scores[s]
+			for i := range scores {
+				if called[i] {
+					value := values[i]
+					if snp.Flipped {
+						value = 2.0 - value
+					}
+					scores[i].Score += value * wgt
+					scores[i].SNPCount++
+				} else if params.Impute && i < len(genoData) {
+					scores[i].Score += 2.0 * eaf * wgt
+					scores[i].Imputed++
+				}
+			}
+		}
+	}
+	for s, set := range sets {
+		scores := batch.Scores[s]
+		if params.Norm == NormAverage {
+			for i := range scores {
+				if alleles := 2 * (scores[i].SNPCount + scores[i].Imputed); alleles > 0 {
+					scores[i].Score /= float64(alleles)
+				}
+			}
+		}
+		sort.SliceStable(scores, func(a, b int) bool { return scores[a].SampleID < scores[b].SampleID })
+		batch.Matches[s] = append(batch.Matches[s], NotFoundMatches(set.EAs, set.EAFs, found[s])...)
+	}
+	sort.Strings(batch.Samples)
+	return batch
+}
+
+// WideHeader ...
+// column headers for WideLines output: sample then one column per GRS
+func (batch BatchScores) WideHeader() string {
+	return "sample," + strings.Join(batch.Names, ",")
+}
+
+// WideLines ...
+// sample x score table, header first, one row per sample in sample id order
+func (batch BatchScores) WideLines() []string {
+	lines := make([]string, 0, len(batch.Samples)+1)
+	lines = append(lines, batch.WideHeader())
+	for i, sampleID := range batch.Samples {
+		row := make([]string, 0, len(batch.Names)+1)
+		row = append(row, sampleID)
+		for s := range batch.Names {
+			row = append(row, fmt.Sprintf("%.6f", batch.Scores[s][i].Score))
+		}
+		lines = append(lines, strings.Join(row, ","))
+	}
+	return lines
+}
@@ -0,0 +1,226 @@
+package grs
+
+//
+// Clumping and thresholding (C+T) GRS construction from GWAS summary
+// statistics. SNPs are clumped once, greedily in p-value order as PLINK
+// --clump: each unclumped SNP with p <= P1 becomes an index SNP and takes
+// the unclumped SNPs within Window bp with p <= P2 and r2 >= R2 from the
+// combined genotypes. A threshold t then selects the index SNPs with
+// p <= t, weighted by their beta
+//
+import (
+	"errors"
+	"fmt"
+	"ld"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SumStat ...
+// one summary statistics row, EAF -1 if not given
+type SumStat struct {
+	Varid string
+	EA    string
+	OA    string
+	EAF   float64
+	Beta  float64
+	P     float64
+}
+
+// ClumpParams ...
+// index p-value P1, member p-value P2, r2 and window (bp) for clumping
+type ClumpParams struct {
+	P1     float64
+	P2     float64
+	R2     float64
+	Window int
+}
+
+// Clump ...
+// an index SNP with the varids it clumped
+type Clump struct {
+	Index   SumStat
+	Chrom   string
+	Posn    int
+	Members []string
+}
+
+// summary statistics column names accepted for each field
+var sumStatCols = map[string][]string{
+	"varid": {"varid", "rsid", "snp", "markername", "variant_id"},
+	"ea":    {"ea", "effect_allele", "a1"},
+	"oa":    {"oa", "other_allele", "a2"},
+	"eaf":   {"eaf", "effect_allele_frequency", "freq", "frq", "af"},
+	"beta":  {"beta", "b", "effect", "logor"},
+	"or":    {"or", "odds_ratio"},
+	"p":     {"p", "pval", "p_value", "pvalue"},
+}
+
+// ParseSumStats ...
+// summary statistics lines, header first, comma, tab or space separated.
+// Needs varid, effect allele, beta (or OR, as log OR) and p columns, column
+// names are matched ignoring case. Rows with missing values are skipped
+// and counted
+func ParseSumStats(lines []string) ([]SumStat, int, error) {
+	stats := make([]SumStat, 0, len(lines))
+	if len(lines) == 0 {
+		return stats, 0, errors.New("summary statistics: no header")
+	}
+	split := func(line string) []string {
+		if strings.Contains(line, ",") {
+			return strings.Split(line, ",")
+		}
+		return strings.Fields(line)
+	}
+	colIdx := make(map[string]int)
+	for i, col := range split(lines[0]) {
+		name := strings.ToLower(strings.TrimSpace(col))
+		for field, names := range sumStatCols {
+			for _, alias := range names {
+				if _, ok := colIdx[field]; !ok && name == alias {
+					colIdx[field] = i
+				}
+			}
+		}
+	}
+	for _, field := range []string{"varid", "ea", "p"} {
+		if _, ok := colIdx[field]; !ok {
+			return stats, 0, fmt.Errorf("summary statistics: no %s column (%s)", field, strings.Join(sumStatCols[field], ", "))
+		}
+	}
+	_, hasBeta := colIdx["beta"]
+	_, hasOR := colIdx["or"]
+	if !hasBeta && !hasOR {
+		return stats, 0, errors.New("summary statistics: no beta or or column")
+	}
+	skipped := 0
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		data := split(line)
+		get := func(field string) string {
+			if idx, ok := colIdx[field]; ok && idx < len(data) {
+				return strings.TrimSpace(data[idx])
+			}
+			return ""
+		}
+		stat := SumStat{Varid: get("varid"), EA: strings.ToUpper(get("ea")), OA: strings.ToUpper(get("oa")), EAF: -1.0}
+		var errb, errp error
+		if hasBeta {
+			stat.Beta, errb = strconv.ParseFloat(get("beta"), 64)
+		} else {
+			var or float64
+			or, errb = strconv.ParseFloat(get("or"), 64)
+			if errb == nil && or <= 0.0 {
+				errb = errors.New("OR <= 0")
+			}
+			stat.Beta = math.Log(or)
+		}
+		stat.P, errp = strconv.ParseFloat(get("p"), 64)
+		if stat.Varid == "" || stat.EA == "" || errb != nil || errp != nil || stat.P < 0.0 || stat.P > 1.0 {
+			skipped++
+			continue
+		}
+		if eaf, err := strconv.ParseFloat(get("eaf"), 64); err == nil && eaf > 0.0 && eaf < 1.0 {
+			stat.EAF = eaf
+		}
+		stats = append(stats, stat)
+	}
+	return stats, skipped, nil
+}
+
+// ClumpSumStats ...
+// Clump summary statistics using LD between the variants' genotype values
+// (ld.GetVariantValues of the combined records). SNPs without genotypes
+// cannot be clumped and are returned as missing. Clumps are in index
+// p-value order
+func ClumpSumStats(stats []SumStat, vals []ld.VariantValues, params ClumpParams) ([]Clump, []string) {
+	valIdx := make(map[string]int, len(vals))
+	for i, vv := range vals {
+		valIdx[vv.Varid] = i
+	}
+	missing := make([]string, 0)
+	ordered := make([]SumStat, 0, len(stats))
+	for _, stat := range stats {
+		if _, ok := valIdx[stat.Varid]; !ok {
+			missing = append(missing, stat.Varid)
+			continue
+		}
+		ordered = append(ordered, stat)
+	}
+	sort.SliceStable(ordered, func(a, b int) bool { return ordered[a].P < ordered[b].P })
+
+	// position order within each chromosome, for the window search
+	byChrom := make(map[string][]int)
+	for i, stat := range ordered {
+		vv := vals[valIdx[stat.Varid]]
+		byChrom[vv.Chrom] = append(byChrom[vv.Chrom], i)
+	}
+	for _, idxs := range byChrom {
+		sort.SliceStable(idxs, func(a, b int) bool {
+			return vals[valIdx[ordered[idxs[a]].Varid]].Posn < vals[valIdx[ordered[idxs[b]].Varid]].Posn
+		})
+	}
+
+	clumped := make([]bool, len(ordered))
+	clumps := make([]Clump, 0)
+	for i, stat := range ordered {
+		if clumped[i] || stat.P > params.P1 {
+			continue
+		}
+		clumped[i] = true
+		index := vals[valIdx[stat.Varid]]
+		clump := Clump{Index: stat, Chrom: index.Chrom, Posn: index.Posn, Members: make([]string, 0)}
+		idxs := byChrom[index.Chrom]
+		start := sort.Search(len(idxs), func(k int) bool {
+			return vals[valIdx[ordered[idxs[k]].Varid]].Posn >= index.Posn-params.Window
+		})
+		for _, j := range idxs[start:] {
+			other := vals[valIdx[ordered[j].Varid]]
+			if other.Posn > index.Posn+params.Window {
+				break
+			}
+			if clumped[j] || ordered[j].P > params.P2 {
+				continue
+			}
+			if ld.PairLD(index, other).R2 >= params.R2 {
+				clumped[j] = true
+				clump.Members = append(clump.Members, ordered[j].Varid)
+			}
+		}
+		clumps = append(clumps, clump)
+	}
+	return clumps, missing
+}
+
+// ThresholdGrsItems ...
+// GRS input items (varid to ea, eaf, wgt) for the index SNPs with
+// p <= threshold, as stored by ehrdb.InsertGrsInputDataWithCheck.
+// Missing EAFs are NA
+func ThresholdGrsItems(clumps []Clump, threshold float64) map[string][]string {
+	items := make(map[string][]string)
+	for _, clump := range clumps {
+		if clump.Index.P > threshold {
+			continue
+		}
+		eaf := "NA"
+		if clump.Index.EAF > 0.0 {
+			eaf = strconv.FormatFloat(clump.Index.EAF, 'g', 6, 64)
+		}
+		items[clump.Index.Varid] = []string{clump.Index.EA, eaf, strconv.FormatFloat(clump.Index.Beta, 'g', 8, 64)}
+	}
+	return items
+}
+
+// ClumpHeader ...
+// column headers for Clump TSV output
+const ClumpHeader = "varid\tchrom\tposn\tea\tbeta\tp\tnclumped\tclumped"
+
+// TSV ...
+func (clump Clump) TSV() string {
+	return fmt.Sprintf("%s\t%s\t%d\t%s\t%.6g\t%.4e\t%d\t%s", clump.Index.Varid, clump.Chrom, clump.Posn, clump.Index.EA,
+		clump.Index.Beta, clump.Index.P, len(clump.Members), strings.Join(clump.Members, ","))
+}
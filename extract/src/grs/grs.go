@@ -6,6 +6,8 @@ package grs
 import (
 	"fmt"
 	"log"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"variant"
@@ -13,6 +15,49 @@ import (
 
 var firstSampleCol int
 
+// Scoring modes and normalisation for GetScoresWithParams
+const (
+	ModeHard    = "hard"
+	ModeDosage  = "dosage"
+	NormSum     = "sum"
+	NormAverage = "avg"
+)
+
+// ScoreParams ...
+// Mode: hard calls (at Threshold) or dosages from DS / GP
+// Impute: missing genotypes set to 2 x EAF, otherwise skipped
+// Norm: sum of weighted effect allele counts, or the sum divided by the
+// number of alleles scored (2 x SNPs), as PLINK --score sum / default
+// PalindromeMargin: see MatchAllele
+type ScoreParams struct {
+	Mode             string
+	Impute           bool
+	Norm             string
+	Threshold        float64
+	PalindromeMargin float64
+}
+
+// Describe ...
+// run parameters as a string, used to identify stored score runs
+func (params ScoreParams) Describe() string {
+	return fmt.Sprintf("mode=%s;impute=%t;norm=%s;pthr=%.2f;margin=%.2f", params.Mode, params.Impute, params.Norm,
+		params.Threshold, params.PalindromeMargin)
+}
+
+// SampleScore ...
+// score for one sample, SNPCount genotypes observed plus Imputed genotypes
+// mean-imputed
+type SampleScore struct {
+	SampleID string
+	SNPCount int
+	Imputed  int
+	Score    float64
+}
+
+// ScoreHeader ...
+// column headers for ScoreLine output
+const ScoreHeader = "sample,snpcount,imputed,score"
+
 // GetScores ...
 //---------------------------------------------------------------------
 func GetScores(records []string, eas map[string]string, eafs map[string]float64, wgts map[string]float64) ([]string, []string) {
@@ -66,6 +111,88 @@ func GetScores(records []string, eas map[string]string, eafs map[string]float64,
 	return scoreList, scoreListFlip
 }
 
+// GetScoresWithParams ...
+// Score combined records (header first) against effect alleles, EAFs and
+// weights. Effect alleles are matched to record alleles by MatchAllele and
+// dosages are counts of the matched allele. Where EAF is missing or not in
+// (0,1) imputation uses the effect allele frequency in the called samples.
+// Returns scores in sample id order and the per-SNP matching report
+//---------------------------------------------------------------------
+func GetScoresWithParams(records []string, eas map[string]string, eafs map[string]float64, wgts map[string]float64,
+	params ScoreParams) ([]SampleScore, []SNPMatch) {
+	batch := GetBatchScores(records, []GrsSet{{EAs: eas, EAFs: eafs, Wgts: wgts}}, params)
+	return batch.Scores[0], batch.Matches[0]
+}
+
+// ScoreSummary ...
+// distribution of scores over samples with at least one SNP scored or
+// imputed
+type ScoreSummary struct {
+	N      int
+	Mean   float64
+	SD     float64
+	Min    float64
+	Q1     float64
+	Median float64
+	Q3     float64
+	Max    float64
+}
+
+// Summarise ...
+// ScoreSummary for a set of scores, quartiles by linear interpolation
+func Summarise(scores []SampleScore) ScoreSummary {
+	values := ScoreValues(scores)
+	summary := ScoreSummary{N: len(values)}
+	if summary.N == 0 {
+		return summary
+	}
+	sort.Float64s(values)
+	sum := 0.0
+	for _, val := range values {
+		sum += val
+	}
+	summary.Mean = sum / float64(summary.N)
+	if summary.N > 1 {
+		ss := 0.0
+		for _, val := range values {
+			ss += (val - summary.Mean) * (val - summary.Mean)
+		}
+		summary.SD = math.Sqrt(ss / float64(summary.N-1))
+	}
+	summary.Min = values[0]
+	summary.Max = values[summary.N-1]
+	summary.Q1 = quantile(values, 0.25)
+	summary.Median = quantile(values, 0.5)
+	summary.Q3 = quantile(values, 0.75)
+	return summary
+}
+
+// ScoreValues ...
+// scores for samples with at least one SNP scored or imputed
+func ScoreValues(scores []SampleScore) []float64 {
+	values := make([]float64, 0, len(scores))
+	for _, score := range scores {
+		if score.SNPCount+score.Imputed > 0 {
+			values = append(values, score.Score)
+		}
+	}
+	return values
+}
+
+// q quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (pos-float64(lo))*(sorted[hi]-sorted[lo])
+}
+
+// ScoreLine ...
+// sample,snpcount,imputed,score
+func (ss SampleScore) ScoreLine() string {
+	return fmt.Sprintf("%s,%d,%d,%.6f", ss.SampleID, ss.SNPCount, ss.Imputed, ss.Score)
+}
+
 // TODO: call a func in variant.go instead
 func getGenoIntValueFlip(geno string, alt string, ea string) int {
 	gval := 0
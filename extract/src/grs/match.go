@@ -0,0 +1,146 @@
+package grs
+
+//
+// GRS effect allele matching against combined record alleles
+//
+// The effect allele (EA) is matched to REF or ALT directly, then on the
+// complement strand. Palindromic SNPs (A/T, C/G) match on both strands so
+// are resolved by comparing EAF with the cohort frequency of EA: when both
+// are on the same side of 0.5 EA is taken as given, on opposite sides as
+// the complement, and when either is within the margin of 0.5 the SNP is
+// dropped
+//
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// Match status for a GRS SNP
+const (
+	MatchUsed         = "used"
+	MatchFlipped      = "flipped"
+	MatchComplemented = "complemented"
+	MatchDropped      = "dropped"
+	MatchNotFound     = "notfound"
+)
+
+// DefaultPalindromeMargin ...
+// palindromic SNPs with EAF or cohort EAF in 0.5 +/- margin are dropped
+const DefaultPalindromeMargin = 0.1
+
+// SNPMatchHeader ...
+// column headers for the matching report
+const SNPMatchHeader = "varid\tchr\tposn\tref\talt\tea\teaf\tcohort_eaf\tmatched\tstatus\treason"
+
+// SNPMatch ...
+// how a GRS SNP was matched. Matched is the record allele (REF or ALT)
+// counted as the effect allele, Flipped when that is REF (record dosages
+// count ALT), CohortEAF the cohort frequency of Matched
+type SNPMatch struct {
+	Varid     string
+	Chrom     string
+	Posn      string
+	Ref       string
+	Alt       string
+	EA        string
+	EAF       float64
+	CohortEAF float64
+	Matched   string
+	Flipped   bool
+	Status    string
+	Reason    string
+}
+
+// MatchAllele ...
+// match one SNP, altAF is the cohort ALT allele frequency (-1 if unknown)
+// and eaf the GRS EAF (0 if not given)
+func MatchAllele(snp SNPMatch, altAF float64, margin float64) SNPMatch {
+	ea := strings.ToUpper(snp.EA)
+	ref := strings.ToUpper(snp.Ref)
+	alt := strings.ToUpper(snp.Alt)
+	setMatched := func(allele string) {
+		snp.Matched = allele
+		snp.Flipped = allele == ref
+		snp.CohortEAF = altAF
+		if snp.Flipped && altAF >= 0.0 {
+			snp.CohortEAF = 1.0 - altAF
+		}
+	}
+	if variant.IsPalindromic(ref, alt) && (ea == ref || ea == alt) {
+		if snp.EAF <= 0.0 || snp.EAF >= 1.0 || altAF < 0.0 {
+			snp.Status, snp.Reason = MatchDropped, "palindromic, no EAF or cohort frequency"
+			return snp
+		}
+		setMatched(ea)
+		if math.Abs(snp.EAF-0.5) <= margin || math.Abs(snp.CohortEAF-0.5) <= margin {
+			snp.Matched, snp.Flipped = "", false
+			snp.Status, snp.Reason = MatchDropped, "palindromic, frequency near 0.5"
+			return snp
+		}
+		if (snp.EAF < 0.5) == (snp.CohortEAF < 0.5) {
+			snp.Status, snp.Reason = MatchUsed, "palindromic, frequency agrees"
+			if snp.Flipped {
+				snp.Status = MatchFlipped
+			}
+			return snp
+		}
+		setMatched(variant.Complement(ea))
+		snp.Status, snp.Reason = MatchComplemented, "palindromic, frequency agrees with complement"
+		return snp
+	}
+	switch {
+	case ea == alt:
+		setMatched(alt)
+		snp.Status = MatchUsed
+	case ea == ref:
+		setMatched(ref)
+		snp.Status = MatchFlipped
+	case variant.Complement(ea) != "" && (variant.Complement(ea) == alt || variant.Complement(ea) == ref):
+		setMatched(variant.Complement(ea))
+		snp.Status, snp.Reason = MatchComplemented, "strand"
+	default:
+		snp.Status, snp.Reason = MatchDropped, "allele mismatch"
+	}
+	return snp
+}
+
+// NotFoundMatches ...
+// report entries, sorted, for GRS varids with no record
+func NotFoundMatches(eas map[string]string, eafs map[string]float64, found map[string]bool) []SNPMatch {
+	varids := make([]string, 0)
+	for varid := range eas {
+		if !found[varid] {
+			varids = append(varids, varid)
+		}
+	}
+	sort.Strings(varids)
+	matches := make([]SNPMatch, len(varids))
+	for i, varid := range varids {
+		matches[i] = SNPMatch{Varid: varid, EA: eas[varid], EAF: eafs[varid], CohortEAF: -1.0, Status: MatchNotFound,
+			Reason: "not in combined genotypes"}
+	}
+	return matches
+}
+
+// MatchCounts ...
+// number of SNPs by status
+func MatchCounts(matches []SNPMatch) map[string]int {
+	counts := make(map[string]int)
+	for _, snp := range matches {
+		counts[snp.Status]++
+	}
+	return counts
+}
+
+// TSV ...
+func (snp SNPMatch) TSV() string {
+	cohortEAF := "."
+	if snp.CohortEAF >= 0.0 {
+		cohortEAF = fmt.Sprintf("%.4f", snp.CohortEAF)
+	}
+	return strings.Join([]string{snp.Varid, snp.Chrom, snp.Posn, snp.Ref, snp.Alt, snp.EA, fmt.Sprintf("%.4f", snp.EAF),
+		cohortEAF, snp.Matched, snp.Status, snp.Reason}, "\t")
+}
@@ -0,0 +1,49 @@
+package grs
+
+import (
+	"math"
+	"testing"
+)
+
+// DefaultPalindromeMargin is used throughout, so 0.45 and 0.55 fall inside it
+func TestMatchAllele(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		alt       string
+		ea        string
+		eaf       float64
+		altAF     float64
+		status    string
+		matched   string
+		flipped   bool
+		cohortEAF float64
+	}{
+		{"EA is ALT", "A", "G", "G", 0.3, 0.25, MatchUsed, "G", false, 0.25},
+		{"EA is REF", "A", "G", "A", 0.3, 0.25, MatchFlipped, "A", true, 0.75},
+		{"EA lower case", "A", "G", "g", 0.3, 0.25, MatchUsed, "G", false, 0.25},
+		{"EA on the other strand, ALT", "A", "G", "C", 0.3, 0.25, MatchComplemented, "G", false, 0.25},
+		{"EA on the other strand, REF", "A", "G", "T", 0.3, 0.25, MatchComplemented, "A", true, 0.75},
+		{"allele mismatch", "A", "AT", "G", 0.3, 0.25, MatchDropped, "", false, 0.0},
+		{"A/T, frequency agrees", "A", "T", "T", 0.2, 0.25, MatchUsed, "T", false, 0.25},
+		{"A/T, frequency agrees, EA is REF", "A", "T", "A", 0.2, 0.75, MatchFlipped, "A", true, 0.25},
+		{"A/T, complement", "A", "T", "T", 0.2, 0.8, MatchComplemented, "A", true, 0.2},
+		{"C/G, complement", "C", "G", "C", 0.7, 0.7, MatchComplemented, "G", false, 0.7},
+		{"A/T, EAF near 0.5", "A", "T", "T", 0.45, 0.2, MatchDropped, "", false, 0.0},
+		{"A/T, cohort EAF near 0.5", "A", "T", "T", 0.2, 0.55, MatchDropped, "", false, 0.0},
+		{"A/T, no EAF", "A", "T", "T", 0.0, 0.2, MatchDropped, "", false, 0.0},
+		{"A/T, no cohort frequency", "A", "T", "T", 0.2, -1.0, MatchDropped, "", false, 0.0},
+	}
+	for _, tt := range tests {
+		snp := MatchAllele(SNPMatch{Varid: "rs1", Ref: tt.ref, Alt: tt.alt, EA: tt.ea, EAF: tt.eaf}, tt.altAF,
+			DefaultPalindromeMargin)
+		if snp.Status != tt.status || snp.Matched != tt.matched || snp.Flipped != tt.flipped {
+			t.Errorf("%s: status %s matched %q flipped %t, want %s %q %t (%s)", tt.name, snp.Status, snp.Matched,
+				snp.Flipped, tt.status, tt.matched, tt.flipped, snp.Reason)
+			continue
+		}
+		if tt.status != MatchDropped && math.Abs(snp.CohortEAF-tt.cohortEAF) > 1e-12 {
+			t.Errorf("%s: cohort EAF %g, want %g", tt.name, snp.CohortEAF, tt.cohortEAF)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package grs
+
+//
+// PGS Catalog scoring files: "#key=value" header metadata (pgs_id,
+// trait_reported, genome_build, ...) then a tab separated table with
+// rsID and / or chr_name, chr_position, effect_allele, other_allele,
+// effect_weight and optional allelefrequency_effect. Harmonized files
+// (hm_rsID, hm_chr, hm_pos) are used where the original columns are blank.
+// Entries are converted to GRS input lines (varid,ea,eaf,wgt); entries
+// without an rsID are given a varid by a caller supplied position lookup
+//
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PGSCatalogColumns ...
+// GRS input header written for converted PGS Catalog files
+const PGSCatalogColumns = "varid,ea,eaf,wgt"
+
+// PGSEntry ...
+// one variant row of a PGS Catalog scoring file, Posn 0 if not given
+type PGSEntry struct {
+	Rsid   string
+	Chrom  string
+	Posn   int
+	EA     string
+	OA     string
+	Weight string
+	EAF    string
+}
+
+// PGSScore ...
+// Meta holds the header key / value pairs, Skipped counts rows not usable
+// as additive SNP weights (interaction, haplotype or non-numeric weights)
+type PGSScore struct {
+	Meta    map[string]string
+	Entries []PGSEntry
+	Skipped int
+}
+
+// IsPGSCatalog ...
+// true if lines look like a PGS Catalog scoring file: a commented header
+// or a tab separated column header with effect_allele and effect_weight
+func IsPGSCatalog(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			return true
+		}
+		cols := pgsColMap(line)
+		_, eaok := cols["effect_allele"]
+		_, wok := cols["effect_weight"]
+		return eaok && wok
+	}
+	return false
+}
+
+func pgsColMap(hdr string) map[string]int {
+	colMap := make(map[string]int)
+	for i, col := range strings.Split(strings.TrimRight(hdr, "\r"), "\t") {
+		colMap[strings.TrimSpace(col)] = i
+	}
+	return colMap
+}
+
+// ParsePGSCatalog ...
+// header metadata and entries of a PGS Catalog scoring file
+func ParsePGSCatalog(lines []string) (PGSScore, error) {
+	score := PGSScore{Meta: make(map[string]string)}
+	var colMap map[string]int
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if kv := strings.SplitN(strings.TrimLeft(line, "#"), "=", 2); len(kv) == 2 {
+				score.Meta[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+			continue
+		}
+		if colMap == nil {
+			colMap = pgsColMap(line)
+			if _, ok := colMap["effect_allele"]; !ok {
+				return score, errors.New("PGS Catalog file: no effect_allele column")
+			}
+			if _, ok := colMap["effect_weight"]; !ok {
+				return score, errors.New("PGS Catalog file: no effect_weight column")
+			}
+			_, rsok := colMap["rsID"]
+			_, hmrsok := colMap["hm_rsID"]
+			_, chrok := colMap["chr_name"]
+			_, hmchrok := colMap["hm_chr"]
+			if !rsok && !hmrsok && !chrok && !hmchrok {
+				return score, errors.New("PGS Catalog file: no rsID or chr_name / chr_position columns")
+			}
+			continue
+		}
+		data := strings.Split(line, "\t")
+		get := func(cols ...string) string {
+			for _, col := range cols {
+				if idx, ok := colMap[col]; ok && idx < len(data) {
+					if val := strings.TrimSpace(data[idx]); val != "" && val != "NA" && val != "." {
+						return val
+					}
+				}
+			}
+			return ""
+		}
+		if strings.EqualFold(get("is_haplotype"), "true") || strings.EqualFold(get("is_diplotype"), "true") ||
+			strings.EqualFold(get("is_interaction"), "true") {
+			score.Skipped++
+			continue
+		}
+		entry := PGSEntry{Rsid: get("rsID", "hm_rsID"), Chrom: NormaliseChrom(get("chr_name", "hm_chr")),
+			EA: strings.ToUpper(get("effect_allele")), OA: strings.ToUpper(get("other_allele", "hm_inferOtherAllele")),
+			Weight: get("effect_weight"), EAF: get("allelefrequency_effect")}
+		entry.Posn, _ = strconv.Atoi(get("chr_position", "hm_pos"))
+		if _, err := strconv.ParseFloat(entry.Weight, 64); err != nil || entry.EA == "" {
+			score.Skipped++
+			continue
+		}
+		if !strings.HasPrefix(entry.Rsid, "rs") && (entry.Chrom == "" || entry.Posn == 0) {
+			score.Skipped++
+			continue
+		}
+		score.Entries = append(score.Entries, entry)
+	}
+	if colMap == nil {
+		return score, errors.New("PGS Catalog file: no column header")
+	}
+	return score, nil
+}
+
+// NormaliseChrom ...
+// chromosome name without a chr prefix
+func NormaliseChrom(chrom string) string {
+	if strings.HasPrefix(strings.ToLower(chrom), "chr") {
+		return chrom[3:]
+	}
+	return chrom
+}
+
+// normalised genome build name, GRCh37 / GRCh38 for their aliases
+func normaliseBuild(build string) string {
+	switch strings.ToLower(strings.TrimSpace(build)) {
+	case "grch37", "hg19", "37", "b37":
+		return "GRCh37"
+	case "grch38", "hg38", "38", "b38":
+		return "GRCh38"
+	}
+	return strings.TrimSpace(build)
+}
+
+// ID ...
+// PGS Catalog id, or the score name
+func (score PGSScore) ID() string {
+	if id := score.Meta["pgs_id"]; id != "" {
+		return id
+	}
+	return score.Meta["pgs_name"]
+}
+
+// Trait ...
+// reported trait, or the mapped trait
+func (score PGSScore) Trait() string {
+	if trait := score.Meta["trait_reported"]; trait != "" {
+		return trait
+	}
+	return score.Meta["trait_mapped"]
+}
+
+// Build ...
+// genome build of the positions: the harmonized build if present,
+// otherwise the original genome_build. NR or blank is returned as ""
+func (score PGSScore) Build() string {
+	for _, key := range []string{"HmPOS_build", "genome_build"} {
+		if build := score.Meta[key]; build != "" && build != "NR" {
+			return normaliseBuild(build)
+		}
+	}
+	return ""
+}
+
+// BuildMatches ...
+// false only if both the score and the target build are known and differ
+func (score PGSScore) BuildMatches(build string) bool {
+	return build == "" || score.Build() == "" || score.Build() == normaliseBuild(build)
+}
+
+// Description ...
+// one line summary of the header metadata, appended to GRS descriptions
+func (score PGSScore) Description() string {
+	keys := make([]string, 0, len(score.Meta))
+	for key := range score.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{fmt.Sprintf("PGS Catalog %s, trait=%s, build=%s, variants=%d", score.ID(), score.Trait(),
+		score.Build(), len(score.Entries))}
+	for _, key := range keys {
+		if key == "pgs_id" || key == "trait_reported" {
+			continue
+		}
+		parts = append(parts, key+"="+score.Meta[key])
+	}
+	return strings.Join(parts, "; ")
+}
+
+// GrsLines ...
+// entries as GRS input lines (PGSCatalogColumns header first). Entries
+// without an rsID get their varid from lookup (chromosome, position,
+// effect and other allele), "" if none. Entries with no varid, or a varid
+// already written, are returned as unresolved. Missing EAFs are written as NA
+func (score PGSScore) GrsLines(lookup func(chrom string, posn int, ea string, oa string) string) ([]string, []PGSEntry) {
+	lines := []string{PGSCatalogColumns}
+	unresolved := make([]PGSEntry, 0)
+	seen := make(map[string]bool)
+	for _, entry := range score.Entries {
+		varid := entry.Rsid
+		if !strings.HasPrefix(varid, "rs") {
+			varid = ""
+			if lookup != nil {
+				varid = lookup(entry.Chrom, entry.Posn, entry.EA, entry.OA)
+			}
+		}
+		if varid == "" || seen[varid] {
+			unresolved = append(unresolved, entry)
+			continue
+		}
+		seen[varid] = true
+		eaf := entry.EAF
+		if eaf == "" {
+			eaf = "NA"
+		}
+		lines = append(lines, strings.Join([]string{varid, entry.EA, eaf, entry.Weight}, ","))
+	}
+	return lines, unresolved
+}
+
+// Locus ...
+// chrom:posn for reporting
+func (entry PGSEntry) Locus() string {
+	return fmt.Sprintf("%s:%d", entry.Chrom, entry.Posn)
+}
@@ -0,0 +1,264 @@
+//------------------------------------------------------------------------------
+// Clumping and thresholding GRS construction from GWAS summary statistics
+//
+// Steps:
+// 1) Read summary statistics (varid / rsid, effect allele, beta or OR, p,
+//    optional eaf) for a GWAS
+// 2) Look up the chromosome of each SNP with p below the clumping p-values
+//    (godb.GetVaridChroms)
+// 3) For one chromosome at a time, get combined genotype records via
+//    godb.Getallvardata and LD clump greedily in p-value order
+//    (grs.ClumpSumStats) with r2 from the combined genotypes (hard calls or
+//    dosages). Clumps never span chromosomes, so this gives the same clumps
+//    as clumping all SNPs at once
+// 4) For each p-value threshold save the index SNPs at or below it, beta as
+//    the weight, as GRS input <name>_p<threshold> via
+//    ehrdb.InsertGrsInputDataWithCheck, ready for scoring
+//
+// Memory: the genotype records and values for the candidate SNPs on the
+// largest chromosome are held at once, roughly (candidate SNPs on that
+// chromosome) x (samples) x 9 bytes for the values plus the record text.
+// Candidates are the SNPs with p <= max(P1, P2), and only SNPs with
+// p <= P1 can be index SNPs, so members with p above P1 change the clump
+// file but not the GRS inputs. P2 defaults to P1; thresholds near 1 make
+// nearly every summary statistics row a candidate
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"ehrdb"
+	"flag"
+	"fmt"
+	"godb"
+	"grs"
+	"ld"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var sumStatsPath string
+var vcfPathPref string
+var threshold float64
+var useDosage bool
+var assayTypes string
+var pThresholds string
+var clumpP1 float64
+var clumpP2 float64
+var clumpR2 float64
+var window int
+var grsName string
+var grsDesc string
+var clumpFilePath string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath  = "./logs/grsclump_output.log"
+		lusage              = "Log file"
+		defaultSumStatsPath = "./data/sumstats.txt"
+		ssusage             = "GWAS summary statistics file (varid, ea, beta or or, p, optional eaf)"
+		defaultvcfPathPref  = ""
+		vusage              = "default path prefix for vcf files"
+		defaultThreshold    = 0.9
+		thrusage            = "Prob threshold (hard calls)"
+		defaultDosage       = false
+		dusage              = "Use dosages rather than hard calls for LD"
+		defaultAssayTypes   = "affy,illumina,broad,metabo,exome"
+		atusage             = "Assay types"
+		defaultPThresholds  = "5e-8,1e-5,1e-3,0.01,0.05"
+		pusage              = "Comma separated p-value thresholds, one GRS input each"
+		defaultClumpP1      = 0.0
+		p1usage             = "Index SNP p-value for clumping (default: the largest threshold)"
+		defaultClumpP2      = 0.0
+		p2usage             = "Clumped SNP p-value (default: the index SNP p-value)"
+		defaultClumpR2      = 0.1
+		r2usage             = "r2 for clumping"
+		defaultWindow       = 250000
+		wusage              = "Clumping window in bp either side of the index SNP"
+		defaultGrsName      = ""
+		nusage              = "GRS input name prefix, saved as <name>_p<threshold>"
+		defaultGrsDesc      = ""
+		eusage              = "GRS input description"
+		defaultClumpFile    = ""
+		cusage              = "Output file for the clumps (index SNP, clumped SNPs)"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&sumStatsPath, "sumstats", defaultSumStatsPath, ssusage)
+	flag.StringVar(&sumStatsPath, "s", defaultSumStatsPath, ssusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, vusage)
+	flag.StringVar(&vcfPathPref, "v", defaultvcfPathPref, vusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.BoolVar(&useDosage, "dosage", defaultDosage, dusage)
+	flag.BoolVar(&useDosage, "d", defaultDosage, dusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.StringVar(&pThresholds, "pthresholds", defaultPThresholds, pusage)
+	flag.StringVar(&pThresholds, "p", defaultPThresholds, pusage+" (shorthand)")
+	flag.Float64Var(&clumpP1, "clumpp1", defaultClumpP1, p1usage)
+	flag.Float64Var(&clumpP1, "i", defaultClumpP1, p1usage+" (shorthand)")
+	flag.Float64Var(&clumpP2, "clumpp2", defaultClumpP2, p2usage)
+	flag.Float64Var(&clumpP2, "j", defaultClumpP2, p2usage+" (shorthand)")
+	flag.Float64Var(&clumpR2, "clumpr2", defaultClumpR2, r2usage)
+	flag.Float64Var(&clumpR2, "r", defaultClumpR2, r2usage+" (shorthand)")
+	flag.IntVar(&window, "window", defaultWindow, wusage)
+	flag.IntVar(&window, "w", defaultWindow, wusage+" (shorthand)")
+	flag.StringVar(&grsName, "name", defaultGrsName, nusage)
+	flag.StringVar(&grsName, "n", defaultGrsName, nusage+" (shorthand)")
+	flag.StringVar(&grsDesc, "desc", defaultGrsDesc, eusage)
+	flag.StringVar(&grsDesc, "e", defaultGrsDesc, eusage+" (shorthand)")
+	flag.StringVar(&clumpFilePath, "clumpfile", defaultClumpFile, cusage)
+	flag.StringVar(&clumpFilePath, "c", defaultClumpFile, cusage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+
+	if grsName == "" {
+		log.Fatal("A GRS input name (-name) is required")
+	}
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	thrList := strings.Split(pThresholds, ",")
+	thrValues := make([]float64, len(thrList))
+	maxThr := 0.0
+	for i, thr := range thrList {
+		thrValues[i], err = strconv.ParseFloat(strings.TrimSpace(thr), 64)
+		check(err)
+		maxThr = math.Max(maxThr, thrValues[i])
+	}
+	if clumpP1 <= 0.0 {
+		clumpP1 = maxThr
+	}
+	if clumpP2 <= 0.0 {
+		clumpP2 = clumpP1
+	}
+	params := grs.ClumpParams{P1: clumpP1, P2: clumpP2, R2: clumpR2, Window: window}
+
+	lines := make([]string, 0, 100000)
+	f, err := os.Open(sumStatsPath)
+	check(err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	check(scanner.Err())
+	stats, skipped, err := grs.ParseSumStats(lines)
+	check(err)
+	log.Printf("Summary statistics %s: %d SNPs, %d rows skipped\n", sumStatsPath, len(stats), skipped)
+
+	// only SNPs that can be index or clumped SNPs are needed
+	maxP := math.Max(params.P1, params.P2)
+	rsidList := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		if stat.P <= maxP {
+			rsidList = append(rsidList, stat.Varid)
+		}
+	}
+	start := time.Now()
+	varidChroms := godb.GetVaridChroms(rsidList, validAssaytypes)
+	chromCandidates := make(map[string][]grs.SumStat)
+	chroms := make([]string, 0, 30)
+	missing := make([]string, 0)
+	for _, stat := range stats {
+		if stat.P > maxP {
+			continue
+		}
+		chrom, ok := varidChroms[stat.Varid]
+		if !ok {
+			missing = append(missing, stat.Varid)
+			continue
+		}
+		if _, ok := chromCandidates[chrom]; !ok {
+			chroms = append(chroms, chrom)
+		}
+		chromCandidates[chrom] = append(chromCandidates[chrom], stat)
+	}
+	log.Printf("%d candidate SNPs on %d chromosomes, %d not found, timing %s\n", len(rsidList), len(chroms), len(missing),
+		time.Since(start))
+
+	clumps := make([]grs.Clump, 0)
+	for _, chrom := range chroms {
+		start = time.Now()
+		candidates := chromCandidates[chrom]
+		chromRsids := make([]string, len(candidates))
+		for i, stat := range candidates {
+			chromRsids[i] = stat.Varid
+		}
+		_, _, genorecs := godb.Getallvardata(vcfPathPref, chromRsids, validAssaytypes, threshold)
+		vals := ld.GetVariantValues(genorecs, threshold, useDosage)
+		chromClumps, chromMissing := grs.ClumpSumStats(candidates, vals, params)
+		clumps = append(clumps, chromClumps...)
+		missing = append(missing, chromMissing...)
+		log.Printf("Chromosome %s: %d candidate SNPs, %d with genotypes, %d clumps, timing %s\n", chrom, len(candidates),
+			len(vals), len(chromClumps), time.Since(start))
+	}
+	sort.SliceStable(clumps, func(a, b int) bool { return clumps[a].Index.P < clumps[b].Index.P })
+	log.Printf("Clumping %+v: %d clumps, %d SNPs without genotypes\n", params, len(clumps), len(missing))
+
+	if clumpFilePath != "" {
+		cf, err := os.Create(clumpFilePath)
+		check(err)
+		defer cf.Close()
+		w := bufio.NewWriter(cf)
+		fmt.Fprintf(w, "%s\n", grs.ClumpHeader)
+		for _, clump := range clumps {
+			fmt.Fprintf(w, "%s\n", clump.TSV())
+		}
+		check(w.Flush())
+	}
+
+	fmt.Printf("name\tpthreshold\tsnps\tsaved\tmessage\n")
+	for i, thr := range thrList {
+		items := grs.ThresholdGrsItems(clumps, thrValues[i])
+		name := grsName + "_p" + strings.TrimSpace(thr)
+		desc := fmt.Sprintf("%s C+T from %s: p<=%s, clump r2=%.2f window=%dbp p1=%g p2=%g, %d SNPs", grsDesc, sumStatsPath,
+			strings.TrimSpace(thr), params.R2, params.Window, params.P1, params.P2, len(items))
+		res, msg := false, "no SNPs"
+		if len(items) > 0 {
+			res, msg = ehrdb.InsertGrsInputDataWithCheck(name, strings.TrimSpace(desc), items)
+		}
+		log.Printf("%s: %d SNPs, saved=%t %s\n", name, len(items), res, msg)
+		fmt.Printf("%s\t%s\t%d\t%t\t%s\n", name, strings.TrimSpace(thr), len(items), res, msg)
+	}
+}
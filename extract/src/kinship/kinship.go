@@ -0,0 +1,279 @@
+// Package kinship ...
+// Pairwise kinship (KING-robust) between samples in combined genotype records
+//
+// For samples i and j, over SNPs called in both:
+//   phi = (N(Aa,Aa) - 2 N(AA,aa)) / (N(Aa)i + N(Aa)j)
+// which is robust to population structure (Manichaikul et al. 2010).
+// Records are streamed, SNPs are first LD pruned (greedy, within a bp window
+// on the same chromosome) and filtered on MAF and call rate.
+//
+// Counts are held for all sample pairs, memory is O(samples^2)
+//
+package kinship
+
+import (
+	"fmt"
+	"ld"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// Degree thresholds, KING inference criteria
+const (
+	DupThreshold    = 0.354
+	FirstThreshold  = 0.177
+	SecondThreshold = 0.0884
+	ThirdThreshold  = 0.0442
+)
+
+// PairHeader ...
+// column headers for the related pairs table
+const PairHeader = "sample1\tsample2\tnsnps\thethet\tibs0\tkinship\tdegree"
+
+// Pair ...
+// kinship for two samples
+type Pair struct {
+	Sample1 string
+	Sample2 string
+	N       int
+	HetHet  int
+	IBS0    int
+	Kinship float64
+	Degree  string
+}
+
+type pairCounts struct {
+	n      int32
+	hethet int32
+	ibs0   int32
+	het1   int32
+	het2   int32
+}
+
+// Pruner ...
+// LD pruning and SNP filters, a SNP is kept if it passes MinMAF and
+// MinCallRate and its r2 with every kept SNP within Window bp is at most MaxR2
+type Pruner struct {
+	Window      int
+	MaxR2       float64
+	MinMAF      float64
+	MinCallRate float64
+	kept        []ld.VariantValues
+}
+
+// NewPruner ...
+func NewPruner(window int, maxR2 float64, minMAF float64, minCallRate float64) *Pruner {
+	return &Pruner{Window: window, MaxR2: maxR2, MinMAF: minMAF, MinCallRate: minCallRate, kept: make([]ld.VariantValues, 0, 100)}
+}
+
+// Keep ...
+// records are expected in position order within a chromosome
+func (pr *Pruner) Keep(vv ld.VariantValues) bool {
+	n, sum := 0, 0.0
+	for i, called := range vv.Called {
+		if called {
+			n++
+			sum += vv.Values[i]
+		}
+	}
+	if n == 0 || float64(n)/float64(len(vv.Called)) < pr.MinCallRate {
+		return false
+	}
+	af := sum / float64(2*n)
+	if af > 0.5 {
+		af = 1.0 - af
+	}
+	if af < pr.MinMAF {
+		return false
+	}
+	// drop kept SNPs now out of the window
+	start := 0
+	for start < len(pr.kept) && (pr.kept[start].Chrom != vv.Chrom || vv.Posn-pr.kept[start].Posn > pr.Window) {
+		start++
+	}
+	pr.kept = pr.kept[start:]
+	for _, kv := range pr.kept {
+		if ld.PairLD(kv, vv).R2 > pr.MaxR2 {
+			return false
+		}
+	}
+	pr.kept = append(pr.kept, vv)
+	return true
+}
+
+// Kinship ...
+// accumulated pair counts for a set of samples
+type Kinship struct {
+	Samples   []string
+	Threshold float64
+	SNPCount  int
+	Pruner    *Pruner
+	counts    []pairCounts
+}
+
+// NewKinship ...
+// sampleNames are the sample columns of the records to be added, pruner may
+// be nil (all SNPs used)
+func NewKinship(sampleNames []string, threshold float64, pruner *Pruner) *Kinship {
+	n := len(sampleNames)
+	return &Kinship{Samples: sampleNames, Threshold: threshold, Pruner: pruner, counts: make([]pairCounts, n*(n-1)/2)}
+}
+
+// index of pair i < j in the flat counts slice
+func (k *Kinship) pairIdx(i int, j int) int {
+	n := len(k.Samples)
+	return i*(2*n-i-1)/2 + (j - i - 1)
+}
+
+// AddRecord ...
+// add one combined VCF record-as-slice, returns false if the SNP is pruned
+func (k *Kinship) AddRecord(rec []string) bool {
+	if len(rec) <= 9 {
+		return false
+	}
+	prfx, genos := variant.GetVCFPrfxSfx(rec)
+	probidx := variant.GetProbIdx(prfx)
+	vv := ld.VariantValues{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx), Posn: variant.GetPosn(prfx),
+		Values: make([]float64, len(genos)), Called: make([]bool, len(genos))}
+	for i, geno := range genos {
+		vv.Values[i], vv.Called[i] = variant.GetHardCall(geno, k.Threshold, probidx)
+	}
+	if k.Pruner != nil && !k.Pruner.Keep(vv) {
+		return false
+	}
+	k.SNPCount++
+	n := len(k.Samples)
+	if len(genos) < n {
+		n = len(genos)
+	}
+	for i := 0; i < n; i++ {
+		if !vv.Called[i] {
+			continue
+		}
+		gi := vv.Values[i]
+		for j := i + 1; j < n; j++ {
+			if !vv.Called[j] {
+				continue
+			}
+			gj := vv.Values[j]
+			pc := &k.counts[k.pairIdx(i, j)]
+			pc.n++
+			if gi == 1.0 {
+				pc.het1++
+				if gj == 1.0 {
+					pc.hethet++
+				}
+			}
+			if gj == 1.0 {
+				pc.het2++
+			}
+			if (gi == 0.0 && gj == 2.0) || (gi == 2.0 && gj == 0.0) {
+				pc.ibs0++
+			}
+		}
+	}
+	return true
+}
+
+// GetPair ...
+// kinship for samples i and j (column positions)
+func (k *Kinship) GetPair(i int, j int) Pair {
+	if j < i {
+		i, j = j, i
+	}
+	pc := k.counts[k.pairIdx(i, j)]
+	pair := Pair{Sample1: k.Samples[i], Sample2: k.Samples[j], N: int(pc.n), HetHet: int(pc.hethet), IBS0: int(pc.ibs0)}
+	if pc.het1+pc.het2 > 0 {
+		pair.Kinship = float64(pc.hethet-2*pc.ibs0) / float64(pc.het1+pc.het2)
+	}
+	pair.Degree = Degree(pair.Kinship)
+	return pair
+}
+
+// Degree ...
+// relationship inferred from a kinship coefficient
+func Degree(kinship float64) string {
+	switch {
+	case kinship > DupThreshold:
+		return "dup"
+	case kinship > FirstThreshold:
+		return "1st"
+	case kinship > SecondThreshold:
+		return "2nd"
+	case kinship > ThirdThreshold:
+		return "3rd"
+	}
+	return "unrelated"
+}
+
+// RelatedPairs ...
+// pairs with kinship over minKinship and at least minSNPs shared calls,
+// most related first
+func (k *Kinship) RelatedPairs(minKinship float64, minSNPs int) []Pair {
+	pairs := make([]Pair, 0)
+	for i := 0; i < len(k.Samples); i++ {
+		for j := i + 1; j < len(k.Samples); j++ {
+			pair := k.GetPair(i, j)
+			if pair.N >= minSNPs && pair.Kinship > minKinship {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].Kinship > pairs[b].Kinship })
+	return pairs
+}
+
+// UnrelatedSet ...
+// a maximal unrelated set given the related pairs: the sample in most
+// related pairs is removed (ties on sample id) until no pairs remain.
+// Returns the samples kept and removed, each sorted
+func UnrelatedSet(samples []string, pairs []Pair) ([]string, []string) {
+	edges := make(map[string]map[string]bool)
+	for _, pair := range pairs {
+		if _, ok := edges[pair.Sample1]; !ok {
+			edges[pair.Sample1] = make(map[string]bool)
+		}
+		if _, ok := edges[pair.Sample2]; !ok {
+			edges[pair.Sample2] = make(map[string]bool)
+		}
+		edges[pair.Sample1][pair.Sample2] = true
+		edges[pair.Sample2][pair.Sample1] = true
+	}
+	removed := make([]string, 0)
+	for len(edges) > 0 {
+		worst := ""
+		for samp, related := range edges {
+			if worst == "" || len(related) > len(edges[worst]) || (len(related) == len(edges[worst]) && samp > worst) {
+				worst = samp
+			}
+		}
+		for other := range edges[worst] {
+			delete(edges[other], worst)
+			if len(edges[other]) == 0 {
+				delete(edges, other)
+			}
+		}
+		delete(edges, worst)
+		removed = append(removed, worst)
+	}
+	isRemoved := make(map[string]bool, len(removed))
+	for _, samp := range removed {
+		isRemoved[samp] = true
+	}
+	kept := make([]string, 0, len(samples))
+	for _, samp := range samples {
+		if !isRemoved[samp] {
+			kept = append(kept, samp)
+		}
+	}
+	sort.Strings(kept)
+	sort.Strings(removed)
+	return kept, removed
+}
+
+// TSV ...
+func (pair Pair) TSV() string {
+	return strings.Join([]string{pair.Sample1, pair.Sample2, fmt.Sprintf("%d", pair.N), fmt.Sprintf("%d", pair.HetHet),
+		fmt.Sprintf("%d", pair.IBS0), fmt.Sprintf("%.5f", pair.Kinship), pair.Degree}, "\t")
+}
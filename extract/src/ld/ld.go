@@ -0,0 +1,178 @@
+// Package ld ...
+// Linkage disequilibrium between combined variants
+//
+// Estimates are genotype based (composite LD, no phasing): r2 is the squared
+// correlation of alt allele counts across samples called for both variants,
+// D is half their covariance and D' = D / Dmax for the alt allele frequencies.
+// Allele counts are hard calls (at the probability threshold) or dosages.
+//
+package ld
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"variant"
+)
+
+var firstSampleCol = 9
+
+// VariantValues ...
+// alt allele counts for one variant, called is false for missing genotypes
+type VariantValues struct {
+	Varid  string
+	Chrom  string
+	Posn   int
+	Values []float64
+	Called []bool
+}
+
+// Pair ...
+// LD between two variants
+type Pair struct {
+	Varid1 string
+	Varid2 string
+	Posn1  int
+	Posn2  int
+	N      int
+	R2     float64
+	DPrime float64
+}
+
+// MatrixRow ...
+// a row of the LD matrix for display: upper triangle r2, lower D', diagonal 1
+type MatrixRow struct {
+	Varid string
+	Cells []float64
+}
+
+// Matrix ...
+type Matrix struct {
+	Varids []string
+	Rows   []MatrixRow
+	Pairs  []Pair
+	Mode   string
+}
+
+// GetVariantValues ...
+// allele counts for each combined record, records[0] is the column header
+// record as returned by godb.Getallvardata
+//---------------------------------------------------------------------
+func GetVariantValues(records []string, threshold float64, useDosage bool) []VariantValues {
+	vals := make([]VariantValues, 0, len(records))
+	if len(records) < 2 {
+		return vals
+	}
+	for _, record := range records[1:] {
+		recData := strings.Split(record, "\t")
+		if len(recData) <= firstSampleCol {
+			continue
+		}
+		prfx, genos := variant.GetVCFPrfxSfx(recData)
+		probidx := variant.GetProbIdx(prfx)
+		dsidx := variant.GetDosageIdx(prfx)
+		vv := VariantValues{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx), Posn: variant.GetPosn(prfx),
+			Values: make([]float64, len(genos)), Called: make([]bool, len(genos))}
+		for i, geno := range genos {
+			if useDosage {
+				vv.Values[i], vv.Called[i] = variant.GetDosage(geno, probidx, dsidx)
+			} else {
+				vv.Values[i], vv.Called[i] = variant.GetHardCall(geno, threshold, probidx)
+			}
+		}
+		vals = append(vals, vv)
+	}
+	return vals
+}
+
+// PairLD ...
+// r2 and D' for two variants over samples called in both
+//---------------------------------------------------------------------
+func PairLD(v1 VariantValues, v2 VariantValues) Pair {
+	pair := Pair{Varid1: v1.Varid, Varid2: v2.Varid, Posn1: v1.Posn, Posn2: v2.Posn}
+	var sumx, sumy, sumxx, sumyy, sumxy float64
+
+	for i := range v1.Values {
+		if i >= len(v2.Values) || !v1.Called[i] || !v2.Called[i] {
+			continue
+		}
+		x, y := v1.Values[i], v2.Values[i]
+		sumx += x
+		sumy += y
+		sumxx += x * x
+		sumyy += y * y
+		sumxy += x * y
+		pair.N++
+	}
+	if pair.N < 2 {
+		return pair
+	}
+	n := float64(pair.N)
+	covxy := sumxy/n - (sumx/n)*(sumy/n)
+	varx := sumxx/n - (sumx/n)*(sumx/n)
+	vary := sumyy/n - (sumy/n)*(sumy/n)
+	if varx <= 0.0 || vary <= 0.0 {
+		return pair
+	}
+	pair.R2 = (covxy * covxy) / (varx * vary)
+
+	p1 := sumx / (2.0 * n)
+	p2 := sumy / (2.0 * n)
+	d := covxy / 2.0
+	dmax := math.Min(p1*p2, (1.0-p1)*(1.0-p2))
+	if d > 0.0 {
+		dmax = math.Min(p1*(1.0-p2), (1.0-p1)*p2)
+	}
+	if dmax > 0.0 {
+		pair.DPrime = math.Max(-1.0, math.Min(1.0, d/dmax))
+	}
+	return pair
+}
+
+// GetMatrix ...
+// LD for all pairs of combined records on the same chromosome, useDosage
+// selects dosages over hard calls. Cells for pairs on different
+// chromosomes are NaN
+//---------------------------------------------------------------------
+func GetMatrix(records []string, threshold float64, useDosage bool) Matrix {
+	var matrix Matrix
+
+	matrix.Mode = "hard calls"
+	if useDosage {
+		matrix.Mode = "dosages"
+	}
+	vals := GetVariantValues(records, threshold, useDosage)
+	matrix.Varids = make([]string, len(vals))
+	matrix.Rows = make([]MatrixRow, len(vals))
+	matrix.Pairs = make([]Pair, 0, len(vals)*len(vals)/2)
+	for i := range vals {
+		matrix.Varids[i] = vals[i].Varid
+		matrix.Rows[i] = MatrixRow{Varid: vals[i].Varid, Cells: make([]float64, len(vals))}
+		matrix.Rows[i].Cells[i] = 1.0
+	}
+	for i := 0; i < len(vals); i++ {
+		for j := i + 1; j < len(vals); j++ {
+			// no LD between chromosomes, left as NaN
+			if vals[i].Chrom != vals[j].Chrom {
+				matrix.Rows[i].Cells[j] = math.NaN()
+				matrix.Rows[j].Cells[i] = math.NaN()
+				continue
+			}
+			pair := PairLD(vals[i], vals[j])
+			matrix.Pairs = append(matrix.Pairs, pair)
+			matrix.Rows[i].Cells[j] = pair.R2
+			matrix.Rows[j].Cells[i] = pair.DPrime
+		}
+	}
+	return matrix
+}
+
+// PairHeader ...
+// column headers for pair output
+const PairHeader = "varid1\tposn1\tvarid2\tposn2\tn\tr2\tdprime"
+
+// TSV ...
+func (pair Pair) TSV() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%d\t%d\t%.6f\t%.6f", pair.Varid1, pair.Posn1, pair.Varid2, pair.Posn2,
+		pair.N, pair.R2, pair.DPrime)
+}
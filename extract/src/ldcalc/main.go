@@ -0,0 +1,149 @@
+//------------------------------------------------------------------------------
+// Linkage disequilibrium (r2, D') between combined variants
+//
+// Steps:
+// 1) Read in a file of rs numbers, or take an index rsid plus a window in bp
+//    and find all variants in that region from the variants collection
+// 2) Get combined genotype records via godb.Getallvardata
+// 3) Calculate LD for all pairs using hard calls or dosages (ld package)
+// 4) Output one line per pair, or the LD matrix (-matrix)
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"godb"
+	"ld"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var rsFilePath string
+var rsID string
+var window int
+var vcfPathPref string
+var threshold float64
+var useDosage bool
+var asMatrix bool
+var assayTypes string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/ldcalc_output.log"
+		lusage             = "Log file"
+		defaultRsFilePath  = "./data/rslist1.txt"
+		rsusage            = "File containing list of rsnumbers"
+		defaultRsID        = ""
+		rsidusage          = "Index rsid (region mode, with -window)"
+		defaultWindow      = 250000
+		wusage             = "Region size in bp either side of the index rsid"
+		defaultvcfPathPref = ""
+		vusage             = "default path prefix for vcf files"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold (hard calls)"
+		defaultDosage      = false
+		dusage             = "Use dosages rather than hard calls"
+		defaultMatrix      = false
+		musage             = "Output the LD matrix (upper r2, lower D') rather than pairs"
+		defaultAssayTypes  = "affy,illumina,broad,metabo,exome"
+		atusage            = "Assay types"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&rsFilePath, "rsfile", defaultRsFilePath, rsusage)
+	flag.StringVar(&rsFilePath, "r", defaultRsFilePath, rsusage+" (shorthand)")
+	flag.StringVar(&rsID, "rsid", defaultRsID, rsidusage)
+	flag.StringVar(&rsID, "i", defaultRsID, rsidusage+" (shorthand)")
+	flag.IntVar(&window, "window", defaultWindow, wusage)
+	flag.IntVar(&window, "w", defaultWindow, wusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, vusage)
+	flag.StringVar(&vcfPathPref, "v", defaultvcfPathPref, vusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.BoolVar(&useDosage, "dosage", defaultDosage, dusage)
+	flag.BoolVar(&useDosage, "d", defaultDosage, dusage+" (shorthand)")
+	flag.BoolVar(&asMatrix, "matrix", defaultMatrix, musage)
+	flag.BoolVar(&asMatrix, "m", defaultMatrix, musage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	rsidList := make([]string, 0, 100)
+	if rsID == "" {
+		log.Printf("Open rsfile %s\n", rsFilePath)
+		f, err := os.Open(rsFilePath)
+		check(err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rsidList = append(rsidList, scanner.Text())
+		}
+	} else {
+		rsidList = godb.GetRegionVarids(rsID, window, validAssaytypes)
+		log.Printf("Region %s +/- %d: %d variants\n", rsID, window, len(rsidList))
+	}
+
+	_, _, genorecs := godb.Getallvardata(vcfPathPref, rsidList, validAssaytypes, threshold)
+	matrix := ld.GetMatrix(genorecs, threshold, useDosage)
+	log.Printf("LD (%s) for %d variants, %d pairs\n", matrix.Mode, len(matrix.Varids), len(matrix.Pairs))
+
+	if asMatrix {
+		fmt.Printf("varid\t%s\n", strings.Join(matrix.Varids, "\t"))
+		for _, row := range matrix.Rows {
+			cells := make([]string, len(row.Cells))
+			for i, cell := range row.Cells {
+				cells[i] = fmt.Sprintf("%.4f", cell)
+				if math.IsNaN(cell) {
+					cells[i] = "NA"
+				}
+			}
+			fmt.Printf("%s\t%s\n", row.Varid, strings.Join(cells, "\t"))
+		}
+		return
+	}
+	fmt.Printf("%s\n", ld.PairHeader)
+	for _, pair := range matrix.Pairs {
+		fmt.Printf("%s\n", pair.TSV())
+	}
+}
@@ -0,0 +1,416 @@
+// Package pca ...
+// Principal components of combined genotypes by randomized truncated SVD
+//
+// Hard calls are standardised per SNP, (g - 2p) / sqrt(2p(1-p)), missing
+// calls set to the mean (0), giving the samples x SNPs matrix X. The top k
+// eigenvectors of XX'/m (m SNPs) are found as in Halko et al. 2011: a
+// random range Y = X X' Omega refined by power iterations, orthonormalised
+// to Q, then the small (k + oversample) square matrix (X'Q)'(X'Q) is
+// diagonalised by Jacobi rotations.
+//
+// Records are streamed and SNPs LD pruned as for kinship. Hard calls are
+// held as int8, memory is O(samples x SNPs) bytes
+package pca
+
+import (
+	"fmt"
+	"kinship"
+	"ld"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"variant"
+)
+
+// SNP ...
+// a SNP used, with the allele frequency used to standardise
+type SNP struct {
+	Varid string
+	Chrom string
+	Posn  int
+	Ref   string
+	Alt   string
+	AF    float64
+}
+
+// PCA ...
+// hard calls (0,1,2, -1 missing) for the SNPs kept
+type PCA struct {
+	Samples   []string
+	Threshold float64
+	Pruner    *kinship.Pruner
+	SNPs      []SNP
+	genos     [][]int8
+}
+
+// Result ...
+// Eigenvalues of XX'/m, proportion of the total variance (trace) explained,
+// sample scores (eigenvectors, samples x k) and SNP loadings (SNPs x k)
+type Result struct {
+	Eigenvalues  []float64
+	VarExplained []float64
+	Scores       [][]float64
+	Loadings     [][]float64
+}
+
+// NewPCA ...
+// sampleNames are the sample columns of the records to be added, pruner may
+// be nil (all SNPs used)
+func NewPCA(sampleNames []string, threshold float64, pruner *kinship.Pruner) *PCA {
+	return &PCA{Samples: sampleNames, Threshold: threshold, Pruner: pruner, SNPs: make([]SNP, 0, 1000),
+		genos: make([][]int8, 0, 1000)}
+}
+
+// AddRecord ...
+// add one combined VCF record-as-slice, returns false if the SNP is pruned
+// or monomorphic
+func (pc *PCA) AddRecord(rec []string) bool {
+	if len(rec) <= 9 {
+		return false
+	}
+	prfx, genos := variant.GetVCFPrfxSfx(rec)
+	if len(genos) != len(pc.Samples) {
+		return false
+	}
+	probidx := variant.GetProbIdx(prfx)
+	calls := make([]int8, len(genos))
+	values := make([]float64, len(genos))
+	called := make([]bool, len(genos))
+	sum, n := 0.0, 0
+	for i, geno := range genos {
+		values[i], called[i] = variant.GetHardCall(geno, pc.Threshold, probidx)
+		calls[i] = -1
+		if called[i] {
+			calls[i] = int8(values[i])
+			sum += values[i]
+			n++
+		}
+	}
+	if n == 0 {
+		return false
+	}
+	af := sum / float64(2*n)
+	if af <= 0.0 || af >= 1.0 {
+		return false
+	}
+	if pc.Pruner != nil {
+		vv := ld.VariantValues{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx), Posn: variant.GetPosn(prfx),
+			Values: values, Called: called}
+		if !pc.Pruner.Keep(vv) {
+			return false
+		}
+	}
+	ref, alt := variant.GetAlleles(prfx)
+	pc.SNPs = append(pc.SNPs, SNP{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx), Posn: variant.GetPosn(prfx),
+		Ref: ref, Alt: alt, AF: af})
+	pc.genos = append(pc.genos, calls)
+	return true
+}
+
+// standardised values for SNP j, missing as 0
+func (pc *PCA) row(j int, x []float64) {
+	mean := 2.0 * pc.SNPs[j].AF
+	sd := math.Sqrt(2.0 * pc.SNPs[j].AF * (1.0 - pc.SNPs[j].AF))
+	for i, g := range pc.genos[j] {
+		x[i] = 0.0
+		if g >= 0 {
+			x[i] = (float64(g) - mean) / sd
+		}
+	}
+}
+
+// Z = X'Q, Q samples x l, Z SNPs x l
+func (pc *PCA) mulXt(q [][]float64) [][]float64 {
+	l := len(q[0])
+	x := make([]float64, len(pc.Samples))
+	z := make([][]float64, len(pc.SNPs))
+	for j := range pc.SNPs {
+		pc.row(j, x)
+		z[j] = make([]float64, l)
+		for i, xij := range x {
+			if xij == 0.0 {
+				continue
+			}
+			for c := 0; c < l; c++ {
+				z[j][c] += xij * q[i][c]
+			}
+		}
+	}
+	return z
+}
+
+// Y = XZ, Z SNPs x l, Y samples x l
+func (pc *PCA) mulX(z [][]float64) [][]float64 {
+	l := len(z[0])
+	x := make([]float64, len(pc.Samples))
+	y := newMatrix(len(pc.Samples), l)
+	for j := range pc.SNPs {
+		pc.row(j, x)
+		for i, xij := range x {
+			if xij == 0.0 {
+				continue
+			}
+			for c := 0; c < l; c++ {
+				y[i][c] += xij * z[j][c]
+			}
+		}
+	}
+	return y
+}
+
+// Run ...
+// the top k components, oversample extra random vectors and iterations power
+// iterations (2-4 is usually enough), seed for the random start
+func (pc *PCA) Run(k int, oversample int, iterations int, seed int64) (Result, error) {
+	n, m := len(pc.Samples), len(pc.SNPs)
+	if k < 1 || n < 2 || m < 2 {
+		return Result{}, fmt.Errorf("pca: need k >= 1, at least 2 samples and 2 SNPs (k=%d, samples=%d, snps=%d)", k, n, m)
+	}
+	l := k + oversample
+	if l > n {
+		l = n
+	}
+	if l > m {
+		l = m
+	}
+	if k > l {
+		k = l
+	}
+	rng := rand.New(rand.NewSource(seed))
+	omega := newMatrix(m, l)
+	for j := range omega {
+		for c := range omega[j] {
+			omega[j][c] = rng.NormFloat64()
+		}
+	}
+	q := pc.mulX(omega)
+	orthonormalise(q)
+	for it := 0; it < iterations; it++ {
+		q = pc.mulX(pc.mulXt(q))
+		orthonormalise(q)
+	}
+	// B' = X'Q, eigen decomposition of BB' (l x l)
+	bt := pc.mulXt(q)
+	bbt := newMatrix(l, l)
+	for j := range bt {
+		for a := 0; a < l; a++ {
+			for b := a; b < l; b++ {
+				bbt[a][b] += bt[j][a] * bt[j][b]
+			}
+		}
+	}
+	for a := 0; a < l; a++ {
+		for b := 0; b < a; b++ {
+			bbt[a][b] = bbt[b][a]
+		}
+	}
+	evals, evecs := jacobiEigen(bbt)
+
+	trace := 0.0
+	x := make([]float64, n)
+	for j := range pc.SNPs {
+		pc.row(j, x)
+		for _, xij := range x {
+			trace += xij * xij
+		}
+	}
+
+	res := Result{Eigenvalues: make([]float64, k), VarExplained: make([]float64, k), Scores: newMatrix(n, k),
+		Loadings: newMatrix(m, k)}
+	for c := 0; c < k; c++ {
+		res.Eigenvalues[c] = evals[c] / float64(m)
+		if trace > 0.0 {
+			res.VarExplained[c] = evals[c] / trace
+		}
+		// U = QW, one column per component
+		for i := 0; i < n; i++ {
+			for a := 0; a < l; a++ {
+				res.Scores[i][c] += q[i][a] * evecs[a][c]
+			}
+		}
+		sign := signConvention(res.Scores, c)
+		for i := 0; i < n; i++ {
+			res.Scores[i][c] *= sign
+		}
+		// V = B'W / s
+		s := math.Sqrt(evals[c])
+		for j := 0; j < m; j++ {
+			if s > 0.0 {
+				for a := 0; a < l; a++ {
+					res.Loadings[j][c] += bt[j][a] * evecs[a][c]
+				}
+				res.Loadings[j][c] *= sign / s
+			}
+		}
+	}
+	return res, nil
+}
+
+// components have arbitrary sign, make the largest absolute score positive
+func signConvention(scores [][]float64, c int) float64 {
+	maxAbs, sign := 0.0, 1.0
+	for i := range scores {
+		if math.Abs(scores[i][c]) > maxAbs {
+			maxAbs = math.Abs(scores[i][c])
+			sign = 1.0
+			if scores[i][c] < 0.0 {
+				sign = -1.0
+			}
+		}
+	}
+	return sign
+}
+
+func newMatrix(rows int, cols int) [][]float64 {
+	mat := make([][]float64, rows)
+	for i := range mat {
+		mat[i] = make([]float64, cols)
+	}
+	return mat
+}
+
+// modified Gram-Schmidt on the columns of a, in place, dependent columns
+// are left as zero
+func orthonormalise(a [][]float64) {
+	cols := len(a[0])
+	for c := 0; c < cols; c++ {
+		for p := 0; p < c; p++ {
+			dot := 0.0
+			for i := range a {
+				dot += a[i][c] * a[i][p]
+			}
+			for i := range a {
+				a[i][c] -= dot * a[i][p]
+			}
+		}
+		norm := 0.0
+		for i := range a {
+			norm += a[i][c] * a[i][c]
+		}
+		norm = math.Sqrt(norm)
+		for i := range a {
+			if norm > 1e-12 {
+				a[i][c] /= norm
+			} else {
+				a[i][c] = 0.0
+			}
+		}
+	}
+}
+
+// eigenvalues (descending) and eigenvectors (columns) of a small symmetric
+// matrix by cyclic Jacobi rotations, a is overwritten
+func jacobiEigen(a [][]float64) ([]float64, [][]float64) {
+	l := len(a)
+	v := newMatrix(l, l)
+	for i := 0; i < l; i++ {
+		v[i][i] = 1.0
+	}
+	for sweep := 0; sweep < 100; sweep++ {
+		off := 0.0
+		for p := 0; p < l; p++ {
+			for q := p + 1; q < l; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-22 {
+			break
+		}
+		for p := 0; p < l; p++ {
+			for q := p + 1; q < l; q++ {
+				if math.Abs(a[p][q]) < 1e-300 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2.0 * a[p][q])
+				t := 1.0 / (math.Abs(theta) + math.Sqrt(theta*theta+1.0))
+				if theta < 0.0 {
+					t = -t
+				}
+				cos := 1.0 / math.Sqrt(t*t+1.0)
+				sin := t * cos
+				for r := 0; r < l; r++ {
+					arp, arq := a[r][p], a[r][q]
+					a[r][p] = cos*arp - sin*arq
+					a[r][q] = sin*arp + cos*arq
+				}
+				for r := 0; r < l; r++ {
+					apr, aqr := a[p][r], a[q][r]
+					a[p][r] = cos*apr - sin*aqr
+					a[q][r] = sin*apr + cos*aqr
+				}
+				for r := 0; r < l; r++ {
+					vrp, vrq := v[r][p], v[r][q]
+					v[r][p] = cos*vrp - sin*vrq
+					v[r][q] = sin*vrp + cos*vrq
+				}
+			}
+		}
+	}
+	order := make([]int, l)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool { return a[order[x]][order[x]] > a[order[y]][order[y]] })
+	evals := make([]float64, l)
+	evecs := newMatrix(l, l)
+	for c, idx := range order {
+		evals[c] = math.Max(a[idx][idx], 0.0)
+		for r := 0; r < l; r++ {
+			evecs[r][c] = v[r][idx]
+		}
+	}
+	return evals, evecs
+}
+
+// PCNames ...
+// column names PC1..PCk
+func PCNames(k int) []string {
+	names := make([]string, k)
+	for c := range names {
+		names[c] = fmt.Sprintf("PC%d", c+1)
+	}
+	return names
+}
+
+// EigenvalueLines ...
+// pc, eigenvalue, proportion of variance explained, with header
+func (res Result) EigenvalueLines() []string {
+	lines := make([]string, 0, len(res.Eigenvalues)+1)
+	lines = append(lines, "pc\teigenvalue\tvarexplained")
+	for c, ev := range res.Eigenvalues {
+		lines = append(lines, fmt.Sprintf("PC%d\t%.6f\t%.6f", c+1, ev, res.VarExplained[c]))
+	}
+	return lines
+}
+
+// ScoreLines ...
+// sample, PC1..PCk, with header
+func (res Result) ScoreLines(samples []string) []string {
+	lines := make([]string, 0, len(samples)+1)
+	lines = append(lines, "sample\t"+strings.Join(PCNames(len(res.Eigenvalues)), "\t"))
+	for i, samp := range samples {
+		lines = append(lines, samp+"\t"+formatRow(res.Scores[i]))
+	}
+	return lines
+}
+
+// LoadingLines ...
+// varid, chr, posn, ref, alt, af, PC1..PCk, with header
+func (res Result) LoadingLines(snps []SNP) []string {
+	lines := make([]string, 0, len(snps)+1)
+	lines = append(lines, "varid\tchr\tposn\tref\talt\taf\t"+strings.Join(PCNames(len(res.Eigenvalues)), "\t"))
+	for j, snp := range snps {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%s\t%s\t%.6f\t%s", snp.Varid, snp.Chrom, snp.Posn, snp.Ref, snp.Alt,
+			snp.AF, formatRow(res.Loadings[j])))
+	}
+	return lines
+}
+
+func formatRow(row []float64) string {
+	cols := make([]string, len(row))
+	for c, val := range row {
+		cols[c] = fmt.Sprintf("%.6f", val)
+	}
+	return strings.Join(cols, "\t")
+}
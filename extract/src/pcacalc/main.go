@@ -0,0 +1,213 @@
+//------------------------------------------------------------------------------
+// Principal components of combined genotypes
+//
+// Steps:
+// 1) Stream combined records in position order (godb.GetPositionOrderedRecords),
+//    either from a combined VCF file (filemergevcf or vcombine output,
+//    -vcfpath) or from godb.Getallvardata for a file of rs numbers (-rsfile)
+// 2) LD prune and filter SNPs (MAF, call rate) as for relatedness
+// 3) Randomized truncated PCA (pca package) for the top -npcs components
+// 4) Output sample scores, optionally eigenvalues (-evalfile) and SNP
+//    loadings (-loadfile) and save the scores as Continuous phenotypes
+//    <name>_PC1 .. <name>_PCk in ehrdb (-phenoname) for use as covariates
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"ehrdb"
+	"flag"
+	"fmt"
+	"godb"
+	"kinship"
+	"log"
+	"os"
+	"pca"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var vcfPath string
+var rsFilePath string
+var vcfPathPref string
+var threshold float64
+var window int
+var maxr2 float64
+var minmaf float64
+var mincr float64
+var npcs int
+var oversample int
+var iterations int
+var seed int64
+var assayTypes string
+var evalPath string
+var loadPath string
+var phenoName string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/pcacalc_output.log"
+		lusage             = "Log file"
+		defaultvcfPath     = ""
+		vusage             = "Combined vcf file (.gz or plain text), default: use -rsfile"
+		defaultRsFilePath  = "./data/rslist1.txt"
+		rsusage            = "File containing list of rsnumbers"
+		defaultvcfPathPref = ""
+		pusage             = "default path prefix for vcf files"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold"
+		defaultWindow      = 500000
+		wusage             = "LD pruning window in bp"
+		defaultMaxR2       = 0.2
+		r2usage            = "LD pruning maximum r2"
+		defaultMinMaf      = 0.05
+		mafusage           = "Minimum MAF"
+		defaultMinCr       = 0.95
+		crusage            = "Minimum SNP call rate"
+		defaultNpcs        = 10
+		kusage             = "Number of principal components"
+		defaultOversample  = 10
+		ousage             = "Extra random vectors for the randomized range"
+		defaultIterations  = 4
+		iusage             = "Power iterations"
+		defaultSeed        = 1
+		seedusage          = "Random seed"
+		defaultAssayTypes  = "affy,illumina,broad,metabo,exome"
+		atusage            = "Assay types"
+		defaultEvalPath    = ""
+		eusage             = "Output file for eigenvalues"
+		defaultLoadPath    = ""
+		ldusage            = "Output file for SNP loadings"
+		defaultPhenoName   = ""
+		phusage            = "Save scores as Continuous phenotypes <name>_PC1 .."
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&vcfPath, "vcfpath", defaultvcfPath, vusage)
+	flag.StringVar(&vcfPath, "v", defaultvcfPath, vusage+" (shorthand)")
+	flag.StringVar(&rsFilePath, "rsfile", defaultRsFilePath, rsusage)
+	flag.StringVar(&rsFilePath, "r", defaultRsFilePath, rsusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, pusage)
+	flag.StringVar(&vcfPathPref, "p", defaultvcfPathPref, pusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.IntVar(&window, "window", defaultWindow, wusage)
+	flag.IntVar(&window, "w", defaultWindow, wusage+" (shorthand)")
+	flag.Float64Var(&maxr2, "maxr2", defaultMaxR2, r2usage)
+	flag.Float64Var(&maxr2, "x", defaultMaxR2, r2usage+" (shorthand)")
+	flag.Float64Var(&minmaf, "minmaf", defaultMinMaf, mafusage)
+	flag.Float64Var(&minmaf, "m", defaultMinMaf, mafusage+" (shorthand)")
+	flag.Float64Var(&mincr, "mincr", defaultMinCr, crusage)
+	flag.Float64Var(&mincr, "c", defaultMinCr, crusage+" (shorthand)")
+	flag.IntVar(&npcs, "npcs", defaultNpcs, kusage)
+	flag.IntVar(&npcs, "k", defaultNpcs, kusage+" (shorthand)")
+	flag.IntVar(&oversample, "oversample", defaultOversample, ousage)
+	flag.IntVar(&oversample, "o", defaultOversample, ousage+" (shorthand)")
+	flag.IntVar(&iterations, "iterations", defaultIterations, iusage)
+	flag.IntVar(&iterations, "i", defaultIterations, iusage+" (shorthand)")
+	flag.Int64Var(&seed, "seed", defaultSeed, seedusage)
+	flag.Int64Var(&seed, "s", defaultSeed, seedusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.StringVar(&evalPath, "evalfile", defaultEvalPath, eusage)
+	flag.StringVar(&evalPath, "e", defaultEvalPath, eusage+" (shorthand)")
+	flag.StringVar(&loadPath, "loadfile", defaultLoadPath, ldusage)
+	flag.StringVar(&loadPath, "d", defaultLoadPath, ldusage+" (shorthand)")
+	flag.StringVar(&phenoName, "phenoname", defaultPhenoName, phusage)
+	flag.StringVar(&phenoName, "n", defaultPhenoName, phusage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START pcacalc npcs=%d, window=%d, maxr2=%.2f, minmaf=%.3f, mincr=%.3f\n",
+		npcs, window, maxr2, minmaf, mincr)
+
+	pruner := kinship.NewPruner(window, maxr2, minmaf, mincr)
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+	// LD pruning needs records in position order
+	sampleNames, records := godb.GetPositionOrderedRecords(vcfPath, rsFilePath, vcfPathPref, validAssaytypes, threshold)
+	pc := pca.NewPCA(sampleNames, threshold, pruner)
+	rcount := 0
+	for fields := range records {
+		pc.AddRecord(fields)
+		rcount++
+	}
+	log.Printf("Records read=%d, SNPs used after pruning=%d, samples=%d\n", rcount, len(pc.SNPs), len(pc.Samples))
+
+	res, err := pc.Run(npcs, oversample, iterations, seed)
+	check(err)
+	for _, line := range res.EigenvalueLines()[1:] {
+		log.Printf("%s\n", line)
+	}
+	for _, line := range res.ScoreLines(pc.Samples) {
+		fmt.Printf("%s\n", line)
+	}
+	if evalPath != "" {
+		writeLines(evalPath, res.EigenvalueLines())
+	}
+	if loadPath != "" {
+		writeLines(loadPath, res.LoadingLines(pc.SNPs))
+	}
+	if phenoName != "" {
+		for c, pcName := range pca.PCNames(len(res.Eigenvalues)) {
+			scores := make(map[string]string, len(pc.Samples))
+			for i, samp := range pc.Samples {
+				scores[samp] = fmt.Sprintf("%.6f", res.Scores[i][c])
+			}
+			name := phenoName + "_" + pcName
+			ok, msg := ehrdb.InsertPhenoDataWithCheck(name, "pcacalc",
+				fmt.Sprintf("%s, eigenvalue %.4f, %d SNPs", pcName, res.Eigenvalues[c], len(pc.SNPs)), "Continuous", scores)
+			if ok != true {
+				log.Printf("Phenotype %s not saved: %s\n", name, msg)
+			} else {
+				log.Printf("Saved phenotype %s, %d samples\n", name, len(scores))
+			}
+		}
+	}
+	log.Printf("END pcacalc\n")
+}
+
+//-------------------------------------------------------------
+// Write lines to a file
+//-------------------------------------------------------------
+func writeLines(path string, lines []string) {
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	check(w.Flush())
+}
@@ -0,0 +1,182 @@
+//------------------------------------------------------------------------------
+// Kinship and relatedness on combined genotypes
+//
+// Steps:
+// 1) Stream combined records in position order (godb.GetPositionOrderedRecords),
+//    either from a combined VCF file (filemergevcf or vcombine output,
+//    -vcfpath) or from godb.Getallvardata for a file of rs numbers (-rsfile)
+// 2) LD prune and filter SNPs (MAF, call rate) and accumulate KING-robust
+//    pair counts (kinship package)
+// 3) Output the related pairs table, then suggest a maximal unrelated set.
+//    The related samples removed can be written to a file (-exclfile) and/or
+//    the unrelated samples saved as a named sample set (-sampleset). The
+//    sample exclusion list is not changed, -exclfile output can be applied
+//    deliberately (e.g. filemergevcf -exclfile)
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"ehrdb"
+	"flag"
+	"fmt"
+	"godb"
+	"kinship"
+	"log"
+	"os"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var vcfPath string
+var rsFilePath string
+var vcfPathPref string
+var threshold float64
+var window int
+var maxr2 float64
+var minmaf float64
+var mincr float64
+var minkin float64
+var minsnps int
+var assayTypes string
+var exclPath string
+var samplesetName string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/relatedness_output.log"
+		lusage             = "Log file"
+		defaultvcfPath     = ""
+		vusage             = "Combined vcf file (.gz or plain text), default: use -rsfile"
+		defaultRsFilePath  = "./data/rslist1.txt"
+		rsusage            = "File containing list of rsnumbers"
+		defaultvcfPathPref = ""
+		pusage             = "default path prefix for vcf files"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold"
+		defaultWindow      = 500000
+		wusage             = "LD pruning window in bp"
+		defaultMaxR2       = 0.2
+		r2usage            = "LD pruning maximum r2"
+		defaultMinMaf      = 0.05
+		mafusage           = "Minimum MAF"
+		defaultMinCr       = 0.95
+		crusage            = "Minimum SNP call rate"
+		defaultMinKin      = kinship.SecondThreshold
+		kusage             = "Kinship above which pairs are related (default 2nd degree)"
+		defaultMinSnps     = 100
+		nusage             = "Minimum shared called SNPs for a pair"
+		defaultAssayTypes  = "affy,illumina,broad,metabo,exome"
+		atusage            = "Assay types"
+		defaultExclPath    = ""
+		eusage             = "Output file for related samples removed from the unrelated set"
+		defaultSampleset   = ""
+		susage             = "Save the unrelated samples as this named sample set"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&vcfPath, "vcfpath", defaultvcfPath, vusage)
+	flag.StringVar(&vcfPath, "v", defaultvcfPath, vusage+" (shorthand)")
+	flag.StringVar(&rsFilePath, "rsfile", defaultRsFilePath, rsusage)
+	flag.StringVar(&rsFilePath, "r", defaultRsFilePath, rsusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, pusage)
+	flag.StringVar(&vcfPathPref, "p", defaultvcfPathPref, pusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.IntVar(&window, "window", defaultWindow, wusage)
+	flag.IntVar(&window, "w", defaultWindow, wusage+" (shorthand)")
+	flag.Float64Var(&maxr2, "maxr2", defaultMaxR2, r2usage)
+	flag.Float64Var(&maxr2, "x", defaultMaxR2, r2usage+" (shorthand)")
+	flag.Float64Var(&minmaf, "minmaf", defaultMinMaf, mafusage)
+	flag.Float64Var(&minmaf, "m", defaultMinMaf, mafusage+" (shorthand)")
+	flag.Float64Var(&mincr, "mincr", defaultMinCr, crusage)
+	flag.Float64Var(&mincr, "c", defaultMinCr, crusage+" (shorthand)")
+	flag.Float64Var(&minkin, "minkin", defaultMinKin, kusage)
+	flag.Float64Var(&minkin, "k", defaultMinKin, kusage+" (shorthand)")
+	flag.IntVar(&minsnps, "minsnps", defaultMinSnps, nusage)
+	flag.IntVar(&minsnps, "n", defaultMinSnps, nusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.StringVar(&exclPath, "exclfile", defaultExclPath, eusage)
+	flag.StringVar(&exclPath, "e", defaultExclPath, eusage+" (shorthand)")
+	flag.StringVar(&samplesetName, "sampleset", defaultSampleset, susage)
+	flag.StringVar(&samplesetName, "s", defaultSampleset, susage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START relatedness window=%d, maxr2=%.2f, minmaf=%.3f, mincr=%.3f, minkin=%.4f\n",
+		window, maxr2, minmaf, mincr, minkin)
+
+	pruner := kinship.NewPruner(window, maxr2, minmaf, mincr)
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+	// LD pruning needs records in position order
+	sampleNames, records := godb.GetPositionOrderedRecords(vcfPath, rsFilePath, vcfPathPref, validAssaytypes, threshold)
+	kin := kinship.NewKinship(sampleNames, threshold, pruner)
+	rcount := 0
+	for fields := range records {
+		kin.AddRecord(fields)
+		rcount++
+	}
+	log.Printf("Records read=%d, SNPs used after pruning=%d, samples=%d\n", rcount, kin.SNPCount, len(kin.Samples))
+
+	pairs := kin.RelatedPairs(minkin, minsnps)
+	fmt.Printf("%s\n", kinship.PairHeader)
+	for _, pair := range pairs {
+		fmt.Printf("%s\n", pair.TSV())
+	}
+	unrelated, removed := kinship.UnrelatedSet(kin.Samples, pairs)
+	log.Printf("Related pairs=%d, unrelated set=%d, removed=%d\n", len(pairs), len(unrelated), len(removed))
+
+	if exclPath != "" {
+		fe, err := os.Create(exclPath)
+		check(err)
+		defer fe.Close()
+		w := bufio.NewWriter(fe)
+		for _, samp := range removed {
+			fmt.Fprintf(w, "%s\n", samp)
+		}
+		check(w.Flush())
+	}
+	if samplesetName != "" {
+		res, msg := ehrdb.InsertSamplesetDataWithCheck(samplesetName,
+			fmt.Sprintf("Unrelated samples, kinship <= %.4f over %d SNPs", minkin, kin.SNPCount), unrelated)
+		if res != true {
+			log.Printf("Sample set %s not saved: %s\n", samplesetName, msg)
+		} else {
+			log.Printf("Saved sample set %s, %d samples\n", samplesetName, len(unrelated))
+		}
+	}
+	log.Printf("END relatedness\n")
+}
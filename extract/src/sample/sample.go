@@ -7,8 +7,12 @@ package sample
 //---------------------------------------------------
 
 import (
+	"bufio"
 	"fmt"
+	"log"
+	"os"
 	"sort"
+	"strings"
 )
 
 //---------------------------------------------------
@@ -75,3 +79,118 @@ func GetCombinedSampleMapByAssaytypes(samplesByAssayType map[string]map[string]i
 	}
 	return sample_index
 }
+// AllAssaytypes ...
+// assaytype key in an exclusion map for a sample excluded from all assaytypes
+const AllAssaytypes = ""
+
+//------------------------------------------------------------------------------
+// Remove excluded samples from the maps by assaytype, excluded maps sample_id
+// to the assaytypes it is excluded from (AllAssaytypes for all assaytypes).
+// Returns the number of sample columns removed
+//------------------------------------------------------------------------------
+func ExcludeSamples(sampleNamePosn map[string]map[string]int, samplePosnName map[string]map[int]string, excluded map[string]map[string]bool) int {
+	count := 0
+	for at, names := range sampleNamePosn {
+		for samp, posn := range names {
+			if exclAts, ok := excluded[samp]; ok && (exclAts[AllAssaytypes] || exclAts[at]) {
+				delete(sampleNamePosn[at], samp)
+				delete(samplePosnName[at], posn)
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// AddExclusion ...
+// add a sample's exclusion from an assaytype (AllAssaytypes for all) to an
+// exclusion map
+func AddExclusion(excluded map[string]map[string]bool, sampleID string, assaytype string) {
+	if _, ok := excluded[sampleID]; !ok {
+		excluded[sampleID] = make(map[string]bool)
+	}
+	excluded[sampleID][assaytype] = true
+}
+//------------------------------------------------------------------------------
+// Remove all samples not in the included set (a named sample set) from the
+// maps by assaytype. Returns the number of sample columns remaining
+//------------------------------------------------------------------------------
+func RestrictSamples(sampleNamePosn map[string]map[string]int, samplePosnName map[string]map[int]string, included map[string]bool) int {
+	count := 0
+	for at, names := range sampleNamePosn {
+		for samp, posn := range names {
+			if !included[samp] {
+				delete(sampleNamePosn[at], samp)
+				delete(samplePosnName[at], posn)
+				continue
+			}
+			count++
+		}
+	}
+	return count
+}
+//------------------------------------------------------------------------------
+// Rename samples to their canonical subject id, so that the same person is a
+// single column when panels are combined. aliases maps assaytype to sample_id
+// to subject_id, an assaytype of "" applies to all assaytypes. Where two
+// samples in one assaytype alias to the same subject the lower list position
+// is kept. Returns the number of samples renamed
+//------------------------------------------------------------------------------
+func ApplyAliases(sampleNamePosn map[string]map[string]int, samplePosnName map[string]map[int]string, aliases map[string]map[string]string) int {
+	count := 0
+	for at, posnNames := range samplePosnName {
+		posns := make([]int, 0, len(posnNames))
+		for posn := range posnNames {
+			posns = append(posns, posn)
+		}
+		sort.Ints(posns)
+		names := make(map[string]int, len(posns))
+		for _, posn := range posns {
+			samp := posnNames[posn]
+			subject, ok := aliases[at][samp]
+			if !ok {
+				subject, ok = aliases[""][samp]
+			}
+			if !ok {
+				subject = samp
+			}
+			if _, dup := names[subject]; dup {
+				log.Printf("Duplicate subject %s (%s) in %s, list posn %d dropped\n", subject, samp, at, posn)
+				delete(posnNames, posn)
+				continue
+			}
+			if subject != samp {
+				posnNames[posn] = subject
+				count++
+			}
+			names[subject] = posn
+		}
+		sampleNamePosn[at] = names
+	}
+	return count
+}
+//------------------------------------------------------------------------------
+// Read a sample alias file, csv lines of assaytype,sample_id,subject_id
+// (an optional header line starting "assaytype" is skipped). Returns the
+// aliases as used by ApplyAliases
+//------------------------------------------------------------------------------
+func ReadAliasFile(path string) (map[string]map[string]string, error) {
+	aliases := make(map[string]map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return aliases, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 3 || fields[0] == "assaytype" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, ok := aliases[fields[0]]; !ok {
+			aliases[fields[0]] = make(map[string]string)
+		}
+		aliases[fields[0]][fields[1]] = fields[2]
+	}
+	return aliases, scanner.Err()
+}
@@ -0,0 +1,121 @@
+//------------------------------------------------------------------------------
+// Manage sample aliases: per-panel sample ids mapped to a canonical subject id
+//
+// godb.GetSamplesByAssaytype renames samples to their subject id, so one
+// person genotyped on several panels under different ids is a single column
+// in combined output.
+//
+// Either:
+// 1) load aliases from a csv file (-aliasfile) of assaytype,sample_id,subject_id
+//    lines, an empty assaytype applies to all panels
+// 2) write the audit export (-audit): subject id, assaytype, original
+//    sample id, list position and whether an alias was applied, for every
+//    sample in the requested assaytypes
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"godb"
+	"log"
+	"os"
+	"sample"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var aliasFilePath string
+var auditFilePath string
+var assayTypes string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath   = "./data/samplealias_output.log"
+		lusage               = "Log file"
+		defaultAliasFilePath = ""
+		ausage               = "Alias file to load (assaytype,sample_id,subject_id per line)"
+		defaultAuditFilePath = ""
+		ousage               = "Audit export file of original per-panel sample ids (- for stdout)"
+		defaultAssayTypes    = "affy,illumina,broad,metabo,exome"
+		atusage              = "Assay types (audit export)"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&aliasFilePath, "aliasfile", defaultAliasFilePath, ausage)
+	flag.StringVar(&aliasFilePath, "f", defaultAliasFilePath, ausage+" (shorthand)")
+	flag.StringVar(&auditFilePath, "audit", defaultAuditFilePath, ousage)
+	flag.StringVar(&auditFilePath, "o", defaultAuditFilePath, ousage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	if aliasFilePath != "" {
+		aliases, err := sample.ReadAliasFile(aliasFilePath)
+		check(err)
+		count := 0
+		for at, samples := range aliases {
+			for sampleID, subjectID := range samples {
+				if godb.InsertSampleAlias(at, sampleID, subjectID) {
+					count++
+				}
+			}
+		}
+		log.Printf("Loaded %d aliases from %s\n", count, aliasFilePath)
+		fmt.Printf("Loaded %d aliases\n", count)
+	}
+
+	if auditFilePath != "" {
+		audit := godb.GetSampleAliasAudit(validAssaytypes)
+		out := os.Stdout
+		if auditFilePath != "-" {
+			out, err = os.Create(auditFilePath)
+			check(err)
+			defer out.Close()
+		}
+		w := bufio.NewWriter(out)
+		fmt.Fprintf(w, "subject_id\tassaytype\tsample_id\tlist_posn\taliased\n")
+		for _, line := range audit {
+			fmt.Fprintf(w, "%s\n", line)
+		}
+		check(w.Flush())
+		log.Printf("Audit export %s, %d samples\n", auditFilePath, len(audit))
+	}
+}
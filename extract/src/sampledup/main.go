@@ -0,0 +1,188 @@
+//------------------------------------------------------------------------------
+// Duplicate and mislabelled sample detection across panels
+//
+// Steps:
+// 1) Read in a file of rs numbers, or (no rsfile) walk the variants collection
+//    for rsids present in more than one of the requested assaytypes
+// 2) In batches, get the VCF records for each rsid from all assaytypes and
+//    keep hard calls for panel records passing the call rate and MAF filters
+//    (up to -maxsnps variants)
+// 3) Compare genotypes for the same sample id on each pair of panels, and
+//    for candidate hidden duplicates: pairs of (assaytype, sample) with
+//    identical calls over a block of shared SNPs (every pair where panels
+//    share few SNPs). Sample ids are subject ids after aliasing
+// 4) Output a ranked report of possible swaps (same id, discordant) and
+//    hidden duplicates (different ids, near-identical)
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"genometrics"
+	"godb"
+	"log"
+	"os"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var rsFilePath string
+var vcfPathPref string
+var threshold float64
+var mincr float64
+var minmaf float64
+var minsnps int
+var maxsnps int
+var maxdiscord float64
+var minconc float64
+var assayTypes string
+var batchSize int
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/sampledup_output.log"
+		lusage             = "Log file"
+		defaultRsFilePath  = ""
+		rsusage            = "File containing list of rsnumbers (default: all multi-assay variants)"
+		defaultvcfPathPref = ""
+		vusage             = "default path prefix for vcf files"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold"
+		defaultMinCr       = 0.98
+		crusage            = "Minimum panel call rate for a SNP to be used"
+		defaultMinMaf      = 0.05
+		mafusage           = "Minimum panel MAF for a SNP to be used"
+		defaultMinSnps     = 50
+		minsusage          = "Minimum shared called SNPs for a pair to be compared"
+		defaultMaxSnps     = 5000
+		maxsusage          = "Maximum SNPs used (0 = all)"
+		defaultMaxDiscord  = 0.1
+		dusage             = "Discordance above which the same sample id is flagged (swap)"
+		defaultMinConc     = 0.98
+		cusage             = "Concordance at or above which different ids are flagged (duplicate)"
+		defaultAssayTypes  = "affy,illumina,broad,metabo,exome"
+		atusage            = "Assay types"
+		defaultBatchSize   = 1000
+		busage             = "Number of rsids read per batch"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&rsFilePath, "rsfile", defaultRsFilePath, rsusage)
+	flag.StringVar(&rsFilePath, "r", defaultRsFilePath, rsusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, vusage)
+	flag.StringVar(&vcfPathPref, "v", defaultvcfPathPref, vusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.Float64Var(&mincr, "mincr", defaultMinCr, crusage)
+	flag.Float64Var(&mincr, "c", defaultMinCr, crusage+" (shorthand)")
+	flag.Float64Var(&minmaf, "minmaf", defaultMinMaf, mafusage)
+	flag.Float64Var(&minmaf, "m", defaultMinMaf, mafusage+" (shorthand)")
+	flag.IntVar(&minsnps, "minsnps", defaultMinSnps, minsusage)
+	flag.IntVar(&minsnps, "n", defaultMinSnps, minsusage+" (shorthand)")
+	flag.IntVar(&maxsnps, "maxsnps", defaultMaxSnps, maxsusage)
+	flag.IntVar(&maxsnps, "x", defaultMaxSnps, maxsusage+" (shorthand)")
+	flag.Float64Var(&maxdiscord, "maxdiscord", defaultMaxDiscord, dusage)
+	flag.Float64Var(&maxdiscord, "d", defaultMaxDiscord, dusage+" (shorthand)")
+	flag.Float64Var(&minconc, "minconc", defaultMinConc, cusage)
+	flag.Float64Var(&minconc, "o", defaultMinConc, cusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.IntVar(&batchSize, "batch", defaultBatchSize, busage)
+	flag.IntVar(&batchSize, "b", defaultBatchSize, busage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START sampledup mincr=%.3f, minmaf=%.3f, maxdiscord=%.3f, minconc=%.3f, threshold=%.2f\n",
+		mincr, minmaf, maxdiscord, minconc, threshold)
+
+	if minsnps < 1 {
+		log.Fatal("-minsnps must be at least 1")
+	}
+	if minsnps < genometrics.DupFullSNPs {
+		log.Printf("WARNING -minsnps %d: panels sharing fewer than %d SNPs have every pair of samples compared\n",
+			minsnps, genometrics.DupFullSNPs)
+	}
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+
+	rsidList := make([]string, 0, 1000)
+	if rsFilePath != "" {
+		f, err := os.Open(rsFilePath)
+		check(err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rsidList = append(rsidList, scanner.Text())
+		}
+	} else {
+		rsidList = godb.GetMultiAssayVarids(validAssaytypes)
+	}
+	log.Printf("candidate rsids: %d\n", len(rsidList))
+
+	_, samplePosnMap := godb.GetSamplesByAssaytype()
+	pg := genometrics.NewPanelGenotypes(threshold, mincr, minmaf)
+	for start := 0; start < len(rsidList); start += batchSize {
+		if maxsnps > 0 && len(pg.SNPs) >= maxsnps {
+			break
+		}
+		end := start + batchSize
+		if end > len(rsidList) {
+			end = len(rsidList)
+		}
+		rsids, _ := godb.GetRecordsByVarid(vcfPathPref, rsidList[start:end], validAssaytypes)
+		for _, rsid := range rsidList[start:end] {
+			if maxsnps > 0 && len(pg.SNPs) >= maxsnps {
+				break
+			}
+			if records, ok := rsids[rsid]; ok && len(records) > 1 {
+				pg.AddVariant(records, samplePosnMap)
+			}
+		}
+		log.Printf("read %d of %d, %d SNPs used\n", end, len(rsidList), len(pg.SNPs))
+	}
+
+	dups := pg.FindSampleDups(minsnps, maxdiscord, minconc)
+	genometrics.RankSampleDups(dups)
+	fmt.Printf("%s\n", genometrics.SampleDupHeader)
+	swaps := 0
+	for i, dup := range dups {
+		fmt.Printf("%s\n", dup.TSV(i+1))
+		if dup.Type == "swap" {
+			swaps++
+		}
+	}
+	log.Printf("END sampledup snps=%d, swaps=%d, duplicates=%d\n", len(pg.SNPs), swaps, len(dups)-swaps)
+}
@@ -0,0 +1,156 @@
+//------------------------------------------------------------------------------
+// Manage the sample exclusion list
+//
+// Excluded samples are dropped from the sample maps built by
+// godb.GetSamplesByAssaytype, so they are left out of all combined output
+// (Getallvardata, vcombine, the godbassoc results pages and downloads).
+//
+// Either:
+// 1) add a sample (-sampleid) or a file of samples (-exclfile, sample id and
+//    optional assaytype per line, as written by sampleqc -exclpath), with
+//    a reason and optional assaytype (default all assaytypes)
+// 2) remove a sample from the list (-remove)
+// 3) list the current exclusions (-list)
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"godb"
+	"log"
+	"os"
+	"sample"
+	"strings"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var sampleID string
+var exclFilePath string
+var assayType string
+var reason string
+var remove bool
+var list bool
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath  = "./data/sampleexcl_output.log"
+		lusage              = "Log file"
+		defaultSampleID     = ""
+		susage              = "Sample id to add (or remove)"
+		defaultExclFilePath = ""
+		xusage              = "File of sample ids to add (sample id [assaytype] per line)"
+		defaultAssayType    = ""
+		atusage             = "Assay type the exclusion applies to (default all)"
+		defaultReason       = "unspecified"
+		rusage              = "Reason for exclusion"
+		defaultRemove       = false
+		dusage              = "Remove the sample from the exclusion list"
+		defaultList         = false
+		listusage           = "List current exclusions"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&sampleID, "sampleid", defaultSampleID, susage)
+	flag.StringVar(&sampleID, "s", defaultSampleID, susage+" (shorthand)")
+	flag.StringVar(&exclFilePath, "exclfile", defaultExclFilePath, xusage)
+	flag.StringVar(&exclFilePath, "x", defaultExclFilePath, xusage+" (shorthand)")
+	flag.StringVar(&assayType, "assaytype", defaultAssayType, atusage)
+	flag.StringVar(&assayType, "a", defaultAssayType, atusage+" (shorthand)")
+	flag.StringVar(&reason, "reason", defaultReason, rusage)
+	flag.StringVar(&reason, "r", defaultReason, rusage+" (shorthand)")
+	flag.BoolVar(&remove, "remove", defaultRemove, dusage)
+	flag.BoolVar(&remove, "d", defaultRemove, dusage+" (shorthand)")
+	flag.BoolVar(&list, "list", defaultList, listusage)
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+
+	if list {
+		fmt.Printf("sample\tassaytype\treason\tdate\n")
+		for _, excl := range godb.GetSampleExclusions() {
+			at := excl.Assaytype
+			if at == "" {
+				at = "all"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", excl.SampleID, at, excl.Reason, excl.Date.Format("2006-01-02"))
+		}
+		return
+	}
+	if remove {
+		if sampleID == "" {
+			log.Fatal("-remove needs -sampleid")
+		}
+		count := godb.RemoveSampleExclusion(sampleID)
+		log.Printf("Removed %s from exclusion list (%d entries)\n", sampleID, count)
+		fmt.Printf("Removed %d exclusion entries for %s\n", count, sampleID)
+		return
+	}
+
+	// sample id to the assaytypes it is excluded from, a sample may be
+	// listed once per assaytype
+	excluded := make(map[string]map[string]bool)
+	if sampleID != "" {
+		sample.AddExclusion(excluded, sampleID, assayType)
+	}
+	if exclFilePath != "" {
+		f, err := os.Open(exclFilePath)
+		check(err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			if len(fields) > 1 {
+				sample.AddExclusion(excluded, fields[0], fields[1])
+			} else {
+				sample.AddExclusion(excluded, fields[0], assayType)
+			}
+		}
+		check(scanner.Err())
+	}
+	added, entries := 0, 0
+	for samp, ats := range excluded {
+		for at := range ats {
+			entries++
+			if godb.InsertSampleExclusion(samp, at, reason) {
+				added++
+			} else {
+				log.Printf("%s (%s) already excluded\n", samp, at)
+			}
+		}
+	}
+	log.Printf("Exclusion list: %d added, reason %s\n", added, reason)
+	fmt.Printf("Added %d of %d sample exclusions (%d samples) to the exclusion list\n", added, entries, len(excluded))
+}
@@ -0,0 +1,158 @@
+//--------------------------------------------------------------------------------------
+// Per-sample QC metrics across a set of combined VCF records
+// (output from vcombine, filemergevcf, or a godbassoc download)
+//
+// Outputs, per sample: call rate, heterozygosity rate, inbreeding coefficient F,
+// genotype counts by panel (AT) and outlier flags. Flagged samples can also be
+// written to an exclusion file, one sample id per line.
+//--------------------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"genometrics"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"variant"
+)
+
+//-----------------------------------------------
+// global vars, accessed by multiple funcs
+//-----------------------------------------------
+var logFilePath string
+var vcfPath string
+var exclPath string
+var threshold float64
+var mincr float64
+var hetsd float64
+var maxf float64
+
+//-----------------------------------------------
+// main package routines
+//-----------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/sampleqc_output.log"
+		lusage             = "Log file"
+		defaultvcfPath     = "./data/combined.vcf.gz"
+		vusage             = "Full path for combined vcf file (.gz or plain text)"
+		defaultexclPath    = ""
+		eusage             = "Output file for flagged sample ids"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold"
+		defaultMinCr       = 0.95
+		crusage            = "Minimum sample call rate"
+		defaultHetSd       = 3.0
+		hetusage           = "Heterozygosity rate outlier, standard deviations from the mean"
+		defaultMaxF        = 0.2
+		fusage             = "Maximum absolute inbreeding coefficient F (0 = not tested)"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&vcfPath, "vcfpath", defaultvcfPath, vusage)
+	flag.StringVar(&vcfPath, "v", defaultvcfPath, vusage+" (shorthand)")
+	flag.StringVar(&exclPath, "exclpath", defaultexclPath, eusage)
+	flag.StringVar(&exclPath, "e", defaultexclPath, eusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.Float64Var(&mincr, "mincr", defaultMinCr, crusage)
+	flag.Float64Var(&mincr, "c", defaultMinCr, crusage+" (shorthand)")
+	flag.Float64Var(&hetsd, "hetsd", defaultHetSd, hetusage)
+	flag.Float64Var(&hetsd, "s", defaultHetSd, hetusage+" (shorthand)")
+	flag.Float64Var(&maxf, "maxf", defaultMaxF, fusage)
+	flag.Float64Var(&maxf, "f", defaultMaxF, fusage+" (shorthand)")
+	flag.Parse()
+}
+
+func check(e error) {
+	if e != nil {
+		log.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START sampleqc %s, MINCR=%.3f,HETSD=%.2f,MAXF=%.3f,threshold=%.2f\n", vcfPath, mincr, hetsd, maxf, threshold)
+
+	reader := openVcf(vcfPath)
+	sampleNames := getSampleHeaders(reader)
+	sqc := genometrics.NewSampleQC(sampleNames, threshold)
+	rcount := 0
+	for {
+		text, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		text = strings.TrimRight(text, "\n")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sqc.AddRecord(strings.Split(text, "\t"))
+		rcount++
+	}
+	sqc.Finish()
+	flagged := sqc.FlagOutliers(mincr, hetsd, maxf)
+
+	fmt.Printf("%s\n", genometrics.SampleMetricsHeader)
+	for _, sm := range sqc.Samples {
+		fmt.Printf("%s\n", sm.TSV())
+	}
+	if exclPath != "" {
+		fe, err := os.Create(exclPath)
+		check(err)
+		defer fe.Close()
+		w := bufio.NewWriter(fe)
+		for _, sm := range sqc.Samples {
+			if len(sm.Flags) > 0 {
+				fmt.Fprintf(w, "%s\n", sm.SampleID)
+			}
+		}
+		check(w.Flush())
+	}
+	log.Printf("END sampleqc Rd=%d, samples=%d, flagged=%d\n", rcount, len(sampleNames), flagged)
+}
+
+//-------------------------------------------------------------
+// Open a VCF file, gzipped or not
+//-------------------------------------------------------------
+func openVcf(path string) *bufio.Reader {
+	f, err := os.Open(path)
+	check(err)
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		check(err)
+		return bufio.NewReader(gr)
+	}
+	return bufio.NewReader(f)
+}
+
+//-------------------------------------------------------------
+// Get headers with column(sample) names
+//-------------------------------------------------------------
+func getSampleHeaders(rdr *bufio.Reader) []string {
+	var sfx []string
+
+	for {
+		text, err := rdr.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		text = strings.TrimRight(text, "\n")
+		if strings.HasPrefix(text, "#CHROM") {
+			_, sfx = variant.GetVCFPrfxSfx(strings.Split(text, "\t"))
+			break
+		}
+	}
+	return sfx
+}
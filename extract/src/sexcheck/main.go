@@ -0,0 +1,194 @@
+//------------------------------------------------------------------------------
+// Genetic sex inference and check against recorded sex
+//
+// Steps:
+// 1) Walk the variants collection for X and Y chromosome rsids in the
+//    requested assaytypes
+// 2) In batches, get the VCF records for each rsid from all assaytypes and
+//    accumulate X heterozygosity (non-PAR, for the -build) and Y call rate by sample id,
+//    sample ids are subject ids after aliasing
+// 3) Infer sex from X het F and, where present, Y call rate
+// 4) Compare with the recorded sex phenotype (ehrdb), output a report with
+//    mismatches flagged and optionally store the inferred sex as sample
+//    metadata (-store)
+//------------------------------------------------------------------------------
+package main
+
+import (
+	"ehrdb"
+	"flag"
+	"fmt"
+	"genometrics"
+	"godb"
+	"log"
+	"os"
+	"strings"
+	"variant"
+)
+
+//------------------------------------------------
+// file-scope vars, accessed by multiple funcs
+//------------------------------------------------
+var logFilePath string
+var vcfPathPref string
+var threshold float64
+var assayTypes string
+var xChroms string
+var yChroms string
+var femaleMaxF float64
+var maleMinF float64
+var minYCallRate float64
+var phenoName string
+var store bool
+var mismatchOnly bool
+var batchSize int
+var genomeBuild string
+var validAssaytypes = map[string]bool{}
+
+//------------------------------------------------
+// main package routines
+//------------------------------------------------
+//------------------------------------------------
+// init() set up and parse cmd line flags
+//------------------------------------------------
+func init() {
+	const (
+		defaultLogFilePath = "./data/sexcheck_output.log"
+		lusage             = "Log file"
+		defaultvcfPathPref = ""
+		vusage             = "default path prefix for vcf files"
+		defaultThreshold   = 0.9
+		thrusage           = "Prob threshold"
+		defaultAssayTypes  = "affy,illumina,broad,metabo,exome"
+		atusage            = "Assay types"
+		defaultXChroms     = "X,23"
+		xusage             = "X chromosome names"
+		defaultYChroms     = "Y,24"
+		yusage             = "Y chromosome names"
+		defaultFemaleMaxF  = 0.2
+		fusage             = "X het F at or below which a sample is female"
+		defaultMaleMinF    = 0.8
+		musage             = "X het F at or above which a sample is male"
+		defaultMinYCr      = 0.5
+		ycrusage           = "Y call rate at or above which a sample is male"
+		defaultPhenoName   = "sex"
+		phusage            = "Recorded sex phenotype name (values 1/2, M/F or male/female)"
+		defaultStore       = false
+		susage             = "Store the inferred sex as sample metadata"
+		defaultMismatch    = false
+		mmusage            = "Only output mismatches"
+		defaultBatchSize   = 1000
+		busage             = "Number of rsids read per batch"
+		defaultGenomeBuild = "GRCh37"
+		gusage             = "Genome build of the genotype data, for the X PAR regions (GRCh37 or GRCh38)"
+	)
+	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
+	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
+	flag.StringVar(&vcfPathPref, "vcfprfx", defaultvcfPathPref, vusage)
+	flag.StringVar(&vcfPathPref, "v", defaultvcfPathPref, vusage+" (shorthand)")
+	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
+	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.StringVar(&assayTypes, "assaytypes", defaultAssayTypes, atusage)
+	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
+	flag.StringVar(&xChroms, "xchrom", defaultXChroms, xusage)
+	flag.StringVar(&xChroms, "x", defaultXChroms, xusage+" (shorthand)")
+	flag.StringVar(&yChroms, "ychrom", defaultYChroms, yusage)
+	flag.StringVar(&yChroms, "y", defaultYChroms, yusage+" (shorthand)")
+	flag.Float64Var(&femaleMaxF, "femalef", defaultFemaleMaxF, fusage)
+	flag.Float64Var(&femaleMaxF, "f", defaultFemaleMaxF, fusage+" (shorthand)")
+	flag.Float64Var(&maleMinF, "malef", defaultMaleMinF, musage)
+	flag.Float64Var(&maleMinF, "m", defaultMaleMinF, musage+" (shorthand)")
+	flag.Float64Var(&minYCallRate, "ycr", defaultMinYCr, ycrusage)
+	flag.Float64Var(&minYCallRate, "c", defaultMinYCr, ycrusage+" (shorthand)")
+	flag.StringVar(&phenoName, "pheno", defaultPhenoName, phusage)
+	flag.StringVar(&phenoName, "p", defaultPhenoName, phusage+" (shorthand)")
+	flag.BoolVar(&store, "store", defaultStore, susage)
+	flag.BoolVar(&store, "s", defaultStore, susage+" (shorthand)")
+	flag.BoolVar(&mismatchOnly, "mismatches", defaultMismatch, mmusage)
+	flag.BoolVar(&mismatchOnly, "o", defaultMismatch, mmusage+" (shorthand)")
+	flag.IntVar(&batchSize, "batch", defaultBatchSize, busage)
+	flag.IntVar(&batchSize, "b", defaultBatchSize, busage+" (shorthand)")
+	flag.StringVar(&genomeBuild, "build", defaultGenomeBuild, gusage)
+	flag.StringVar(&genomeBuild, "g", defaultGenomeBuild, gusage+" (shorthand)")
+	flag.Parse()
+}
+
+//------------------------------------------------
+// check(error) crude general error handler
+//------------------------------------------------
+func check(e error) {
+	if e != nil {
+		fmt.Println("err != nil")
+		log.Fatal(e)
+	}
+}
+
+//------------------------------------------------
+// main() program entry point
+//------------------------------------------------
+func main() {
+	lf, err := os.OpenFile(logFilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0640)
+	check(err)
+	defer lf.Close()
+
+	log.SetOutput(lf)
+	log.Printf("START sexcheck femalef=%.2f, malef=%.2f, ycr=%.2f, threshold=%.2f, build=%s\n",
+		femaleMaxF, maleMinF, minYCallRate, threshold, genomeBuild)
+
+	atList := strings.Split(assayTypes, ",")
+	for at := range atList {
+		validAssaytypes[atList[at]] = true
+	}
+	isX := make(map[string]bool)
+	for _, chrom := range strings.Split(xChroms, ",") {
+		isX[chrom] = true
+	}
+	chromList := append(strings.Split(xChroms, ","), strings.Split(yChroms, ",")...)
+
+	rsidList := godb.GetChromVarids(chromList, validAssaytypes)
+	log.Printf("X and Y rsids: %d\n", len(rsidList))
+
+	_, samplePosnMap := godb.GetSamplesByAssaytype()
+	parRegions, err := genometrics.PARRegions(genomeBuild)
+	check(err)
+	sc := genometrics.NewSexChecker(threshold, parRegions)
+	for start := 0; start < len(rsidList); start += batchSize {
+		end := start + batchSize
+		if end > len(rsidList) {
+			end = len(rsidList)
+		}
+		rsids, _ := godb.GetRecordsByVarid(vcfPathPref, rsidList[start:end], validAssaytypes)
+		for _, rsid := range rsidList[start:end] {
+			for _, rec := range rsids[rsid] {
+				if isX[variant.GetChrom(rec[1:])] {
+					sc.AddXRecord(rec[1:], samplePosnMap[rec[0]])
+				} else {
+					sc.AddYRecord(rec[1:], samplePosnMap[rec[0]])
+				}
+			}
+		}
+		log.Printf("read %d of %d\n", end, len(rsidList))
+	}
+	sc.Infer(femaleMaxF, maleMinF, minYCallRate)
+
+	recorded, count := ehrdb.GetPhenoByName(phenoName)
+	if count == 0 {
+		log.Printf("No recorded sex, phenotype %s not found\n", phenoName)
+	}
+	mismatches := sc.Compare(recorded)
+
+	fmt.Printf("%s\n", genometrics.SexCheckHeader)
+	for _, id := range sc.SampleIDs() {
+		chk := sc.Samples[id]
+		if !mismatchOnly || chk.Status == "mismatch" {
+			fmt.Printf("%s\n", chk.TSV())
+		}
+		if store {
+			godb.SetSampleSex(id, chk.Inferred, chk.F, chk.YCallRate)
+		}
+	}
+	if store {
+		log.Printf("Stored inferred sex for %d samples\n", len(sc.Samples))
+	}
+	log.Printf("END sexcheck xsnps=%d, ysnps=%d, samples=%d, mismatches=%d\n", sc.XCount, sc.YCount, len(sc.Samples), mismatches)
+}
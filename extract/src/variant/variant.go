@@ -6,6 +6,7 @@ package variant
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -101,6 +102,39 @@ func GetGenoAsIntStr(geno string, threshold float64, probidx int) string {
 	return genoStringInts[maxProbIdx]
 }
 
+// GetHardCall ...
+// alt allele count (0, 1, 2) for a genotype, based on imputation probability
+// threshold where GP is present, otherwise on GT. False if missing
+//------------------------------------------------------------------------------
+func GetHardCall(geno string, threshold float64, probidx int) (float64, bool) {
+	if geno == "." {
+		return 0.0, false
+	}
+	if probidx >= 0 && probidx < len(strings.Split(geno, ":")) {
+		mprob, maxProbIdx, _ := MaxProb(geno, probidx)
+		if mprob < threshold || maxProbIdx < 0 {
+			return 0.0, false
+		}
+		return float64(maxProbIdx), true
+	}
+	gp, ok := GenoProbs(geno, -9, -9)
+	if !ok {
+		return 0.0, false
+	}
+	return gp[1] + 2.0*gp[2], true
+}
+
+// GetDosage ...
+// expected alt allele count for a genotype, from GP, DS or GT. False if missing
+//------------------------------------------------------------------------------
+func GetDosage(geno string, probidx int, dsidx int) (float64, bool) {
+	gp, ok := GenoProbs(geno, probidx, dsidx)
+	if !ok {
+		return 0.0, false
+	}
+	return gp[1] + 2.0*gp[2], true
+}
+
 // MaxProb ...
 // test for which slot contains the max probability for a genotype
 //------------------------------------------------------------------------------
@@ -147,11 +181,75 @@ func GetPosnStr(recslice []string) string {
 	return recslice[posnIdx]
 }
 
+// SortRecordsByPosition ...
+// sort tab delimited VCF records (no header) into chromosome then position
+// order, numbered chromosomes (with or without "chr") in numeric order
+// before the others (X, Y, MT ...) in string order
+//------------------------------------------------------------------------------
+func SortRecordsByPosition(records []string) {
+	type recPosn struct {
+		chromNum int
+		chrom    string
+		posn     int
+		record   string
+	}
+	posns := make([]recPosn, len(records))
+	for i, record := range records {
+		fields := strings.SplitN(record, "\t", posnIdx+2)
+		chrom := strings.TrimPrefix(GetChrom(fields), "chr")
+		chromNum, err := strconv.Atoi(chrom)
+		if err != nil {
+			chromNum = 1 << 30
+		}
+		posns[i] = recPosn{chromNum, chrom, GetPosn(fields), record}
+	}
+	sort.SliceStable(posns, func(a, b int) bool {
+		if posns[a].chromNum != posns[b].chromNum {
+			return posns[a].chromNum < posns[b].chromNum
+		}
+		if posns[a].chrom != posns[b].chrom {
+			return posns[a].chrom < posns[b].chrom
+		}
+		return posns[a].posn < posns[b].posn
+	})
+	for i := range posns {
+		records[i] = posns[i].record
+	}
+}
+
 // GetAlleles ...
 func GetAlleles(recslice []string) (string, string) {
 	return recslice[refIdx], recslice[altIdx]
 }
 
+// Complement ...
+// complement strand allele(s), upper case, "" if not a simple base allele
+func Complement(allele string) string {
+	comp := make([]byte, len(allele))
+	for i, base := range strings.ToUpper(allele) {
+		switch base {
+		case 'A':
+			comp[i] = 'T'
+		case 'T':
+			comp[i] = 'A'
+		case 'C':
+			comp[i] = 'G'
+		case 'G':
+			comp[i] = 'C'
+		default:
+			return ""
+		}
+	}
+	return string(comp)
+}
+
+// IsPalindromic ...
+// A/T and C/G SNPs read the same on both strands, so strand cannot be
+// told from the alleles
+func IsPalindromic(a string, b string) bool {
+	return len(a) == 1 && Complement(a) != "" && Complement(a) == strings.ToUpper(b)
+}
+
 // GetA ...
 func GetA(recslice []string) string {
 	return recslice[refIdx]
@@ -167,6 +265,65 @@ func GetProbIdx(recslice []string) int {
 	return getStrIdx(recslice[fmtIdx], "GP")
 }
 
+// GetDosageIdx ...
+func GetDosageIdx(recslice []string) int {
+	return getStrIdx(recslice[fmtIdx], "DS")
+}
+
+// GenoProbs ...
+// genotype probabilities P(0/0), P(0/1), P(1/1) for a single genotype,
+// taken from GP if present, otherwise derived from DS, otherwise from the
+// hard call. Returns false for missing / no-assay genotypes
+//------------------------------------------------------------------------------
+func GenoProbs(geno string, probidx int, dsidx int) ([]float64, bool) {
+	if geno == "." {
+		return nil, false
+	}
+	g := strings.Split(geno, ":")
+	if probidx >= 0 && probidx < len(g) {
+		probs := strings.Split(g[probidx], ",")
+		if len(probs) == 3 {
+			gp := make([]float64, 3)
+			sum := 0.0
+			for i, prob := range probs {
+				gp[i], _ = strconv.ParseFloat(prob, 64)
+				sum += gp[i]
+			}
+			if sum > 0.0 {
+				for i := range gp {
+					gp[i] /= sum
+				}
+				return gp, true
+			}
+		}
+	}
+	if dsidx >= 0 && dsidx < len(g) {
+		ds, err := strconv.ParseFloat(g[dsidx], 64)
+		if err == nil {
+			// the least-variance probabilities consistent with the dosage
+			if ds <= 1.0 {
+				return []float64{1.0 - ds, ds, 0.0}, true
+			}
+			return []float64{0.0, 2.0 - ds, ds - 1.0}, true
+		}
+	}
+	switch strings.Replace(g[0], "|", genoDelim, 1) {
+	case "0/0":
+		return []float64{1.0, 0.0, 0.0}, true
+	case "0/1", "1/0":
+		return []float64{0.0, 1.0, 0.0}, true
+	case "1/1":
+		return []float64{0.0, 0.0, 1.0}, true
+	}
+	return nil, false
+}
+
+// GetFmtIdx ...
+// slot of a FORMAT field, -9 if not present
+func GetFmtIdx(recslice []string, fmt string) int {
+	return getStrIdx(recslice[fmtIdx], fmt)
+}
+
 // HasFmt ...
 func HasFmt(recslice []string, fmt string) bool {
 	if getStrIdx(recslice[fmtIdx], fmt) == -9 {
@@ -195,6 +352,14 @@ func GetInfoScore(recslice []string) float64 {
 	return 1.0
 }
 
+// GetInfoValue ...
+// value for a key in the INFO field, false if not present
+func GetInfoValue(recslice []string, key string) (string, bool) {
+	infomap := parseInfoStr(GetInfo(recslice))
+	value, ok := infomap[key]
+	return value, ok
+}
+
 // GetInfo ...
 func GetInfo(recslice []string) string {
 	return recslice[infoIdx]
@@ -29,6 +29,7 @@ var emptyRecord = []string{}
 //-----------------------------------------------
 var logFilePath string
 var vcfPath string
+var metricsFilePath string
 var threshold float64
 
 //-----------------------------------------------
@@ -42,6 +43,8 @@ func init() {
 		vusage             = "Full path for vcf files"
 		defaultThreshold   = 0.9
 		thrusage           = "Prob threshold"
+		defaultMetricsPath = ""
+		musage             = "Metrics report file (.json for JSON, otherwise TSV)"
 	)
 	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
 	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
@@ -49,6 +52,8 @@ func init() {
 	flag.StringVar(&vcfPath, "v", defaultvcfPath, vusage+" (shorthand)")
 	flag.Float64Var(&threshold, "threshold", defaultThreshold, thrusage)
 	flag.Float64Var(&threshold, "t", defaultThreshold, thrusage+" (shorthand)")
+	flag.StringVar(&metricsFilePath, "metricsfile", defaultMetricsPath, musage)
+	flag.StringVar(&metricsFilePath, "m", defaultMetricsPath, musage+" (shorthand)")
 	flag.Parse()
 }
 
@@ -82,6 +87,7 @@ func main() {
 	reader := bufio.NewReader(gr)
 	fmt.Printf("chr,posn,varid,CR,MAF,HWEP,INFO,N,MISS\n")
 	skipHeaders(reader)
+	report := genometrics.NewMetricsReport()
 	for {
 		rcount++
 		_, data, _, _, err := getNextRecord(reader)
@@ -91,10 +97,14 @@ func main() {
 		chrom := variant.GetChrom(data)
 		posn := variant.GetPosnStr(data)
 		varid := variant.GetVarid(data)
-		recCr, _, _, recMaf, recHwe, _, _, _, n, miss, _, _ := genometrics.MetricsForRecord(data, threshold)
+		vm := genometrics.MetricsForRecord(data, threshold)
 		recInfo := variant.GetInfoScore(data)
 		wcount++
-		fmt.Printf("%s,%s,%s,%.2f,%.6f,%.8f,%.6f,%d,%d\n", chrom, posn, varid, recCr, recMaf, recHwe, recInfo, n, miss)
+		fmt.Printf("%s,%s,%s,%.2f,%.6f,%.8f,%.6f,%d,%d\n", chrom, posn, varid, vm.CallRate, vm.MAF, vm.HWEP, recInfo, vm.N, vm.Missing)
+		report.Add(vm, nil)
+	}
+	if metricsFilePath != "" {
+		check(report.WriteFile(metricsFilePath))
 	}
 	log.Printf("END filter Rd=%d, Wrt=%d\n", rcount, wcount)
 }
@@ -35,6 +35,7 @@ var maffactor float64
 var hwe float64
 var cr float64
 var infoscore float64
+var infomode string
 
 //-----------------------------------------------
 // main package routines
@@ -59,6 +60,8 @@ func init() {
 		crusage            = "Call Rate"
 		defaultInfo        = 0.9
 		infousage          = "Imputation INFO score"
+		defaultInfoMode    = "tag"
+		imodeusage         = "INFO score source: tag (INFO=), machrsq, info or dr2 (from GP/DS)"
 	)
 	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
 	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
@@ -78,6 +81,8 @@ func init() {
 	flag.Float64Var(&cr, "c", defaultCr, crusage+" (shorthand)")
 	flag.Float64Var(&infoscore, "info", defaultInfo, infousage)
 	flag.Float64Var(&infoscore, "i", defaultInfo, infousage+" (shorthand)")
+	flag.StringVar(&infomode, "infomode", defaultInfoMode, imodeusage)
+	flag.StringVar(&infomode, "q", defaultInfoMode, imodeusage+" (shorthand)")
 	flag.Parse()
 }
 
@@ -102,7 +107,10 @@ func main() {
 
 	log.SetOutput(lf)
 	//log.Printf("START filter MAF=%f,CR=%.2f,HWE=%f,INFO=%.2f,threshold=%.2f,maffactor=%.2f\n", maf, cr, hwe, infoscore, threshold, maffactor)
-	log.Printf("START filter MAF=%f,CR=%.2f,HWE=%f,INFO=%.2f,threshold=%.2f\n", maf, cr, hwe, infoscore, threshold)
+	log.Printf("START filter MAF=%f,CR=%.2f,HWE=%f,INFO=%.2f (%s),threshold=%.2f\n", maf, cr, hwe, infoscore, infomode, threshold)
+	if _, ok := genometrics.GetImputeMeasure(genometrics.ImputeQuality{}, infomode); !ok && infomode != "tag" {
+		log.Fatalf("Unknown infomode %s\n", infomode)
+	}
 	rcount := 0
 	wcount := 0
 	pcount := 0
@@ -148,29 +156,32 @@ func main() {
 			foundError = true
 			//continue
 		}
-		recCr, _, _, recMaf, recHwe, _, _, _, _, _, _, _ := genometrics.MetricsForRecord(data, threshold)
-		//log.Printf("VARID=%s\tCR=%f\tMAF=%f\tHWE=%f\tn=%d\n", varid, recCr, recMaf, recHwe)
+		vm := genometrics.MetricsForRecord(data, threshold)
+		//log.Printf("VARID=%s\tCR=%f\tMAF=%f\tHWE=%f\tn=%d\n", varid, vm.CallRate, vm.MAF, vm.HWEP, vm.N)
 
-		if recMaf < maf {
+		if vm.MAF < maf {
 			mcount++
 			foundError = true
 		}
-		if recHwe < hwe {
+		if vm.HWEP < hwe {
 			hcount++
 			foundError = true
 		}
-		if recCr < cr {
+		if vm.CallRate < cr {
 			crcount++
 			foundError = true
 		}
 		recInfo := variant.GetInfoScore(data)
+		if infomode != "tag" {
+			recInfo, _ = genometrics.GetImputeMeasure(genometrics.ImputeQualityForRecord(data), infomode)
+		}
 		if recInfo < infoscore {
 			icount++
 			foundError = true
 		}
 		if maffactor != 0.0 {
 			recRpaf := variant.GetRefPanelAF(data)
-			if (recMaf < (recRpaf / maffactor)) || (recMaf > (recRpaf * maffactor)) {
+			if (vm.MAF < (recRpaf / maffactor)) || (vm.MAF > (recRpaf * maffactor)) {
 				mfcount++
 				foundError = true
 			}
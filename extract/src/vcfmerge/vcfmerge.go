@@ -146,8 +146,14 @@ func Combine(vcfset [][]string, vcfdataset []Vcfdata, rsid string,
 					elem = appendAssayAbbrev(elem, atype)
 				}
 				// this is the crux: map from sample_name at slot j in the assay type record to the position
-				// aligned with the combination record
-				currentRecord[comboPosns[sampleNamesByPosn[atype][j]]] = elem
+				// aligned with the combination record, samples not mapped (excluded) are dropped
+				name, ok := sampleNamesByPosn[atype][j]
+				if !ok {
+					continue
+				}
+				if posn, ok := comboPosns[name]; ok {
+					currentRecord[posn] = elem
+				}
 			}
 			assayrecs = append(assayrecs, currentRecord)
 		} else {
@@ -173,7 +179,13 @@ func Combine(vcfset [][]string, vcfdataset []Vcfdata, rsid string,
 			} else {
 				(*gmetrics).GtTwoOverlapCount++
 			}
+			if (*gmetrics).Tally != nil && i < len(comboNames) {
+				tallyConcordance((*gmetrics).Tally, comboNames[i], genoList, aList)
+			}
 			comborec[i] = getBestGeno(genoList, aList, atypeMap, probidx, rsid, gmetrics)
+			if (*gmetrics).Audit != nil && i < len(comboNames) && (*gmetrics).Audit.Wants(rsid) {
+				auditConflict((*gmetrics).Audit, prfx, comboNames[i], genoList, aList, atypeMap, probidx, comborec[i])
+			}
 		} else {
 			if len(genoList) == 1 {
 				comborec[i] = genoList[0]
@@ -194,6 +206,85 @@ func Combine(vcfset [][]string, vcfdataset []Vcfdata, rsid string,
 	recs <- recStr
 }
 
+//------------------------------------------------------------------------------
+// Add each pair of called genotypes for one sample to the concordance tally
+//------------------------------------------------------------------------------
+func tallyConcordance(tally *genometrics.ConcordanceTally, sampleName string, genoList []string, assayList []string) {
+	for j := 0; j < len(genoList); j++ {
+		if isMissing(genoList[j]) {
+			continue
+		}
+		for k := j + 1; k < len(genoList); k++ {
+			if isMissing(genoList[k]) || assayList[j] == assayList[k] {
+				continue
+			}
+			tally.Add(sampleName, assayList[j], assayList[k], areEqual(genoList[j], genoList[k]))
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+// Add a provenance audit entry where the called genotypes for one sample
+// conflict: candidates, the genotype chosen by getBestGeno and why
+//------------------------------------------------------------------------------
+func auditConflict(audit *genometrics.ProvenanceAudit, prfx []string, sampleName string, genoList []string,
+	assayList []string, assayTypeMap map[string][]string, probidx int, chosen string) {
+	called := make(map[string]bool, len(genoList))
+	for _, geno := range genoList {
+		if !isMissing(geno) {
+			called[strings.Split(geno, ":")[0]] = true
+		}
+	}
+	if len(called) < 2 {
+		return
+	}
+	entry := genometrics.ProvenanceEntry{Varid: variant.GetVarid(prfx), Chrom: variant.GetChrom(prfx),
+		Posn: variant.GetPosnStr(prfx), SampleID: sampleName, Candidates: make([]genometrics.Candidate, 0, len(genoList))}
+	chosenIdx := -1
+	for j, geno := range genoList {
+		if geno == "." {
+			continue
+		}
+		genodata := strings.Split(geno, ":")
+		cand := genometrics.Candidate{Assaytype: assayList[j], GT: genodata[0], GP: "."}
+		if probidx >= 0 && probidx < len(genodata) {
+			cand.GP = genodata[probidx]
+			cand.MaxProb, _, _ = variant.MaxProb(geno, probidx)
+		}
+		cand.InfoScore = variant.GetInfoScore(assayTypeMap[assayList[j]])
+		entry.Candidates = append(entry.Candidates, cand)
+		if chosenIdx < 0 && geno == chosen {
+			chosenIdx = len(entry.Candidates) - 1
+		}
+	}
+	entry.Chosen = strings.Split(chosen, ":")[0]
+	entry.Decision = genometrics.DecisionMaxProb
+	if chosenIdx >= 0 {
+		best := entry.Candidates[chosenIdx]
+		entry.ChosenAssaytype = best.Assaytype
+		for _, cand := range entry.Candidates {
+			if cand.GT != best.GT && cand.MaxProb == best.MaxProb {
+				entry.Decision = genometrics.DecisionFirst
+				if best.InfoScore > cand.InfoScore {
+					entry.Decision = genometrics.DecisionInfoScore
+				}
+			}
+		}
+	}
+	if isMissing(entry.Chosen) {
+		entry.Decision = genometrics.DecisionMissing
+	}
+	audit.Add(entry)
+}
+
+//------------------------------------------------------------------------------
+// No call, either no genotype or below the probability threshold
+//------------------------------------------------------------------------------
+func isMissing(geno string) bool {
+	gt := strings.Split(geno, ":")[0]
+	return gt == "." || gt == "./." || gt == ".|."
+}
+
 //------------------------------------------------------------------------------
 // Equality test for genotypes
 //------------------------------------------------------------------------------
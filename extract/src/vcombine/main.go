@@ -37,6 +37,10 @@ import (
 // file-scope vars, accessed by multiple funcs
 //------------------------------------------------
 var logFilePath string
+var metricsFilePath string
+var concordFilePath string
+var auditFilePath string
+var auditVarids string
 var rsFilePath string
 var rsID string
 var vcfPathPref string
@@ -69,6 +73,14 @@ func init() {
 		atusage            = "Assay types"
 		defaultLogLevel    = 0
 		loglusage          = "0=Minimal 1=Sum 2=max"
+		defaultMetricsPath = ""
+		musage             = "Metrics report file (.json for JSON, otherwise TSV)"
+		defaultConcordPath = ""
+		cusage             = "Per-sample, per-assay-pair concordance matrix file (TSV)"
+		defaultAuditPath   = ""
+		uusage             = "Genotype provenance audit file, conflicting overlap calls (TSV)"
+		defaultAuditVarids = ""
+		kusage             = "Varids to audit, comma separated (default: all)"
 	)
 	flag.StringVar(&logFilePath, "logfile", defaultLogFilePath, lusage)
 	flag.StringVar(&logFilePath, "l", defaultLogFilePath, lusage+" (shorthand)")
@@ -84,6 +96,14 @@ func init() {
 	flag.StringVar(&assayTypes, "a", defaultAssayTypes, atusage+" (shorthand)")
 	flag.IntVar(&logLevel, "logopt", defaultLogLevel, loglusage)
 	flag.IntVar(&logLevel, "o", defaultLogLevel, loglusage+" (shorthand)")
+	flag.StringVar(&metricsFilePath, "metricsfile", defaultMetricsPath, musage)
+	flag.StringVar(&metricsFilePath, "m", defaultMetricsPath, musage+" (shorthand)")
+	flag.StringVar(&concordFilePath, "concordfile", defaultConcordPath, cusage)
+	flag.StringVar(&concordFilePath, "c", defaultConcordPath, cusage+" (shorthand)")
+	flag.StringVar(&auditFilePath, "auditfile", defaultAuditPath, uusage)
+	flag.StringVar(&auditFilePath, "u", defaultAuditPath, uusage+" (shorthand)")
+	flag.StringVar(&auditVarids, "auditvarids", defaultAuditVarids, kusage)
+	flag.StringVar(&auditVarids, "k", defaultAuditVarids, kusage+" (shorthand)")
 	flag.Parse()
 }
 
@@ -193,29 +213,60 @@ func main() {
 	// get all sample data from godb and organise into maps of maps:
 	// assaytype -> sample name -> sample posn (sample_name_map)
 	// assaytype -> sample posn -> sample name (sample_posn_map)
-	sampleNameMap, samplePosnMap := godb.GetSamplesByAssaytype()
+	sampleNameMap, samplePosnMap, exclCount := godb.GetSamplesForAssaytypes(validAssaytypes)
 	// Condense all sample_names into a combined map samplename -> record position
 	combocols := sample.GetCombinedSampleMapByAssaytypes(sampleNameMap, assaytypeList)
 	// Get column headers as a single tab delimited string, with prefix in place, and as a list, both in postion order
 	colhdrStr, comboNames := vcfmerge.GetCombinedColumnHeaders(combocols)
 	//fmt.Printf("%s\n", "combined"+"\t"+colhdr_str)
+	fmt.Printf("%s\n", godb.ExclusionProvenance(exclCount))
 	fmt.Printf("%s\n", colhdrStr)
 
 	var genomet genometrics.AllMetrics
+	var report *genometrics.MetricsReport
+	if metricsFilePath != "" {
+		report = genometrics.NewMetricsReport()
+	}
+	if concordFilePath != "" {
+		genomet.Tally = genometrics.NewConcordanceTally()
+	}
+	if auditFilePath != "" {
+		var varids []string
+		if auditVarids != "" {
+			varids = strings.Split(auditVarids, ",")
+		}
+		genomet.Audit = genometrics.NewProvenanceAudit(varids)
+	}
 
 	// output the vcf records in input order, can also log the 'NOT FOUND's at this point
 	var snpcount int
 	for _, rsid := range rsidList {
 		if records, ok := rsids[rsid]; ok {
 			var rsidGenomet genometrics.AllMetrics
+			rsidGenomet.Collectors = genomet.Collectors
 			recStr := vcfmerge.CombineOne(records, rsidsData[rsid], rsid, samplePosnMap, combocols, comboNames, threshold, &rsidGenomet)
 			fmt.Printf("%s\n", recStr)
 			snpcount++
 			genometrics.Increment(&genomet, &rsidGenomet)
 			genometrics.LogMetrics(logLevel, rsid, 1, "##VARIANT", &rsidGenomet)
+			if report != nil {
+				vm := genometrics.MetricsForRecord(strings.Split(recStr, "\t"), threshold)
+				vm.Assaytype = "combined"
+				report.Add(vm, &rsidGenomet)
+			}
 		}
 	}
 	genometrics.LogMetrics(3, "all", snpcount, "##TOTAL", &genomet)
+	if report != nil {
+		check(report.WriteFile(metricsFilePath))
+	}
+	if genomet.Tally != nil {
+		check(genomet.Tally.WriteFile(concordFilePath))
+	}
+	if genomet.Audit != nil {
+		check(genomet.Audit.WriteFile(auditFilePath))
+		log.Printf("Provenance audit: %d conflicting calls\n", len(genomet.Audit.Entries))
+	}
 }
 
 //------------------------------------------------------------------------------
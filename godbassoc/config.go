@@ -11,24 +11,27 @@ import (
 // Configuration ...
 // For use throughout the app
 type Configuration struct {
-	Address         string `json:"addr"`
-	ReadTimeout     int64  `json:"readto"`
-	WriteTimeout    int64  `json:"writeto"`
-	Static          string `json:"static"`
-	Templates       string `json:"templates"`
-	VcfPrfx         string `json:"vcfprfx"`
-	Assaytypes      string `json:"assaytypes"`
-	Pthr            string `json:"probthr"`
-	AssocCmd        string `json:"assoccmd"`
-	AssocBinaryCmd  string `json:"assoccmdbin"`
-	OutfilePath     string `json:"outfilepath"`
-	PhenofilePath   string `json:"phenofilepath"`
-	PhenoColumns    string `json:"phenocolumns"`
-	GrsfilePath     string `json:"grsfilepath"`
-	GrsColumns      string `json:"grscolumns"`
-	VarlistfilePath string `json:"varlistfilepath"`
-	VarlistColumns  string `json:"varlistcolumns"`
-	Uploads         string `json:"uploads"`
+	Address           string `json:"addr"`
+	ReadTimeout       int64  `json:"readto"`
+	WriteTimeout      int64  `json:"writeto"`
+	Static            string `json:"static"`
+	Templates         string `json:"templates"`
+	VcfPrfx           string `json:"vcfprfx"`
+	Assaytypes        string `json:"assaytypes"`
+	Pthr              string `json:"probthr"`
+	AssocCmd          string `json:"assoccmd"`
+	AssocBinaryCmd    string `json:"assoccmdbin"`
+	OutfilePath       string `json:"outfilepath"`
+	PhenofilePath     string `json:"phenofilepath"`
+	PhenoColumns      string `json:"phenocolumns"`
+	GrsfilePath       string `json:"grsfilepath"`
+	GrsColumns        string `json:"grscolumns"`
+	GenomeBuild       string `json:"genomebuild"`
+	VarlistfilePath   string `json:"varlistfilepath"`
+	VarlistColumns    string `json:"varlistcolumns"`
+	SamplesetfilePath string `json:"samplesetfilepath"`
+	SamplesetColumns  string `json:"samplesetcolumns"`
+	Uploads           string `json:"uploads"`
 }
 
 var config Configuration
@@ -37,6 +40,7 @@ var requestedAssaytypes = map[string]bool{}
 var validPhenoColumns = map[string]bool{}
 var validVarlistColumns = map[string]bool{}
 var validGrsColumns = map[string]bool{}
+var validSamplesetColumns = map[string]bool{}
 
 func init() {
 	loadConfig()
@@ -80,6 +84,11 @@ func loadConfig() {
 		validGrsColumns[colList[colname]] = true
 	}
 	log.Printf("Valid grs input cols: %v\n", validGrsColumns)
+	colList = strings.Split(config.SamplesetColumns, ",")
+	for colname := range colList {
+		validSamplesetColumns[colList[colname]] = true
+	}
+	log.Printf("Valid sampleset input cols: %v\n", validSamplesetColumns)
 }
 
 func getAssaytypes() map[string]bool {
@@ -98,6 +107,10 @@ func getGrsColMap() map[string]bool {
 	return validGrsColumns
 }
 
+func getSamplesetColMap() map[string]bool {
+	return validSamplesetColumns
+}
+
 func getThresholdAsFloat() float64 {
 	threshold, err := strconv.ParseFloat(config.Pthr, 64)
 	if err != nil {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+)
+
+// svg histogram layout
+const (
+	histWidth  = 600
+	histHeight = 300
+	histMargin = 40
+)
+
+// svgHistogram ...
+// server rendered histogram of values, bins equal width bins between the
+// min and max, with the count and range of each bin as a tooltip
+func svgHistogram(values []float64, bins int, xlabel string) template.HTML {
+	if len(values) == 0 || bins < 1 {
+		return template.HTML("")
+	}
+	min, max := values[0], values[0]
+	for _, val := range values {
+		min = math.Min(min, val)
+		max = math.Max(max, val)
+	}
+	width := (max - min) / float64(bins)
+	if width == 0.0 {
+		bins = 1
+		width = 1.0
+	}
+	counts := make([]int, bins)
+	maxCount := 0
+	for _, val := range values {
+		bin := int((val - min) / width)
+		if bin >= bins {
+			bin = bins - 1
+		}
+		counts[bin]++
+		if counts[bin] > maxCount {
+			maxCount = counts[bin]
+		}
+	}
+
+	plotWidth := float64(histWidth - 2*histMargin)
+	plotHeight := float64(histHeight - 2*histMargin)
+	barWidth := plotWidth / float64(bins)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		histWidth, histHeight, histWidth, histHeight)
+	for i, count := range counts {
+		barHeight := plotHeight * float64(count) / float64(maxCount)
+		x := float64(histMargin) + float64(i)*barWidth
+		y := float64(histMargin) + plotHeight - barHeight
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#007bff" stroke="#ffffff">`,
+			x, y, barWidth, barHeight)
+		fmt.Fprintf(&sb, `<title>%.4f to %.4f: %d</title></rect>`, min+float64(i)*width, min+float64(i+1)*width, count)
+	}
+	// axes and labels
+	x0, y0 := histMargin, histHeight-histMargin
+	fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#000000"/>`, x0, y0, histWidth-histMargin, y0)
+	fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#000000"/>`, x0, y0, x0, histMargin)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="11" text-anchor="start">%.4f</text>`, x0, y0+14, min)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="11" text-anchor="end">%.4f</text>`, histWidth-histMargin, y0+14, max)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="12" text-anchor="middle">%s</text>`, histWidth/2, histHeight-8,
+		template.HTMLEscapeString(xlabel))
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="11" text-anchor="end">%d</text>`, x0-4, histMargin+4, maxCount)
+	fmt.Fprintf(&sb, `<text x="%d" y="%d" font-size="11" text-anchor="end">0</text>`, x0-4, y0)
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
@@ -47,13 +47,27 @@ func main() {
 	mux.HandleFunc("/phenoupload", phenoUpload)
 	mux.HandleFunc("/phenoprocess", phenoFileProcess)
 
+	// defined in route_covar.go
+	mux.HandleFunc("/covarupload", covarUpload)
+	mux.HandleFunc("/covarprocess", covarFileProcess)
+
 	// defined in route_varlist.go
 	mux.HandleFunc("/varlistupload", varlistUpload)
 	mux.HandleFunc("/varlistprocess", varlistFileProcess)
 
+	// defined in route_sampleset.go
+	mux.HandleFunc("/samplesetupload", samplesetUpload)
+	mux.HandleFunc("/samplesetprocess", samplesetFileProcess)
+
 	// defined in route_grs.go
 	mux.HandleFunc("/grsupload", grsUpload)
 	mux.HandleFunc("/grsprocess", grsFileProcess)
+	mux.HandleFunc("/grsscoredownload", grsScoreDownload)
+	mux.HandleFunc("/grsbatch", grsBatch)
+
+	// defined in route_grsassoc.go
+	mux.HandleFunc("/grsassoc", grsAssoc)
+	mux.HandleFunc("/grsassocresults", grsAssocResults)
 
 	// defined in route_genodata.go
 	mux.HandleFunc("/download", dataDownload)
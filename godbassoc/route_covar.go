@@ -0,0 +1,103 @@
+// route_covar.go
+// Functions to upload covariate files and load them into the ehr database
+//
+package main
+
+import (
+	"assoc"
+	"bufio"
+	"bytes"
+	"ehrdb"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func covarUpload(w http.ResponseWriter, r *http.Request) {
+	var data []string
+	t := template.Must(template.ParseFiles(
+		config.Templates+"/covarupload.html",
+		config.Templates+"/navigation.html"))
+	t.ExecuteTemplate(w, "covarupload", data)
+}
+
+func covarFileProcess(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Covariate File Upload Endpoint Hit\n")
+
+	// Parse the multipart form, 10 << 20 specifies a maximum
+	// upload of 10 MB files.
+	r.ParseMultipartForm(10 << 20)
+	file, handler, err := r.FormFile("covarFile")
+	if err != nil {
+		log.Printf("File retrieve err %v\n", err)
+		return
+	}
+	defer file.Close()
+	log.Printf("Uploaded File: %+v\n", handler.Filename)
+	log.Printf("File Size: %+v\n", handler.Size)
+
+	cname := r.FormValue("cname")
+	csource := r.FormValue("csource")
+	cdesc := r.FormValue("cdesc")
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		log.Printf("File readall err %v\n", err)
+	}
+	err = ioutil.WriteFile(config.PhenofilePath+"/"+handler.Filename, fileBytes, 0644)
+	if err != nil {
+		log.Printf("Write err %v\n", err)
+		errorMessage(w, r, fmt.Sprintf("Write err %v\n", err))
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
+	scanner.Scan()
+	hdr := scanner.Text()
+	hdrData := strings.Split(hdr, ",")
+	log.Printf("HDR=%v", hdrData)
+	if len(hdrData) < 2 || strings.TrimSpace(hdrData[0]) != "iid" {
+		errorMessage(w, r, handler.Filename+": Invalid file header detected expected: iid,<covariate>[:<type>],... got: "+hdr)
+		return
+	}
+	columns, types, err := assoc.ParseCovarHeader(hdrData[1:])
+	if err != nil {
+		errorMessage(w, r, handler.Filename+": "+err.Error())
+		return
+	}
+	covaritems := make(map[string][]string)
+	for scanner.Scan() {
+		lineData := strings.Split(scanner.Text(), ",")
+		if len(lineData) != len(hdrData) {
+			continue
+		}
+		values := make([]string, len(columns))
+		for c := range columns {
+			values[c] = strings.TrimSpace(lineData[c+1])
+		}
+		covaritems[strings.TrimSpace(lineData[0])] = values
+	}
+	// untyped columns take the type their values suggest
+	for c := range columns {
+		if types[c] == "" {
+			colValues := make([]string, 0, len(covaritems))
+			for _, values := range covaritems {
+				colValues = append(colValues, values[c])
+			}
+			types[c] = assoc.InferCovarType(colValues)
+		}
+	}
+	if _, err := assoc.EncodeCovariates(columns, types, covaritems); err != nil {
+		errorMessage(w, r, handler.Filename+": "+err.Error())
+		return
+	}
+	meta := ehrdb.DBCovarMeta{Name: cname, Source: csource, Description: cdesc, Columns: columns, Types: types}
+	res, msg := ehrdb.InsertCovarDataWithCheck(meta, covaritems)
+	if res != true {
+		errorMessage(w, r, "Covariate upload failed for "+cname+" "+msg)
+	} else {
+		url := []string{"/index"}
+		http.Redirect(w, r, strings.Join(url, ""), 302)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"genometrics"
 	"godb"
 	"io/ioutil"
 	"log"
@@ -35,7 +36,19 @@ func dataDownload(w http.ResponseWriter, r *http.Request) {
 			varlistName, variantList := getVariantList(r.URL.Query())
 			//variantList = append(variantList, r.URL.Query()["variant"][0])
 			pthr, _ := strconv.ParseFloat(r.URL.Query()["pthr"][0], 64)
-			_, _, comborecs := godb.Getallvardata(config.VcfPrfx, variantList, getAssaytypes(), pthr)
+			samplesetName, sampleset := getSampleset(r.URL.Query())
+			var collectors genometrics.Collectors
+			if fmtChoice == "concordance" {
+				collectors.Tally = genometrics.NewConcordanceTally()
+			}
+			if fmtChoice == "audit" {
+				collectors.Audit = genometrics.NewProvenanceAudit(getAuditVarids(r.URL.Query()))
+			}
+			_, _, comborecs, exclCount, err := godb.GetallvardataForSamples(config.VcfPrfx, variantList, getAssaytypes(), pthr, sampleset, collectors)
+			if err != nil {
+				errorMessage(w, r, "Sample set "+samplesetName+": "+err.Error())
+				return
+			}
 			// content, outFmt := godb.FormatOutput(comborecs, fmtChoice)
 			fnameprfx := ""
 			if varlistName == "None" {
@@ -43,13 +56,23 @@ func dataDownload(w http.ResponseWriter, r *http.Request) {
 			} else {
 				fnameprfx = varlistName
 			}
+			if samplesetName != NONE {
+				fnameprfx = fnameprfx + "_" + samplesetName
+			}
 			outFileName := config.OutfilePath + "/" + fnameprfx + "." + fmtChoice + ".gz"
 			dnldFileName := fnameprfx + "." + fmtChoice + ".gz"
 
 			// Initialize gzip
 			buf := &bytes.Buffer{}
 			gzWriter := gzip.NewWriter(buf)
-			outrecs := makeOutputRecords(comborecs, fmtChoice, pthr)
+			var outrecs []string
+			if collectors.Tally != nil {
+				outrecs = collectors.Tally.TSVLines()
+			} else if collectors.Audit != nil {
+				outrecs = collectors.Audit.TSVLines()
+			} else {
+				outrecs = makeOutputRecords(comborecs, fmtChoice, pthr, exclCount)
+			}
 			gzWriter.Write([]byte(strings.Join(outrecs, "\n") + "\n"))
 			gzWriter.Close()
 			ioutil.WriteFile(outFileName, buf.Bytes(), 0644)
@@ -67,9 +90,11 @@ func dataDownload(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, strings.Join(url, ""), 302)
 	}
 }
-func makeOutputRecords(recs []string, fmtChoice string, pthr float64) []string {
+func makeOutputRecords(recs []string, fmtChoice string, pthr float64, exclCount int) []string {
 	if fmtChoice != "vcf" {
 		recs = makeCsvData(recs, pthr)
+	} else {
+		recs = append([]string{godb.ExclusionProvenance(exclCount)}, recs...)
 	}
 	return recs
 }
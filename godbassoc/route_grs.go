@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"ehrdb"
 	"fmt"
+	"genometrics"
 	"godb"
 	"grs"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -59,24 +61,38 @@ func grsFileProcess(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Write err %v\n", err)
 		errorMessage(w, r, fmt.Sprintf("Write err %v\n", err))
 	}
+	var grsLines []string
 	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
-	scanner.Scan()
-	hdr := scanner.Text()
+	for scanner.Scan() {
+		grsLines = append(grsLines, scanner.Text())
+	}
+	grsMeta := ehrdb.DBGrsMeta{Name: gname, Description: gdesc}
+	if grs.IsPGSCatalog(grsLines) {
+		pgsLines, pgsMeta, err := pgsCatalogGrsLines(grsLines)
+		if err != nil {
+			errorMessage(w, r, handler.Filename+": "+err.Error())
+			return
+		}
+		grsLines = pgsLines
+		grsMeta.Description = gdesc + " [" + pgsMeta.Description + "]"
+		grsMeta.Source, grsMeta.Trait, grsMeta.Build = pgsMeta.Source, pgsMeta.Trait, pgsMeta.Build
+	}
+	if len(grsLines) == 0 {
+		grsLines = append(grsLines, "")
+	}
+	hdr := grsLines[0]
 	hdrData := strings.Split(hdr, ",")
 	log.Printf("HDR=%v", hdrData)
 	if grsHdrIsValid(hdrData) == false {
-		errorMessage(w, r, handler.Filename+": Invalid file header detected expected: "+config.GrsColumns+" got: "+hdr)
+		errorMessage(w, r, handler.Filename+": Invalid file header detected expected: "+config.GrsColumns+
+			" or a PGS Catalog scoring file, got: "+hdr)
 	} else {
-		var grsLines []string
-		grsLines = append(grsLines, hdr)
 		grsitems := make(map[string][]string)
-		for scanner.Scan() {
-			line := scanner.Text()
-			grsLines = append(grsLines, line)
+		for _, line := range grsLines[1:] {
 			lineData := strings.Split(line, ",")
 			grsitems[lineData[0]] = lineData[1:]
 		}
-		res, msg := ehrdb.InsertGrsInputDataWithCheck(gname, gdesc, grsitems)
+		res, msg := ehrdb.InsertGrsInputDataWithMeta(grsMeta, grsitems)
 		if res != true {
 			errorMessage(w, r, "GRS file upload failed for "+gname+" "+msg)
 			elapsed := time.Since(start)
@@ -86,10 +102,12 @@ func grsFileProcess(w http.ResponseWriter, r *http.Request) {
 
 			_, _, genorecs := godb.Getallvardata(config.VcfPrfx, rsidList, getAssaytypes(), getThresholdAsFloat())
 
-			_, grScoresFlip := grs.GetScores(genorecs, eaMap, eafMap, wgtMap)
-
-			for _, gScore := range grScoresFlip {
-				log.Printf("%s\n", gScore)
+			params := getGrsParams(r.URL.Query(), getThresholdAsFloat())
+			grScores, matches := grs.GetScoresWithParams(genorecs, eaMap, eafMap, wgtMap, params)
+			log.Printf("grsFileProcess: SNP matching %v", grs.MatchCounts(matches))
+			if _, err := storeGrsScores(gname, params, NONE, grScores); err != nil {
+				errorMessage(w, r, "GRS scores for "+gname+" not stored: "+err.Error())
+				return
 			}
 			elapsed := time.Since(start)
 			log.Printf("res: GRS save / calc time = %s", elapsed)
@@ -99,6 +117,36 @@ func grsFileProcess(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// pgsCatalogGrsLines ...
+// Convert a PGS Catalog scoring file to GRS input lines. Coordinate-only
+// entries are matched to variants by position and alleles, unless the
+// file's genome build differs from the configured genomebuild
+func pgsCatalogGrsLines(lines []string) ([]string, ehrdb.DBGrsMeta, error) {
+	var meta ehrdb.DBGrsMeta
+	score, err := grs.ParsePGSCatalog(lines)
+	if err != nil {
+		return nil, meta, err
+	}
+	buildOK := score.BuildMatches(config.GenomeBuild)
+	if !buildOK {
+		log.Printf("pgsCatalogGrsLines: %s build %s, positions not used (genomebuild %s)", score.ID(), score.Build(),
+			config.GenomeBuild)
+	}
+	grsLines, unresolved := score.GrsLines(func(chrom string, posn int, ea string, oa string) string {
+		if !buildOK {
+			return ""
+		}
+		return godb.GetPositionVarid(chrom, posn, ea, oa, getAssaytypes())
+	})
+	for _, entry := range unresolved {
+		log.Printf("pgsCatalogGrsLines: %s unresolved %s %s %s/%s", score.ID(), entry.Rsid, entry.Locus(), entry.EA, entry.OA)
+	}
+	meta.Source, meta.Trait, meta.Build = score.ID(), score.Trait(), score.Build()
+	meta.Description = fmt.Sprintf("%s; used=%d, unresolved=%d, skipped=%d", score.Description(), len(grsLines)-1,
+		len(unresolved), score.Skipped)
+	return grsLines, meta, nil
+}
+
 //  hdrIsValid ...
 //  Does the supplied header record contain all required fields?
 func grsHdrIsValid(hdr []string) bool {
@@ -119,3 +167,82 @@ func grsHdrIsValid(hdr []string) bool {
 	}
 	return false
 }
+
+// grsScoreDownload ...
+// stored scores for a GRS name and version (most recently stored if not
+// given) as CSV
+func grsScoreDownload(w http.ResponseWriter, r *http.Request) {
+	grsName := r.URL.Query().Get("grsname")
+	if grsName == "" || grsName == NONE {
+		http.Redirect(w, r, "/grsrun", 302)
+		return
+	}
+	version, _ := strconv.Atoi(r.URL.Query().Get("version"))
+	run := ehrdb.GetGrsScoreRun(grsName, version)
+	if run.Version == 0 {
+		errorMessage(w, r, "No stored scores for GRS "+grsName)
+		return
+	}
+	scores := ehrdb.GetGrsScoreRecords(grsName, run.Version)
+	var buf bytes.Buffer
+	buf.WriteString("FID,IID,snpcount,imputed,score\n")
+	for _, score := range scores {
+		buf.WriteString(fmt.Sprintf("%s,%s,%d,%d,%s\n", score.IID, score.IID, score.SnpCount, score.Imputed, score.Score))
+	}
+	dnldFileName := fmt.Sprintf("%s_v%d.grsscore.csv", grsName, run.Version)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(dnldFileName))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Write(buf.Bytes())
+	log.Printf("grsScoreDownload: %s version %d (%s), %d scores", grsName, run.Version, run.Params, len(scores))
+}
+
+// grsBatch ...
+// score a list of GRS (grsnames) in one genotype pass over the union of
+// their SNPs, store each run and download the sample x score table as CSV
+func grsBatch(w http.ResponseWriter, r *http.Request) {
+	urlParams := r.URL.Query()
+	names := make([]string, 0)
+	for _, name := range urlParams["grsnames"] {
+		if name != "" && name != NONE {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		http.Redirect(w, r, "/grsrun", 302)
+		return
+	}
+	start := time.Now()
+	sets := make([]grs.GrsSet, 0, len(names))
+	for _, name := range names {
+		grsList, count := ehrdb.GetGrsInputAsStringArrayByName(name)
+		if count == 0 {
+			errorMessage(w, r, "No GRS input for "+name)
+			return
+		}
+		sets = append(sets, grs.NewGrsSet(name, grsList))
+	}
+	rsidList := grs.UnionVarids(sets)
+	samplesetName, sampleset := getSampleset(urlParams)
+	_, _, genorecs, _, err := godb.GetallvardataForSamples(config.VcfPrfx, rsidList, getAssaytypes(), getThresholdAsFloat(), sampleset,
+		genometrics.Collectors{})
+	if err != nil {
+		errorMessage(w, r, "Sample set "+samplesetName+": "+err.Error())
+		return
+	}
+
+	params := getGrsParams(urlParams, getThresholdAsFloat())
+	batch := grs.GetBatchScores(genorecs, sets, params)
+	for s, name := range batch.Names {
+		log.Printf("grsBatch: %s SNP matching %v", name, grs.MatchCounts(batch.Matches[s]))
+		if _, err := storeGrsScores(name, params, samplesetName, batch.Scores[s]); err != nil {
+			errorMessage(w, r, "GRS scores for "+name+" not stored: "+err.Error())
+			return
+		}
+	}
+	log.Printf("grsBatch: %d GRS, %d SNPs, %d samples, took %s", len(names), len(rsidList), len(batch.Samples), time.Since(start))
+
+	dnldFileName := fmt.Sprintf("grsbatch_%d.csv", len(names))
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(dnldFileName))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Write([]byte(strings.Join(batch.WideLines(), "\n") + "\n"))
+}
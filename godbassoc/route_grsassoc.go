@@ -0,0 +1,108 @@
+package main
+
+import (
+	"ehrdb"
+	"fmt"
+	"grs"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GrsassocData ...
+type GrsassocData struct {
+	GrsScoreList []string
+	PhenoList    []string
+}
+
+// GrsassocresultsData ...
+type GrsassocresultsData struct {
+	GrsName     string
+	Version     int
+	GrsParams   string
+	PhenoName   string
+	PhenoSource string
+	PhenoDesc   string
+	PhenoClass  string
+	PhenoCount  int
+	Quantiles   int
+	Reference   int
+	Result      grs.AssocResult
+}
+
+// Registered handler for "grsassoc" (stored GRS and phenotype selection)
+func grsAssoc(w http.ResponseWriter, r *http.Request) {
+	var data GrsassocData
+	data.GrsScoreList = ehrdb.GetGrsScoreNames()
+	data.PhenoList = ehrdb.GetPhenoMetaNames()
+	t := template.Must(template.ParseFiles(
+		config.Templates+"/grsassoc.html",
+		config.Templates+"/navigation.html"))
+	t.ExecuteTemplate(w, "grsassoc", data)
+}
+
+// Registered handler for "grsassocresults", association of a stored GRS
+// with a stored phenotype, rendered or (resbtn=Download) as CSV
+func grsAssocResults(w http.ResponseWriter, r *http.Request) {
+	urlParams := r.URL.Query()
+	grsName := urlParams.Get("grsname")
+	phenoName := urlParams.Get("pheno")
+	if grsName == "" || grsName == NONE || phenoName == "" || phenoName == NONE {
+		url := []string{"/grsassoc"}
+		http.Redirect(w, r, strings.Join(url, ""), 302)
+		return
+	}
+	start := time.Now()
+	var data GrsassocresultsData
+	data.GrsName = grsName
+	data.PhenoName = phenoName
+	version, _ := strconv.Atoi(urlParams.Get("version"))
+	run := ehrdb.GetGrsScoreRun(grsName, version)
+	if run.Version == 0 {
+		errorMessage(w, r, "No stored scores for GRS "+grsName)
+		return
+	}
+	data.Version = run.Version
+	data.GrsParams = run.Params
+	data.Quantiles, _ = strconv.Atoi(urlParams.Get("quantiles"))
+	if data.Quantiles == 0 {
+		data.Quantiles = 4
+	}
+	data.Reference, _ = strconv.Atoi(urlParams.Get("reference"))
+	if data.Reference < 1 || data.Reference > data.Quantiles {
+		data.Reference = 1
+	}
+
+	scores := make(map[string]float64)
+	for _, score := range ehrdb.GetGrsScoreRecords(grsName, run.Version) {
+		if value, err := strconv.ParseFloat(score.Score, 64); err == nil {
+			scores[score.IID] = value
+		}
+	}
+	phenoData, pCount, phenoMeta := getPhenoData(phenoName)
+	data.PhenoSource = phenoMeta.Source
+	data.PhenoDesc = phenoMeta.Description
+	data.PhenoClass = phenoMeta.PhenoClass
+	data.PhenoCount = pCount
+	params := grs.AssocParams{Binary: data.PhenoClass == "Binary", Quantiles: data.Quantiles, Reference: data.Reference}
+	data.Result = grs.GrsAssoc(scores, phenoData, params)
+	log.Printf("grsassocresults: %s v%d, %s: %s, took %s", grsName, run.Version, phenoName, data.Result.CSV(), time.Since(start))
+
+	if urlParams.Get("resbtn") == "Download" {
+		lines := []string{fmt.Sprintf("# grs=%s version=%d params=%s pheno=%s class=%s", grsName, run.Version, run.Params,
+			phenoName, data.PhenoClass)}
+		lines = append(lines, data.Result.CSVLines()...)
+		dnldFileName := fmt.Sprintf("%s_v%d_%s.grsassoc.csv", grsName, run.Version, strings.Replace(phenoName, ":", "_", -1))
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(dnldFileName))
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+		return
+	}
+	t := template.Must(template.ParseFiles(
+		config.Templates+"/grsassocresults.html",
+		config.Templates+"/navigation.html"))
+	t.ExecuteTemplate(w, "grsassocresults", data)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"assoc"
 	"ehrdb"
+	"fmt"
+	"genometrics"
 	"godb"
 	"grs"
 	"html/template"
+	"ld"
 	"log"
 	"net/http"
 	"os/exec"
@@ -17,6 +21,7 @@ import (
 type VariantData struct {
 	Variant       string
 	VarlistName   string
+	SamplesetName string
 	DataList      []godb.DBVariant
 	ComboDataList []godb.DBVariant
 	Pthr          float64
@@ -25,20 +30,50 @@ type VariantData struct {
 	PhenoDesc     string
 	PhenoClass    string
 	PhenoCount    int
-	AssocResults  []string
+	AssocParams   string
+	AssocResults  []assoc.Result
+	AssocLines    []string
+	Covariates    []string
+	CovarCount    int
+	LDMatrix      ld.Matrix
+	LDMessage     string
+	ExcludedCount int
+	Concordance   []genometrics.PairSummary
 }
 
 // IndexData ...
 type IndexData struct {
-	VarnameList []string
-	PhenoList   []string
-	Pthr        float64
+	VarnameList   []string
+	SamplesetList []string
+	PhenoList     []string
+	CovarList     []string
+	Pthr          float64
+}
+
+// GrsresultsData ...
+type GrsresultsData struct {
+	GrsName       string
+	GrsDesc       string
+	SamplesetName string
+	Params        string
+	Version       int
+	SaveURL       string
+	SNPsRequested int
+	SNPsFound     int
+	SNPsUsed      int
+	MatchCounts   map[string]int
+	Matches       []grs.SNPMatch
+	Summary       grs.ScoreSummary
+	Histogram     template.HTML
+	DataList      []grs.SampleScore
 }
 
 // GrsrunData ...
 type GrsrunData struct {
-	GrsnameList []string
-	Pthr        float64
+	GrsnameList   []string
+	SamplesetList []string
+	GrsScoreList  []string
+	Pthr          float64
 }
 
 // GET /err?msg=
@@ -56,7 +91,9 @@ func index(w http.ResponseWriter, r *http.Request) {
 	var data IndexData
 	data.VarnameList = ehrdb.GetVarlistMetaNames()
 	log.Printf("index: VarnameList %v", data.VarnameList)
-	data.PhenoList = ehrdb.GetPhenoMetaNames()
+	data.PhenoList = getPhenoList()
+	data.SamplesetList = ehrdb.GetSamplesetMetaNames()
+	data.CovarList = ehrdb.GetCovarMetaNames()
 	t := template.Must(template.ParseFiles(
 		config.Templates+"/index.html",
 		config.Templates+"/navigation.html"))
@@ -69,6 +106,8 @@ func grsrun(w http.ResponseWriter, r *http.Request) {
 	var data GrsrunData
 	data.GrsnameList = ehrdb.GetGrsMetaNames()
 	log.Printf("index: grsnameList %v", data.GrsnameList)
+	data.SamplesetList = ehrdb.GetSamplesetMetaNames()
+	data.GrsScoreList = ehrdb.GetGrsScoreNames()
 	t := template.Must(template.ParseFiles(
 		config.Templates+"/grsrun.html",
 		config.Templates+"/navigation.html"))
@@ -99,53 +138,106 @@ func results(w http.ResponseWriter, r *http.Request) {
 		}
 
 		data.VarlistName = varlistName
+		samplesetName, sampleset := getSampleset(r.URL.Query())
+		data.SamplesetName = samplesetName
 		data.Pthr, _ = strconv.ParseFloat(config.Pthr, 64)
 		tmppthr, err := strconv.ParseFloat(r.URL.Query()["pthr"][0], 64)
 		if err == nil {
 			data.Pthr = tmppthr
 		}
+		// LD region around a single index SNP, window in kb
+		ldRegion := false
+		if ldwin, ok := r.URL.Query()["ldwin"]; ok && len(rsidList) == 1 {
+			window, err := strconv.Atoi(ldwin[0])
+			if err == nil && window > 0 {
+				rsidList = godb.GetRegionVarids(rsidList[0], window*1000, getAssaytypes())
+				data.Variant = strings.Join(rsidList, ",")
+				ldRegion = true
+			}
+		}
 		start := time.Now()
-		variants, combinedvariants, genorecs := godb.Getallvardata(config.VcfPrfx, rsidList, getAssaytypes(), data.Pthr)
+		tally := genometrics.NewConcordanceTally()
+		variants, combinedvariants, genorecs, exclCount, err := godb.GetallvardataForSamples(config.VcfPrfx, rsidList, getAssaytypes(), data.Pthr, sampleset,
+			genometrics.Collectors{Tally: tally})
+		if err != nil {
+			errorMessage(w, r, "Sample set "+samplesetName+": "+err.Error())
+			return
+		}
 		elapsed := time.Since(start)
 		log.Printf("res: dbaccess took %s", elapsed)
 		data.DataList = variants
 		data.ComboDataList = combinedvariants
+		data.ExcludedCount = exclCount
+		data.Concordance = tally.Summary()
+		// LD only when asked for (ldmode, or an LD region), for up to
+		// maxLDVariants variants
+		ldmode := r.URL.Query().Get("ldmode")
+		if ldmode == "hard" || ldmode == "dosage" || ldRegion {
+			if count := len(genorecs) - 1; count > maxLDVariants {
+				data.LDMessage = fmt.Sprintf("LD not computed for %d variants, the limit is %d", count, maxLDVariants)
+			} else {
+				data.LDMatrix = ld.GetMatrix(genorecs, data.Pthr, ldmode == "dosage")
+			}
+		}
 		phenoName := r.URL.Query()["pheno"][0]
 
 		if phenoName == NONE {
 			t := template.Must(template.ParseFiles(
 				config.Templates+"/results.html",
 				config.Templates+"/vartables.html",
+				config.Templates+"/ldtable.html",
+				config.Templates+"/concordance.html",
 				config.Templates+"/navigation.html"))
 			t.ExecuteTemplate(w, "results", data)
 		} else {
 			data.PhenoName = phenoName
-			phenoMeta := ehrdb.GetPhenoMetaByName(phenoName)
+			// Get phenotype data from ehrdb, or stored GRS scores
+			phenoData, pCount, phenoMeta := getPhenoData(phenoName)
 			data.PhenoSource = phenoMeta.Source
 			data.PhenoDesc = phenoMeta.Description
 			data.PhenoClass = phenoMeta.PhenoClass
-			// Get phenotype data from ehrdb
-			phenoData, pCount := ehrdb.GetPhenoByName(phenoName)
 			data.PhenoCount = pCount
-			phenoFileName := config.PhenofilePath + "/" + phenoName + ".csv"
-			writeBufferedFile(phenoFileName, convertStringMapToCSV(phenoData))
-			genoFileName := config.OutfilePath + "/temp.vcf"
-			writeBufferedFile(genoFileName, genorecs)
-			var cmd *exec.Cmd
-
-			if data.PhenoClass != "Binary" {
-				cmd = exec.Command(config.AssocCmd, genoFileName, phenoFileName)
+			covs, covarDesc, err := getCovariates(r.URL.Query())
+			if err != nil {
+				errorMessage(w, r, err.Error())
+				return
+			}
+			data.Covariates = covarDesc
+			data.CovarCount = len(covs.Values)
+			if r.URL.Query().Get("assocengine") == "plink" && config.AssocCmd != "" {
+				// PLINK via the configured wrapper scripts (geno file, pheno
+				// file), text output. The scripts take no covariates
+				if len(covs.Names) > 0 {
+					errorMessage(w, r, "Covariate adjusted tests use the built in regression, PLINK (assoccmd) is unadjusted only")
+					return
+				}
+				phenoFileName := config.PhenofilePath + "/" + strings.Replace(phenoName, ":", "_", -1) + ".csv"
+				writeBufferedFile(phenoFileName, convertStringMapToCSV(phenoData))
+				genoFileName := config.OutfilePath + "/temp.vcf"
+				writeBufferedFile(genoFileName, genorecs)
+				var cmd *exec.Cmd
+
+				if data.PhenoClass != "Binary" {
+					cmd = exec.Command(config.AssocCmd, genoFileName, phenoFileName)
+				} else {
+					cmd = exec.Command(config.AssocBinaryCmd, genoFileName, phenoFileName)
+				}
+				res, err := cmd.Output()
+				check(err, "Assoc command:"+config.AssocCmd+":"+genoFileName+":"+phenoFileName)
+				data.AssocParams = "PLINK"
+				data.AssocLines = assocReformat(string(res))
 			} else {
-				cmd = exec.Command(config.AssocBinaryCmd, genoFileName, phenoFileName)
+				params := getAssocParams(r.URL.Query(), data.Pthr, data.PhenoClass == "Binary")
+				params.Covariates = covs
+				data.AssocParams = params.Describe()
+				data.AssocResults = assoc.TestRecords(genorecs, phenoData, params)
 			}
-			//err = cmd.Run()
-			res, err := cmd.Output()
-			check(err, "Assoc command:"+config.AssocCmd+":"+genoFileName+":"+phenoFileName)
-			data.AssocResults = assocReformat(string(res))
 			//fmt.Printf("%s\n", "combined"+"\t"+colhdr_str)
 			t := template.Must(template.ParseFiles(
 				config.Templates+"/assocresults.html",
 				config.Templates+"/vartables.html",
+				config.Templates+"/ldtable.html",
+				config.Templates+"/concordance.html",
 				config.Templates+"/navigation.html"))
 			elapsed := time.Since(start)
 			log.Printf("res: dbaccess + assoctest took %s", elapsed)
@@ -157,7 +249,8 @@ func results(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Registered handler for "grsresults".
+// Registered handler for "grsresults", GET shows the scores, POST (same
+// query) also stores them
 func grsresults(w http.ResponseWriter, r *http.Request) {
 	var validAssaytypes = map[string]bool{}
 	if len(r.URL.Query()) != 0 {
@@ -175,15 +268,49 @@ func grsresults(w http.ResponseWriter, r *http.Request) {
 			for at := range atList {
 				validAssaytypes[atList[at]] = true
 			}
-			_, _, genorecs := godb.Getallvardata(config.VcfPrfx, rsidList, validAssaytypes, pthr)
+			samplesetName, sampleset := getSampleset(r.URL.Query())
+			_, _, genorecs, _, err := godb.GetallvardataForSamples(config.VcfPrfx, rsidList, validAssaytypes, pthr, sampleset, genometrics.Collectors{})
+			if err != nil {
+				errorMessage(w, r, "Sample set "+samplesetName+": "+err.Error())
+				return
+			}
 
-			grScores, _ := grs.GetScores(genorecs, eaMap, eafMap, wgtMap)
-			for _, score := range grScores {
-				log.Printf("Scoreline: %s", score)
+			params := getGrsParams(r.URL.Query(), pthr)
+			grScores, matches := grs.GetScoresWithParams(genorecs, eaMap, eafMap, wgtMap, params)
+			var data GrsresultsData
+			data.GrsName = grsName
+			data.GrsDesc = ehrdb.GetGrsMetaByName(grsName).Description
+			data.SamplesetName = samplesetName
+			data.Params = params.Describe()
+			data.SNPsRequested = len(rsidList)
+			data.MatchCounts = grs.MatchCounts(matches)
+			data.SNPsFound = len(matches) - data.MatchCounts[grs.MatchNotFound]
+			data.SNPsUsed = data.MatchCounts[grs.MatchUsed] + data.MatchCounts[grs.MatchFlipped] + data.MatchCounts[grs.MatchComplemented]
+			data.Matches = matches
+			data.Summary = grs.Summarise(grScores)
+			data.Histogram = svgHistogram(grs.ScoreValues(grScores), 30, grsName+" score")
+			data.DataList = grScores
+			log.Printf("grsresults: SNP matching %v", data.MatchCounts)
+			data.SaveURL = "/grsresults/?" + r.URL.RawQuery
+			// viewing is read-only, the scores are stored by the page's
+			// save button (a POST of the same query)
+			if r.Method == http.MethodPost {
+				data.Version, err = storeGrsScores(grsName, params, samplesetName, grScores)
+				if err != nil {
+					errorMessage(w, r, "GRS scores for "+grsName+" not stored: "+err.Error())
+					return
+				}
 			}
 			elapsed := time.Since(start)
 			log.Printf("grsresults timing %s", elapsed)
-
+			t := template.Must(template.ParseFiles(
+				config.Templates+"/grsresults.html",
+				config.Templates+"/grstables.html",
+				config.Templates+"/navigation.html"))
+			t.ExecuteTemplate(w, "grsresults", data)
+			return
 		}
 	}
+	url := []string{"/grsrun"}
+	http.Redirect(w, r, strings.Join(url, ""), 302)
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"assoc"
 	"bufio"
 	"ehrdb"
 	"fmt"
+	"grs"
 	"html/template"
 	"log"
 	"net/http"
@@ -15,6 +17,12 @@ import (
 // Found throughout the package
 const NONE = "None"
 
+// GRSPHENO prefix for stored GRS scores offered as phenotypes
+const GRSPHENO = "grs:"
+
+// maxLDVariants limit on the variants in an LD matrix on the results page
+const maxLDVariants = 100
+
 // Convenience function for printing to stdout
 func p(a ...interface{}) {
 	fmt.Println(a...)
@@ -94,6 +102,71 @@ func assocReformat(assocResult string) []string {
 	return strings.Split(assocResult, "\n")
 }
 
+// getAssocParams ...
+// association test settings from the query parameters assocmodel
+// (additive, dominant, recessive) and assocgeno (hard, dosage), hard
+// calls at pthr by default
+func getAssocParams(urlParams map[string][]string, pthr float64, binary bool) assoc.Params {
+	params := assoc.Params{Model: assoc.ModelAdditive, Threshold: pthr, Binary: binary}
+	if models, ok := urlParams["assocmodel"]; ok && len(models) > 0 {
+		switch models[0] {
+		case assoc.ModelDominant, assoc.ModelRecessive:
+			params.Model = models[0]
+		}
+	}
+	if genos, ok := urlParams["assocgeno"]; ok && len(genos) > 0 && genos[0] == "dosage" {
+		params.UseDosage = true
+	}
+	return params
+}
+
+// getCovariates ...
+// the covariates selected: columns of a stored covariate set (covarset)
+// and any phenotypes, e.g. stored PCs or GRS scores, as Continuous
+// covariates (covarpheno). Also returns each covariate as "name (Type)"
+// for display
+func getCovariates(urlParams map[string][]string) (assoc.Covariates, []string, error) {
+	var covs assoc.Covariates
+	desc := make([]string, 0)
+	if names, ok := urlParams["covarset"]; ok && len(names) > 0 && names[0] != "" && names[0] != NONE {
+		covarMeta := ehrdb.GetCovarMetaByName(names[0])
+		covarData, count := ehrdb.GetCovarByName(names[0])
+		log.Printf("getCovariates: %s, %d samples", names[0], count)
+		setCovs, err := assoc.EncodeCovariates(covarMeta.Columns, covarMeta.Types, covarData)
+		if err != nil {
+			return covs, desc, fmt.Errorf("covariate set %s: %v", names[0], err)
+		}
+		covs = setCovs
+		for c, col := range covarMeta.Columns {
+			desc = append(desc, fmt.Sprintf("%s (%s, %s)", col, covarMeta.Types[c], names[0]))
+		}
+	}
+	for _, phenoName := range urlParams["covarpheno"] {
+		if phenoName == "" || phenoName == NONE {
+			continue
+		}
+		phenoData, _, _ := getPhenoData(phenoName)
+		covs = covs.Merge(assoc.ContinuousCovariate(phenoName, phenoData))
+		desc = append(desc, fmt.Sprintf("%s (%s)", phenoName, assoc.CovarContinuous))
+	}
+	return covs, desc, nil
+}
+
+// getAuditVarids ...
+// varids to restrict a provenance audit to (auditvarids, comma separated),
+// nil to audit every variant
+func getAuditVarids(urlParams map[string][]string) []string {
+	var varids []string
+	if values, ok := urlParams["auditvarids"]; ok && len(values) > 0 {
+		for _, varid := range strings.Split(values[0], ",") {
+			if varid = strings.TrimSpace(varid); varid != "" {
+				varids = append(varids, varid)
+			}
+		}
+	}
+	return varids
+}
+
 func getVariantList(urlParams map[string][]string) (string, []string) {
 	log.Printf("getVariantList: %v", urlParams)
 	varlist := strings.Split(urlParams["variant"][0], ",")
@@ -107,3 +180,77 @@ func getVariantList(urlParams map[string][]string) (string, []string) {
 	}
 	return varlistName, varlist
 }
+
+// getGrsParams ...
+// GRS scoring mode, normalisation and imputation selected, defaulting to
+// mean-imputed average dosage scores
+func getGrsParams(urlParams map[string][]string, pthr float64) grs.ScoreParams {
+	params := grs.ScoreParams{Mode: grs.ModeDosage, Impute: true, Norm: grs.NormAverage, Threshold: pthr,
+		PalindromeMargin: grs.DefaultPalindromeMargin}
+	if modes, ok := urlParams["grsmode"]; ok && len(modes) > 0 && modes[0] == grs.ModeHard {
+		params.Mode = grs.ModeHard
+	}
+	if norms, ok := urlParams["grsnorm"]; ok && len(norms) > 0 && norms[0] == grs.NormSum {
+		params.Norm = grs.NormSum
+	}
+	if imputes, ok := urlParams["grsimpute"]; ok && len(imputes) > 0 && imputes[0] == "none" {
+		params.Impute = false
+	}
+	return params
+}
+
+// storeGrsScores ...
+// save computed scores in the grsscore collection, the run is identified by
+// the scoring parameters and sample set. Returns the stored version
+func storeGrsScores(name string, params grs.ScoreParams, samplesetName string, scores []grs.SampleScore) (int, error) {
+	version, replaced, err := ehrdb.InsertGrsScores(name, params.Describe()+";sampleset="+samplesetName, scores)
+	if err != nil {
+		log.Printf("storeGrsScores: %s error %v", name, err)
+		return version, err
+	}
+	log.Printf("storeGrsScores: %s version %d, %d scores, replaced=%t", name, version, len(scores), replaced)
+	return version, nil
+}
+
+// getPhenoList ...
+// stored phenotype names followed by GRS names with stored scores
+// (GRSPHENO prefix)
+func getPhenoList() []string {
+	phenoList := ehrdb.GetPhenoMetaNames()
+	for _, name := range ehrdb.GetGrsScoreNames() {
+		phenoList = append(phenoList, GRSPHENO+name)
+	}
+	return phenoList
+}
+
+// getPhenoData ...
+// values, count and meta data for a phenotype name, for GRSPHENO names the
+// most recently stored scores for the GRS as a Continuous phenotype
+func getPhenoData(phenoName string) (map[string]string, int, ehrdb.DBPhenoMeta) {
+	if strings.HasPrefix(phenoName, GRSPHENO) {
+		grsName := strings.TrimPrefix(phenoName, GRSPHENO)
+		run := ehrdb.GetGrsScoreRun(grsName, 0)
+		phenoData, count := ehrdb.GetGrsScoresByName(grsName, run.Version)
+		phenoMeta := ehrdb.DBPhenoMeta{Name: phenoName, Source: "grsscore",
+			Description: fmt.Sprintf("GRS %s version %d (%s)", grsName, run.Version, run.Params), PhenoClass: "Continuous"}
+		return phenoData, count, phenoMeta
+	}
+	phenoData, count := ehrdb.GetPhenoByName(phenoName)
+	return phenoData, count, ehrdb.GetPhenoMetaByName(phenoName)
+}
+
+// getSampleset ...
+// the named sample set selected, if any, and its sample ids
+// (nil for all samples)
+func getSampleset(urlParams map[string][]string) (string, []string) {
+	samplesetName := NONE
+	if names, ok := urlParams["samplesetname"]; ok && len(names) > 0 && names[0] != "" {
+		samplesetName = names[0]
+	}
+	if samplesetName == NONE {
+		return samplesetName, nil
+	}
+	sampleset, _ := ehrdb.GetSamplesetByName(samplesetName)
+	log.Printf("getSampleset: %s, %d samples", samplesetName, len(sampleset))
+	return samplesetName, sampleset
+}